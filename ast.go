@@ -0,0 +1,220 @@
+package cascadia
+
+import "strings"
+
+// the structure of parsed selectors, for programs that inspect or rewrite
+// them
+
+// A SelKind is the kind of a Sel, as reported by Inspect.
+type SelKind int
+
+const (
+	ListSel              SelKind = iota // a selector list, like "h1, h2"
+	CombinedSel                         // two selectors and a combinator, like "ul > li"
+	RelativeSel                         // a selector starting with a combinator, as in :has(> img)
+	CompoundSel                         // simple selectors that must all match, like "a.x[href]" or "*"
+	TagSel                              // a type selector, like "div" or "svg|rect"
+	IDSel                               // an id selector, like "#main"
+	ClassSel                            // a class selector, like ".note"
+	AttrSel                             // an attribute selector, like "[href^=http]"
+	PseudoClassSel                      // a pseudo-class, like ":first-child" or ":not(p)"
+	WithPseudoElementSel                // a selector ending with a pseudo-element, like "p::before"
+)
+
+// A SelInfo describes the top level of a Sel: what kind of selector it is,
+// and the selectors it is made of.
+type SelInfo struct {
+	Kind SelKind
+
+	// Name is the tag name, id, class name or attribute name, or the name
+	// of the pseudo-class or pseudo-element, without punctuation: "div",
+	// "main", "href", "nth-child" or "before". Tag and attribute names are
+	// lowercase.
+	Name string
+
+	// Operator and Value are the operator and value of an attribute
+	// selector. For [href], Operator is Exists.
+	//
+	// For a pseudo-class whose argument isn't a selector, Value is the
+	// argument: the text of :contains("text") or :class-prefix(x), or
+	// otherwise the argument in canonical form, such as 2n+1 for
+	// :nth-child(odd). For :nth-child(2n of .x), Value is 2n and .x is
+	// the Child.
+	Operator AttrOperator
+	Value    string
+
+	// Combinator relates the two Children of a combined selector, or a
+	// relative selector's Child to the element it is anchored to.
+	Combinator Combinator
+
+	// Children are the selectors this one is made of: the members of a
+	// list, the simple selectors of a compound selector, the two sides of
+	// a combined selector, the rest of a relative selector, or the
+	// argument of a pseudo-class like :not() or :is().
+	Children []Sel
+}
+
+// Inspect returns a description of the top level of sel, which is a
+// result of Parse or ParseGroup, a part of one, or a selector built with
+// functions like Tag and Combine. Pass its Children to Inspect to look
+// further down.
+func Inspect(sel Sel) SelInfo {
+	info := SelInfo{Children: selChildren(sel)}
+	switch s := sel.(type) {
+	case unionSelector:
+		info.Kind = ListSel
+	case combinedSelector:
+		info.Kind = CombinedSel
+		info.Combinator = Combinator(s.combinator)
+	case relativeSelector:
+		info.Kind = RelativeSel
+		info.Combinator = Combinator(s.combinator)
+	case scopedRelativeSelector:
+		info.Kind = RelativeSel
+		info.Combinator = Combinator(s.combinator)
+	case PseudoElementSel:
+		info.Kind, info.Name = WithPseudoElementSel, s.pseudoElement
+	case compoundSelector:
+		info.Kind = CompoundSel
+	case tagSelector:
+		info.Kind, info.Name = TagSel, s.tag
+	case namespaceTagSelector:
+		info.Kind, info.Name = TagSel, s.tag
+		if s.tag == "" {
+			info.Name = "*"
+		}
+	case idSelector:
+		info.Kind, info.Name = IDSel, s.id
+	case classSelector:
+		info.Kind, info.Name = ClassSel, s.class
+	case attrSelector:
+		info.Kind, info.Name = AttrSel, s.key
+		info.Operator, info.Value = AttrOperator(s.operation), s.val
+	default:
+		info.Kind = PseudoClassSel
+		name := strings.TrimPrefix(sel.String(), ":")
+		if i := strings.IndexByte(name, '('); i != -1 && strings.HasSuffix(name, ")") {
+			if info.Children == nil {
+				info.Value = name[i+1 : len(name)-1]
+			}
+			name = name[:i]
+		}
+		info.Name = name
+		switch s := sel.(type) {
+		case textSubstrSelector:
+			info.Value = s.val
+		case classAffixSelector:
+			info.Value = s.val
+		case nthChildSelector:
+			if s.of != nil {
+				info.Value = anbString(s.a, s.b)
+			}
+		}
+	}
+	return info
+}
+
+// selChildren returns the selectors that sel is made of, as in
+// SelInfo.Children.
+func selChildren(sel Sel) []Sel {
+	switch s := sel.(type) {
+	case unionSelector:
+		return s
+	case compoundSelector:
+		return s
+	case combinedSelector:
+		return []Sel{s.first, s.second}
+	case relativeSelector:
+		return []Sel{s.sel}
+	case scopedRelativeSelector:
+		return []Sel{s.sel}
+	case PseudoElementSel:
+		return []Sel{s.Sel}
+	case negatedSelector:
+		return []Sel{s.sel}
+	case matchesAnySelector:
+		return []Sel{s.sel}
+	case hasSelector:
+		return []Sel{s.sel}
+	case nthChildSelector:
+		if s.of != nil {
+			return []Sel{s.of}
+		}
+	}
+	return nil
+}
+
+// withChildren returns a copy of sel with its children, as returned by
+// selChildren, replaced by children.
+func withChildren(sel Sel, children []Sel) Sel {
+	switch s := sel.(type) {
+	case unionSelector:
+		return unionSelector(children)
+	case compoundSelector:
+		return compoundSelector(children)
+	case combinedSelector:
+		return combinedSelector{first: children[0], combinator: s.combinator, second: children[1]}
+	case relativeSelector:
+		return relativeSelector{combinator: s.combinator, sel: children[0]}
+	case scopedRelativeSelector:
+		s.sel = children[0]
+		return s
+	case PseudoElementSel:
+		s.Sel = children[0]
+		return s
+	case negatedSelector:
+		return negatedSelector{children[0]}
+	case matchesAnySelector:
+		return matchesAnySelector{sel: children[0], where: s.where}
+	case hasSelector:
+		return hasSelector{sel: children[0], child: s.child}
+	case nthChildSelector:
+		s.of = children[0]
+		return s
+	}
+	return sel
+}
+
+// Walk calls fn with sel and then, if fn returns true, with each of the
+// selectors sel is made of, as listed in SelInfo.Children, and so on down,
+// in the order they appear in the selector's text.
+func Walk(sel Sel, fn func(Sel) bool) {
+	if !fn(sel) {
+		return
+	}
+	for _, c := range selChildren(sel) {
+		Walk(c, fn)
+	}
+}
+
+// Rewrite returns a copy of sel in which each part has been replaced by the
+// result of calling fn with it. The parts are rewritten from the bottom up,
+// so fn is called with a selector after the selectors it is made of have
+// been rewritten, and last with sel itself. fn returns its argument to leave
+// it as it is. For example, this removes :hover from a selector:
+//
+//	Rewrite(sel, func(s Sel) Sel {
+//		if info := Inspect(s); info.Kind == CompoundSel {
+//			var parts []Sel
+//			for _, c := range info.Children {
+//				if c.String() != ":hover" {
+//					parts = append(parts, c)
+//				}
+//			}
+//			return And(parts...)
+//		}
+//		return s
+//	})
+//
+// The result may not be in the form Parse would produce, but it matches
+// like its String method says.
+func Rewrite(sel Sel, fn func(Sel) Sel) Sel {
+	if children := selChildren(sel); len(children) > 0 {
+		rewritten := make([]Sel, len(children))
+		for i, c := range children {
+			rewritten[i] = Rewrite(c, fn)
+		}
+		sel = withChildren(sel, rewritten)
+	}
+	return fn(sel)
+}
@@ -0,0 +1,229 @@
+package cascadia
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestInspect(t *testing.T) {
+	sel, err := Parse(`ul > LI.item[data-x^="y"]:not(:first-child), svg|*`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := Inspect(sel)
+	if list.Kind != ListSel || len(list.Children) != 2 {
+		t.Fatalf("got %+v, want a list of 2", list)
+	}
+	combined := Inspect(list.Children[0])
+	if combined.Kind != CombinedSel || combined.Combinator != ChildCombinator || len(combined.Children) != 2 {
+		t.Fatalf("got %+v, want a combined selector", combined)
+	}
+	if got := Inspect(combined.Children[0]); got.Kind != CompoundSel || len(got.Children) != 1 {
+		t.Errorf("ul: got %+v", got)
+	}
+
+	compound := Inspect(combined.Children[1])
+	if compound.Kind != CompoundSel || len(compound.Children) != 4 {
+		t.Fatalf("got %+v, want a compound selector of 4", compound)
+	}
+	var got []SelInfo
+	for _, c := range compound.Children {
+		info := Inspect(c)
+		info.Children = nil
+		got = append(got, info)
+	}
+	want := []SelInfo{
+		{Kind: TagSel, Name: "li"},
+		{Kind: ClassSel, Name: "item"},
+		{Kind: AttrSel, Name: "data-x", Operator: PrefixMatch, Value: "y"},
+		{Kind: PseudoClassSel, Name: "not"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	not := Inspect(compound.Children[3])
+	if len(not.Children) != 1 || not.Children[0].String() != ":first-child" {
+		t.Errorf(":not: got children %v", not.Children)
+	}
+
+	if got := Inspect(Inspect(list.Children[1]).Children[0]); got.Kind != TagSel || got.Name != "*" {
+		t.Errorf("svg|*: got %+v", got)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	sel, err := Parse(`div:has(> p.a) span, :is(b, i)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	Walk(sel, func(s Sel) bool {
+		got = append(got, s.String())
+		// Don't look inside :has().
+		return Inspect(s).Name != "has"
+	})
+	want := []string{
+		"div:has(> p.a) span, :is(b, i)",
+		"div:has(> p.a) span",
+		"div:has(> p.a)",
+		"div",
+		":has(> p.a)",
+		"span",
+		"span",
+		":is(b, i)",
+		":is(b, i)",
+		"b, i",
+		"b",
+		"b",
+		"i",
+		"i",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// stripHTMLBody removes a leading "html > body" from sel.
+func stripHTMLBody(sel Sel) Sel {
+	return Rewrite(sel, func(s Sel) Sel {
+		info := Inspect(s)
+		if info.Kind == CombinedSel && info.Children[0].String() == "html > body" {
+			return info.Children[1]
+		}
+		return s
+	})
+}
+
+func TestRewrite(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div class="content"><p id="a"></p></div><p id="b"></p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		sel, want string
+		matches   []string
+	}{
+		{"html > body > div.content p", "div.content p", []string{"a"}},
+		{"html > body > p", "p", []string{"a", "b"}},
+		{"html > body > p, body > div > p:not(html > body > #b)", "p, body > div > p:not(#b)", []string{"a", "b"}},
+		{"body > p", "body > p", []string{"b"}},
+	} {
+		sel, err := Parse(test.sel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := sel.String()
+		rewritten := stripHTMLBody(sel)
+		if got := rewritten.String(); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.sel, got, test.want)
+		}
+		var ids []string
+		for _, n := range CompileSel(rewritten).MatchAll(doc) {
+			ids = append(ids, attributeValue(n, "id"))
+		}
+		if !reflect.DeepEqual(ids, test.matches) {
+			t.Errorf("%s: got matches %q, want %q", test.want, ids, test.matches)
+		}
+		if sel.String() != before {
+			t.Errorf("%s: Rewrite modified its argument", test.sel)
+		}
+	}
+}
+
+func TestInspectPseudoClassArguments(t *testing.T) {
+	for _, test := range []struct {
+		sel, name, value string
+	}{
+		{":first-child", "first-child", ""},
+		{":nth-child(odd)", "nth-child", "2n+1"},
+		{":nth-last-of-type(3)", "nth-last-of-type", "3"},
+		{`:contains("a \"b\"")`, "contains", `a "b"`},
+		{`:containsOwn(x)`, "containsOwn", "x"},
+		{`:class-prefix(col-)`, "class-prefix", "col-"},
+		{":lang(de, fr)", "lang", "de, fr"},
+		{":not(p)", "not", ""},
+	} {
+		sel, err := Parse(test.sel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info := Inspect(Inspect(sel).Children[0])
+		if info.Kind != PseudoClassSel || info.Name != test.name || info.Value != test.value {
+			t.Errorf("%s: got %+v, want name %q and value %q", test.sel, info, test.name, test.value)
+		}
+	}
+}
+
+func TestParseGroupRewrite(t *testing.T) {
+	const list = "html > body > h1, html > body > .title:nth-of-type(2), td:contains(total)"
+	members, err := ParseGroup(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel, err := Parse(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Inspect(sel).Children; !reflect.DeepEqual(got, members) {
+		t.Errorf("Parse's members: got %v, want %v", got, members)
+	}
+
+	// Rewrite each member separately, as a tool that reports on the
+	// members of a list would.
+	var got []string
+	for _, m := range members {
+		got = append(got, stripHTMLBody(m).String())
+	}
+	want := []string{"h1", ".title:nth-of-type(2)", `td:contains("total")`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := Or(members...).String(); got != sel.String() {
+		t.Errorf("Or of the members: got %s, want %s", got, sel)
+	}
+}
+
+func TestRewriteNestedArguments(t *testing.T) {
+	renameP := func(s Sel) Sel {
+		if info := Inspect(s); info.Kind == TagSel && info.Name == "p" {
+			return Tag("span")
+		}
+		return s
+	}
+
+	sel, err := Parse(`li:nth-child(2n of p.x), :nth-last-child(1 of p)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Rewrite(sel, renameP).String(), `li:nth-child(2n of span.x), :nth-last-child(1 of span)`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	nth := Inspect(Inspect(Inspect(sel).Children[0]).Children[1])
+	if nth.Name != "nth-child" || nth.Value != "2n" || len(nth.Children) != 1 || nth.Children[0].String() != "p.x" {
+		t.Errorf("got %+v, want nth-child with value 2n and child p.x", nth)
+	}
+
+	pe, err := ParseWithPseudoElement(`div > p::before`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := Inspect(pe); info.Kind != WithPseudoElementSel || info.Name != "before" || len(info.Children) != 1 {
+		t.Errorf("got %+v, want a pseudo-element selector", info)
+	}
+	if got, want := Rewrite(pe, renameP).String(), `div > span::before`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	scoped, err := CompileScoped(`> p`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Rewrite(scoped.sel, renameP).String(), `> span`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
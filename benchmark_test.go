@@ -51,3 +51,134 @@ func BenchmarkMatchAll(b *testing.B) {
 	}
 	_ = matches
 }
+
+// largeDoc is a page with a <title> near the start followed by a long
+// body, used to show that MatchFirst stops at the first match.
+var largeDoc = MustParseHTML(`<!DOCTYPE html><html><head><title>Large</title></head><body>` +
+	strings.Repeat(`<div class="row"><p>Lorem <a href="#">ipsum</a> dolor</p></div>`, 5000) +
+	`</body></html>`)
+
+var titleSelector = MustCompile(`title`)
+
+func BenchmarkMatchFirst(b *testing.B) {
+	var match *html.Node
+	for i := 0; i < b.N; i++ {
+		match = titleSelector.MatchFirst(largeDoc)
+	}
+	_ = match
+}
+
+func BenchmarkMatchAllFirst(b *testing.B) {
+	var match *html.Node
+	for i := 0; i < b.N; i++ {
+		match = titleSelector.MatchAll(largeDoc)[0]
+	}
+	_ = match
+}
+
+var containsSelector = `:contains("ipsum dolor"):not(:contains("missing"))`
+
+func BenchmarkContains(b *testing.B) {
+	sel := MustCompile(containsSelector)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sel.MatchAll(largeDoc)
+	}
+}
+
+func BenchmarkContainsIndexed(b *testing.B) {
+	sel, err := CompileIndexed(containsSelector)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sel.MatchAll(largeDoc)
+	}
+}
+
+var rowSelector = MustCompile(`div.row`)
+
+func BenchmarkMatchAllLarge(b *testing.B) {
+	b.ReportAllocs()
+	var matches []*html.Node
+	for i := 0; i < b.N; i++ {
+		matches = rowSelector.MatchAll(largeDoc)
+	}
+	_ = matches
+}
+
+// wideTable is a table with thousands of rows, where positional
+// pseudo-classes have many siblings to consider.
+var wideTable = MustParseHTML(`<table>` + strings.Repeat(`<tr><td>x</td></tr>`, 5000) + `</table>`)
+
+func BenchmarkLastChild(b *testing.B) {
+	sel := MustCompile(`tr:last-child`)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sel.MatchAll(wideTable)
+	}
+}
+
+func BenchmarkEachMatchLarge(b *testing.B) {
+	b.ReportAllocs()
+	count := 0
+	for i := 0; i < b.N; i++ {
+		rowSelector.EachMatch(largeDoc, func(*html.Node) bool {
+			count++
+			return true
+		})
+	}
+	_ = count
+}
+
+// chainSelectors are selectors with combinators, most of whose rightmost
+// compound selectors rule out almost every node in largeDoc.
+var chainSelectors = MustCompile(`body div.row > p a[href], div.row p:not(.x) > em, html div span.note`)
+
+func BenchmarkCombinatorChains(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		chainSelectors.MatchAll(largeDoc)
+	}
+}
+
+// manySelectors is a selector list like a scraper's set of rules, most of
+// which don't match in largeDoc.
+var manySelectors = MustCompile(`#header, #footer, nav a, .sidebar li, .ad, div.banner, table.data td, h1.title, h2, .price span,
+	.comment p, article > header, form input[type=text], .pagination a, div.row a[href], ul.menu > li, img.thumb, .author, .date, #main h3`)
+
+func BenchmarkManySelectors(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		manySelectors.MatchAll(largeDoc)
+	}
+}
+
+// ruleset is manySelectors as separate rules, for matching one at a time or
+// with a MatcherSet.
+var ruleset = strings.Split(`#header|#footer|nav a|.sidebar li|.ad|div.banner|table.data td|h1.title|h2|.price span|`+
+	`.comment p|article > header|form input[type=text]|.pagination a|div.row a[href]|ul.menu > li|img.thumb|.author|.date|#main h3`, "|")
+
+func BenchmarkRulesetEach(b *testing.B) {
+	sels := make([]Selector, len(ruleset))
+	for i, r := range ruleset {
+		sels[i] = MustCompile(r)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, s := range sels {
+			s.MatchAll(largeDoc)
+		}
+	}
+}
+
+func BenchmarkRulesetMatcherSet(b *testing.B) {
+	set, err := CompileMatcherSet(ruleset...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		set.MatchAll(largeDoc)
+	}
+}
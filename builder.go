@@ -0,0 +1,147 @@
+package cascadia
+
+// building selectors in Go code, without parsing a string
+
+// An AttrOperator is the operator of an attribute selector, used with Attr.
+type AttrOperator string
+
+// The attribute operators of CSS. Except for Exists, they compare the
+// attribute's value with the value passed to Attr.
+const (
+	Exists         AttrOperator = ""   // [attr]
+	Equals         AttrOperator = "="  // [attr=val]
+	Includes       AttrOperator = "~=" // [attr~=val]: val is one of its space-separated words
+	DashMatch      AttrOperator = "|=" // [attr|=val]: val, or val followed by '-'
+	PrefixMatch    AttrOperator = "^=" // [attr^=val]
+	SuffixMatch    AttrOperator = "$=" // [attr$=val]
+	SubstringMatch AttrOperator = "*=" // [attr*=val]
+)
+
+// A Combinator relates the two parts of a selector built with Combine.
+type Combinator byte
+
+// The combinators of CSS.
+const (
+	DescendantCombinator      Combinator = ' ' // A B
+	ChildCombinator           Combinator = '>' // A > B
+	AdjacentSiblingCombinator Combinator = '+' // A + B
+	GeneralSiblingCombinator  Combinator = '~' // A ~ B
+	ColumnCombinator          Combinator = '|' // A || B
+)
+
+// Tag returns a selector that matches elements with the tag name tag,
+// compared case-insensitively. If tag is "*", it matches any element.
+func Tag(tag string) Sel {
+	if tag == "*" {
+		return compoundSelector(nil)
+	}
+	return compoundSelector{tagSelector{toLowerASCII(tag)}}
+}
+
+// ID returns a selector that matches the element whose id is id, like
+// "#id".
+func ID(id string) Sel {
+	return compoundSelector{idSelector{id: id}}
+}
+
+// Class returns a selector that matches elements with the class class,
+// like ".class".
+func Class(class string) Sel {
+	return compoundSelector{classSelector{class: class}}
+}
+
+// Attr returns a selector that matches elements with an attribute named
+// key whose value satisfies op and val, like "[key^=val]". The name is
+// compared case-insensitively, and the value case-sensitively. With Exists,
+// val is ignored. It panics if op isn't one of the operators above.
+func Attr(key string, op AttrOperator, val string) Sel {
+	switch op {
+	case Exists:
+		val = ""
+	case Equals, Includes, DashMatch, PrefixMatch, SuffixMatch, SubstringMatch:
+	default:
+		panic("cascadia: unknown attribute operator " + string(op))
+	}
+	return compoundSelector{attrSelector{key: toLowerASCII(key), operation: string(op), val: val}}
+}
+
+// And returns a selector that matches the elements that match all of sels,
+// like "div.x[href]". With no arguments, it matches any element.
+func And(sels ...Sel) Sel {
+	var result compoundSelector
+	hasTag := false
+	for _, s := range sels {
+		c, ok := s.(compoundSelector)
+		if !ok {
+			c = compoundSelector{matchesAnySelector{sel: s}}
+		}
+		for _, part := range c {
+			switch part.(type) {
+			case tagSelector, namespaceTagSelector:
+				// CSS only allows one type selector, at the start of a
+				// compound selector.
+				if hasTag {
+					part = matchesAnySelector{sel: compoundSelector{part}}
+				} else {
+					hasTag = true
+					result = append(compoundSelector{part}, result...)
+					continue
+				}
+			}
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// Or returns a selector that matches the elements that match any of sels,
+// like the selector list "h1, h2". It panics if sels is empty.
+func Or(sels ...Sel) Sel {
+	if len(sels) == 0 {
+		panic("cascadia: Or needs at least one selector")
+	}
+	var result unionSelector
+	for _, s := range sels {
+		if u, ok := s.(unionSelector); ok {
+			result = append(result, u...)
+		} else {
+			result = append(result, s)
+		}
+	}
+	if len(result) == 1 {
+		return result[0]
+	}
+	return result
+}
+
+// Not returns a selector that matches the elements that don't match sel,
+// like ":not(sel)".
+func Not(sel Sel) Sel {
+	return compoundSelector{negatedSelector{sel}}
+}
+
+// Combine returns a selector that matches the elements that match second
+// and are related by c to an element that matches first: Combine(a,
+// ChildCombinator, b) is like "a > b".
+func Combine(first Sel, c Combinator, second Sel) Sel {
+	switch c {
+	case DescendantCombinator, ChildCombinator, AdjacentSiblingCombinator, GeneralSiblingCombinator, ColumnCombinator:
+	default:
+		panic("cascadia: unknown combinator " + string(rune(c)))
+	}
+	if _, ok := first.(unionSelector); ok {
+		first = compoundSelector{matchesAnySelector{sel: first}}
+	}
+	if _, ok := second.(compoundSelector); !ok {
+		second = compoundSelector{matchesAnySelector{sel: second}}
+	}
+	return combinedSelector{first: first, combinator: byte(c), second: second}
+}
+
+// CompileSel returns the Selector for sel, which may be built with
+// functions like Tag, And and Combine, or returned by Parse. It matches the
+// same elements as sel.Match, but like Compile, it may rewrite sel into a
+// form that matches faster.
+func CompileSel(sel Sel) Selector {
+	return compileSel(sel)
+}
@@ -0,0 +1,84 @@
+package cascadia
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	for _, test := range []struct {
+		sel  Sel
+		want string
+	}{
+		{Tag("DIV"), `div`},
+		{Tag("*"), `*`},
+		{ID("main"), `#main`},
+		{Class("x y"), `.x\ y`},
+		{Attr("HREF", PrefixMatch, "https://"), `[href^="https://"]`},
+		{Attr("hidden", Exists, "ignored"), `[hidden]`},
+		{Attr("lang", DashMatch, "en"), `[lang|="en"]`},
+		{And(Class("x"), Tag("a"), Attr("href", Exists, "")), `a.x[href]`},
+		{And(Tag("div"), And(Class("x"), ID("y"))), `div.x#y`},
+		{Or(Tag("h1"), Or(Tag("h2"), Tag("h3"))), `h1, h2, h3`},
+		{Or(Tag("p")), `p`},
+		{Not(Or(Class("a"), Class("b"))), `:not(.a, .b)`},
+		{And(Tag("p"), Not(Class("x"))), `p:not(.x)`},
+		{Combine(Tag("ul"), ChildCombinator, Tag("li")), `ul > li`},
+		{Combine(Combine(Tag("div"), DescendantCombinator, Tag("h1")), AdjacentSiblingCombinator, Tag("p")), `div h1 + p`},
+		{Combine(Tag("h1"), GeneralSiblingCombinator, And(Tag("p"), Class("x"))), `h1 ~ p.x`},
+	} {
+		if got := test.sel.String(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+			continue
+		}
+		parsed, err := Parse(test.want)
+		if err != nil {
+			t.Errorf("%s: %s", test.want, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.sel, parsed) {
+			t.Errorf("%s: built %#v, parsed %#v", test.want, test.sel, parsed)
+		}
+	}
+}
+
+// TestBuilderNesting checks selectors that can't be written in CSS without
+// :is(), and that they match the same elements as the :is() forms.
+func TestBuilderNesting(t *testing.T) {
+	for _, test := range []struct {
+		sel  Sel
+		want string
+	}{
+		{And(Tag("div"), Tag("p")), `div:is(p)`},
+		{And(Combine(Tag("body"), ChildCombinator, Tag("div")), Class("matched")), `:is(body > div).matched`},
+		{Combine(Or(Tag("body"), Tag("span")), ChildCombinator, Tag("div")), `:is(body, span) > div`},
+		{Combine(Tag("body"), DescendantCombinator, Or(Tag("div"), Tag("p"))), `body :is(div, p)`},
+	} {
+		if got := test.sel.String(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+			continue
+		}
+		got := CompileSel(test.sel).MatchAll(dom)
+		if want := MustCompile(test.want).MatchAll(dom); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: built selector matched %d nodes, parsed one %d", test.want, len(got), len(want))
+		}
+	}
+}
+
+func TestBuilderPanics(t *testing.T) {
+	for name, f := range map[string]func(){
+		"Or()":         func() { Or() },
+		"combinator x": func() { Combine(Tag("a"), 'x', Tag("b")) },
+		"operator !=":  func() { Attr("a", "!=", "b") },
+		"operator #=":  func() { Attr("a", "#=", "b") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: no panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
@@ -0,0 +1,125 @@
+package cascadia
+
+import (
+	"strconv"
+	"sync"
+)
+
+// A Cache holds compiled selectors, so that a program that uses the same
+// selector strings over and over only needs to parse each of them once.
+// It is safe for concurrent use by multiple goroutines.
+//
+// The zero value is an empty cache with no size limit.
+type Cache struct {
+	mu    sync.RWMutex
+	max   int
+	cache map[string]*cacheEntry
+}
+
+// A cacheEntry is a compiled selector in a Cache.
+type cacheEntry struct {
+	m   Sel
+	sel Selector
+
+	// observed is built the first time the selector is asked for with
+	// GetObserved.
+	observedOnce sync.Once
+	observed     *ObservedSelector
+}
+
+// NewCache returns a Cache that holds at most max selectors. When it is
+// full, adding another selector evicts an arbitrary one. If max is zero or
+// less, the cache is unbounded.
+func NewCache(max int) *Cache {
+	return &Cache{max: max}
+}
+
+// Get returns the compiled form of sel, compiling and saving it if it isn't
+// already in the cache. Selectors that fail to compile are not saved.
+func (c *Cache) Get(sel string) (Selector, error) {
+	entry, err := c.get(sel)
+	if err != nil {
+		return nil, err
+	}
+	return entry.sel, nil
+}
+
+// GetObserved is like Get, but it returns an ObservedSelector that reports
+// its queries to observer. The selector is compiled only once, whichever
+// observers it is used with.
+func (c *Cache) GetObserved(sel string, observer QueryObserver) (*ObservedSelector, error) {
+	entry, err := c.get(sel)
+	if err != nil {
+		return nil, err
+	}
+	entry.observedOnce.Do(func() {
+		entry.observed = newObservedSelector(entry.m, entry.sel)
+		// The canonical form is computed now, so that GetObserved doesn't
+		// compute it on every call.
+		entry.observed.source = entry.m.String()
+	})
+	observed := *entry.observed
+	if observer != nil {
+		observed.observe(observer)
+	}
+	return &observed, nil
+}
+
+// get returns the cache entry for sel, compiling it if it isn't already in
+// the cache.
+func (c *Cache) get(sel string) (*cacheEntry, error) {
+	c.mu.RLock()
+	entry, ok := c.cache[sel]
+	c.mu.RUnlock()
+	if ok {
+		return entry, nil
+	}
+
+	p := &parser{s: sel}
+	m, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	entry = &cacheEntry{m: m, sel: compileSel(m)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, ok := c.cache[sel]; ok {
+		// Another goroutine compiled it in the meantime.
+		return existing, nil
+	}
+	if c.cache == nil {
+		c.cache = make(map[string]*cacheEntry)
+	}
+	if c.max > 0 && len(c.cache) >= c.max {
+		for k := range c.cache {
+			delete(c.cache, k)
+			break
+		}
+	}
+	c.cache[sel] = entry
+	return entry, nil
+}
+
+// MustGet is like Get, but panics instead of returning an error.
+func (c *Cache) MustGet(sel string) Selector {
+	compiled, err := c.Get(sel)
+	if err != nil {
+		panic(`cascadia: Compile(` + strconv.Quote(sel) + `): ` + err.Error())
+	}
+	return compiled
+}
+
+// Len returns the number of selectors in the cache.
+func (c *Cache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.cache)
+}
+
+// Clear removes all the selectors from the cache.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	c.cache = nil
+	c.mu.Unlock()
+}
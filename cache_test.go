@@ -0,0 +1,57 @@
+package cascadia
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestCache(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p class="a"></p><p></p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c Cache
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if got := len(c.MustGet("p.a").MatchAll(doc)); got != 1 {
+					t.Errorf("got %d matches, want 1", got)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got := c.Len(); got != 1 {
+		t.Errorf("Len: got %d, want 1", got)
+	}
+
+	if _, err := c.Get("p["); err == nil {
+		t.Error("Get(\"p[\"): got no error")
+	}
+	if got := c.Len(); got != 1 {
+		t.Errorf("Len after invalid selector: got %d, want 1", got)
+	}
+
+	c.Clear()
+	if got := c.Len(); got != 0 {
+		t.Errorf("Len after Clear: got %d, want 0", got)
+	}
+}
+
+func TestCacheBounded(t *testing.T) {
+	c := NewCache(3)
+	for i := 0; i < 10; i++ {
+		c.MustGet(fmt.Sprintf("h%d", i))
+		if got, max := c.Len(), 3; got > max {
+			t.Fatalf("Len: got %d, want at most %d", got, max)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package cascadiatest provides the conformance corpus that the cascadia
+// package is tested against, and a runner that tests any selector engine
+// against it. Programs that extend cascadia, or implement CSS selectors some
+// other way, can use it to check that they still handle the selectors that
+// cascadia does, the way that cascadia does.
+//
+// The corpus identifies the expected matches by their structural paths (see
+// Path), so the runner doesn't depend on the engine returning particular
+// *html.Node pointers. It does depend on the engine using
+// golang.org/x/net/html to parse the fixtures.
+package cascadiatest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// A Case is a conformance test case: an HTML fixture, a selector, and the
+// elements the selector is expected to match in the fixture.
+type Case struct {
+	HTML     string
+	Selector string
+
+	// Want lists the paths of the matching elements, in document order.
+	Want []string
+}
+
+// An Engine compiles and runs selectors.
+type Engine interface {
+	// MatchAll returns the nodes that match sel in the tree rooted at
+	// root, in document order, or an error if sel can't be compiled.
+	MatchAll(sel string, root *html.Node) ([]*html.Node, error)
+}
+
+// EngineFunc adapts a function to the Engine interface.
+type EngineFunc func(sel string, root *html.Node) ([]*html.Node, error)
+
+// MatchAll calls f(sel, root).
+func (f EngineFunc) MatchAll(sel string, root *html.Node) ([]*html.Node, error) {
+	return f(sel, root)
+}
+
+// A Failure describes a Case that an engine failed.
+type Failure struct {
+	Case Case
+
+	// Err is the error returned by the engine, or the error parsing the
+	// fixture. If it is not nil, Got is empty.
+	Err error
+
+	// Got lists the paths of the nodes the engine returned.
+	Got []string
+}
+
+func (f Failure) String() string {
+	if f.Err != nil {
+		return fmt.Sprintf("%q on %q: %v", f.Case.Selector, f.Case.HTML, f.Err)
+	}
+	return fmt.Sprintf("%q on %q: got %q, want %q", f.Case.Selector, f.Case.HTML, f.Got, f.Case.Want)
+}
+
+// Run runs each of the cases with e, and returns the ones it fails. A case
+// fails if the engine returns an error, or doesn't return exactly the
+// expected nodes in the expected order.
+func Run(e Engine, cases []Case) []Failure {
+	var failures []Failure
+	for _, c := range cases {
+		doc, err := html.Parse(strings.NewReader(c.HTML))
+		if err != nil {
+			failures = append(failures, Failure{Case: c, Err: err})
+			continue
+		}
+
+		nodes, err := e.MatchAll(c.Selector, doc)
+		if err != nil {
+			failures = append(failures, Failure{Case: c, Err: err})
+			continue
+		}
+
+		got := make([]string, len(nodes))
+		for i, n := range nodes {
+			got[i] = Path(n)
+		}
+		if !equal(got, c.Want) {
+			failures = append(failures, Failure{Case: c, Got: got})
+		}
+	}
+	return failures
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Cases returns a copy of the conformance corpus.
+func Cases() []Case {
+	result := make([]Case, len(corpus))
+	copy(result, corpus)
+	return result
+}
+
+// Path returns the structural path of n from the root of its tree, like
+// "html[1]/body[1]/div[2]", where the numbers are 1-based positions among
+// siblings with the same tag name. Nodes that aren't elements are shown as
+// "#text", "#comment" and so on, with their positions among all of their
+// siblings. The document node itself has the empty path.
+func Path(n *html.Node) string {
+	var parts []string
+	for ; n != nil && n.Type != html.DocumentNode; n = n.Parent {
+		name, pos := n.Data, 0
+		if n.Type != html.ElementNode {
+			name = "#" + nodeTypeName(n.Type)
+		}
+		for c := n; c != nil; c = c.PrevSibling {
+			if c == n || n.Type != html.ElementNode || c.Type == html.ElementNode && c.Data == n.Data {
+				pos++
+			}
+		}
+		parts = append(parts, name+"["+strconv.Itoa(pos)+"]")
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, "/")
+}
+
+func nodeTypeName(t html.NodeType) string {
+	switch t {
+	case html.TextNode:
+		return "text"
+	case html.CommentNode:
+		return "comment"
+	case html.DoctypeNode:
+		return "doctype"
+	}
+	return "node"
+}
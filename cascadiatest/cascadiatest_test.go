@@ -0,0 +1,75 @@
+package cascadiatest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestPath(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p>a</p><div>b<p>c</p><!--d--><p>e</p></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		got = append(got, Path(n))
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	want := []string{
+		"",
+		"html[1]",
+		"html[1]/head[1]",
+		"html[1]/body[1]",
+		"html[1]/body[1]/p[1]",
+		"html[1]/body[1]/p[1]/#text[1]",
+		"html[1]/body[1]/div[1]",
+		"html[1]/body[1]/div[1]/#text[1]",
+		"html[1]/body[1]/div[1]/p[1]",
+		"html[1]/body[1]/div[1]/p[1]/#text[1]",
+		"html[1]/body[1]/div[1]/#comment[3]",
+		"html[1]/body[1]/div[1]/p[2]",
+		"html[1]/body[1]/div[1]/p[2]/#text[1]",
+	}
+	if !equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	cases := []Case{
+		{`<p></p><p></p>`, `p`, []string{"html[1]/body[1]/p[1]", "html[1]/body[1]/p[2]"}},
+		{`<p></p><p></p>`, `p:last-child`, []string{"html[1]/body[1]/p[2]"}},
+		{`<p></p>`, `p:bogus`, nil},
+	}
+
+	// firstP matches the first p element for any selector but p:bogus.
+	firstP := EngineFunc(func(sel string, root *html.Node) ([]*html.Node, error) {
+		if sel == "p:bogus" {
+			return nil, errors.New("unknown pseudoclass")
+		}
+		return []*html.Node{root.FirstChild.LastChild.FirstChild}, nil
+	})
+
+	failures := Run(firstP, cases)
+	if len(failures) != 3 {
+		t.Fatalf("got %d failures, want 3: %v", len(failures), failures)
+	}
+	if got := failures[0].Got; !equal(got, []string{"html[1]/body[1]/p[1]"}) {
+		t.Errorf("failure 0: got %q", got)
+	}
+	if failures[1].Err != nil || failures[1].Case.Selector != "p:last-child" {
+		t.Errorf("failure 1: %v", failures[1])
+	}
+	if failures[2].Err == nil || !strings.Contains(failures[2].String(), "unknown pseudoclass") {
+		t.Errorf("failure 2: %v", failures[2])
+	}
+}
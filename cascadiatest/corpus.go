@@ -0,0 +1,1173 @@
+package cascadiatest
+
+// corpus holds the conformance cases. The cascadia package's own tests run
+// it, so it must only contain cases that cascadia passes.
+var corpus = []Case{
+	{
+		`<body><address>This address...</address></body>`,
+		`address`,
+		[]string{
+			"html[1]/body[1]/address[1]",
+		},
+	},
+	{
+		`<html><head></head><body></body></html>`,
+		`*`,
+		[]string{
+			"",
+			"html[1]",
+			"html[1]/head[1]",
+			"html[1]/body[1]",
+		},
+	},
+	{
+		`<p id="foo"><p id="bar">`,
+		`#foo`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<ul><li id="t1"><p id="t1">`,
+		`li#t1`,
+		[]string{
+			"html[1]/body[1]/ul[1]/li[1]",
+		},
+	},
+	{
+		`<ol><li id="t4"><li id="t44">`,
+		`*#t4`,
+		[]string{
+			"html[1]/body[1]/ol[1]/li[1]",
+		},
+	},
+	{
+		`<ul><li class="t1"><li class="t2">`,
+		`.t1`,
+		[]string{
+			"html[1]/body[1]/ul[1]/li[1]",
+		},
+	},
+	{
+		`<p class="t1 t2">`,
+		`p.t1`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<div class="test">`,
+		`div.teST`,
+		[]string{},
+	},
+	{
+		`<p class="t1 t2">`,
+		`.t1.fail`,
+		[]string{},
+	},
+	{
+		`<p class="t1 t2">`,
+		`p.t1.t2`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<p><p title="title">`,
+		`p[title]`,
+		[]string{
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<address><address title="foo"><address title="bar">`,
+		`address[title="foo"]`,
+		[]string{
+			"html[1]/body[1]/address[1]/address[1]",
+		},
+	},
+	{
+		`<p title="tot foo bar">`,
+		`[    	title        ~=       foo    ]`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<p title="hello world">`,
+		`[title~="hello world"]`,
+		[]string{},
+	},
+	{
+		`<p lang="en"><p lang="en-gb"><p lang="enough"><p lang="fr-en">`,
+		`[lang|="en"]`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<p title="foobar"><p title="barfoo">`,
+		`[title^="foo"]`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<p title="foobar"><p title="barfoo">`,
+		`[title$="bar"]`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<p title="foobarufoo">`,
+		`[title*="bar"]`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<p class="ACTIVE"><p class="btn Active"><p class="inactive"><p class="active-x">`,
+		`[class~=active i]`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<p class="ACTIVE"><p class="btn Active"><p class="active">`,
+		`[class~="Active"]`,
+		[]string{
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<p title="Foo"><p title="foo"><p title="FOO bar">`,
+		`[title=foo], [title^=fo][title$=bar]`,
+		[]string{
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<p title="Foo"><p title="foo"><p title="FOO bar">`,
+		`[title=foo i], [title^=fo i][title$=BAR I]`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[2]",
+			"html[1]/body[1]/p[3]",
+		},
+	},
+	{
+		`<a href="file.pdf"><a href="FILE.PDF"><a href="file.pdf.html">`,
+		`[href$=".PDF" i]`,
+		[]string{
+			"html[1]/body[1]/a[1]",
+			"html[1]/body[1]/a[2]",
+		},
+	},
+	{
+		`<a href="file.pdf"><a href="FILE.PDF"><a href="file.pdf.html">`,
+		`[href$=".PDF" s]`,
+		[]string{
+			"html[1]/body[1]/a[2]",
+		},
+	},
+	{
+		`<p lang="EN-us"><p lang="En"><p lang="english"><p title="ENGLISH" class="a B">`,
+		`[lang|=en i], [lang^=EN i][lang*=G i], [title*=LIS i][title$=sh i]`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[2]",
+			"html[1]/body[1]/p[3]",
+			"html[1]/body[1]/p[4]",
+		},
+	},
+	{
+		`<p class="a B"><p class="b">`,
+		`[class~=b S]`,
+		[]string{
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<input type="SUBMIT"><input type="Submit"><input type="text">`,
+		`[type="submit" I]`,
+		[]string{
+			"html[1]/body[1]/input[1]",
+			"html[1]/body[1]/input[2]",
+		},
+	},
+	{
+		`<input type="text"><input type="submit"><input>`,
+		`input:not([type=submit])`,
+		[]string{
+			"html[1]/body[1]/input[1]",
+			"html[1]/body[1]/input[3]",
+		},
+	},
+	{
+		`<ul><li class="active"></li><li></li></ul><p>`,
+		`:not(p):not(html):not(head):not(body)`,
+		[]string{
+			"html[1]/body[1]/ul[1]",
+			"html[1]/body[1]/ul[1]/li[1]",
+			"html[1]/body[1]/ul[1]/li[2]",
+		},
+	},
+	{
+		`<div class="a"><p><span></span></p></div>`,
+		`:not(:has(span))`,
+		[]string{
+			"html[1]/head[1]",
+			"html[1]/body[1]/div[1]/p[1]/span[1]",
+		},
+	},
+	{
+		`<p class="t1 t2">`,
+		`.t1:not(.t2)`,
+		[]string{},
+	},
+	{
+		`<div class="t3">`,
+		`div:not(.t1)`,
+		[]string{
+			"html[1]/body[1]/div[1]",
+		},
+	},
+	{
+		`<ol><li id=1><li id=2><li id=3></ol>`,
+		`li:nth-child(odd)`,
+		[]string{
+			"html[1]/body[1]/ol[1]/li[1]",
+			"html[1]/body[1]/ol[1]/li[3]",
+		},
+	},
+	{
+		`<ol><li id=1><li id=2><li id=3></ol>`,
+		`li:nth-child(even)`,
+		[]string{
+			"html[1]/body[1]/ol[1]/li[2]",
+		},
+	},
+	{
+		`<ol><li id=1><li id=2><li id=3></ol>`,
+		`li:nth-child(-n+2)`,
+		[]string{
+			"html[1]/body[1]/ol[1]/li[1]",
+			"html[1]/body[1]/ol[1]/li[2]",
+		},
+	},
+	{
+		`<ol><li id=1><li id=2><li id=3></ol>`,
+		`li:nth-child(3n+1)`,
+		[]string{
+			"html[1]/body[1]/ol[1]/li[1]",
+		},
+	},
+	{
+		`<ol><li id=1><li id=2><li id=3><li id=4></ol>`,
+		`li:nth-last-child(odd)`,
+		[]string{
+			"html[1]/body[1]/ol[1]/li[2]",
+			"html[1]/body[1]/ol[1]/li[4]",
+		},
+	},
+	{
+		`<ol><li id=1><li id=2><li id=3><li id=4></ol>`,
+		`li:nth-last-child(even)`,
+		[]string{
+			"html[1]/body[1]/ol[1]/li[1]",
+			"html[1]/body[1]/ol[1]/li[3]",
+		},
+	},
+	{
+		`<ol><li id=1><li id=2><li id=3><li id=4></ol>`,
+		`li:nth-last-child(-n+2)`,
+		[]string{
+			"html[1]/body[1]/ol[1]/li[3]",
+			"html[1]/body[1]/ol[1]/li[4]",
+		},
+	},
+	{
+		`<ol><li id=1><li id=2><li id=3><li id=4></ol>`,
+		`li:nth-last-child(3n+1)`,
+		[]string{
+			"html[1]/body[1]/ol[1]/li[1]",
+			"html[1]/body[1]/ol[1]/li[4]",
+		},
+	},
+	{
+		`<p>some text <span id="1">and a span</span><span id="2"> and another</span></p>`,
+		`span:first-child`,
+		[]string{
+			"html[1]/body[1]/p[1]/span[1]",
+		},
+	},
+	{
+		`<span>a span</span> and some text`,
+		`span:last-child`,
+		[]string{
+			"html[1]/body[1]/span[1]",
+		},
+	},
+	{
+		`<address></address><p id=1><p id=2>`,
+		`p:nth-of-type(2)`,
+		[]string{
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<address></address><p id=1><p id=2></p><a>`,
+		`p:nth-last-of-type(2)`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<address></address><p id=1><p id=2></p><a>`,
+		`p:last-of-type`,
+		[]string{
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<address></address><p id=1><p id=2></p><a>`,
+		`p:first-of-type`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<div><span></span><p id="1"></p><p id="2"></p><em></em></div>`,
+		`div > :first-of-type`,
+		[]string{
+			"html[1]/body[1]/div[1]/span[1]",
+			"html[1]/body[1]/div[1]/p[1]",
+			"html[1]/body[1]/div[1]/em[1]",
+		},
+	},
+	{
+		`<div><span></span><p id="1"></p><p id="2"></p><em></em></div>`,
+		`p:first-child, p:last-child`,
+		[]string{},
+	},
+	{
+		`<div><span></span><p id="1"></p><p id="2"></p><em></em></div>`,
+		`div > :last-of-type`,
+		[]string{
+			"html[1]/body[1]/div[1]/span[1]",
+			"html[1]/body[1]/div[1]/p[2]",
+			"html[1]/body[1]/div[1]/em[1]",
+		},
+	},
+	{
+		`<div><p id="1"></p><a></a></div><div><p id="2"></p></div>`,
+		`p:only-child`,
+		[]string{
+			"html[1]/body[1]/div[2]/p[1]",
+		},
+	},
+	{
+		`<div><p id="1"></p><a></a></div><div><p id="2"></p><p id="3"></p></div>`,
+		`p:only-of-type`,
+		[]string{
+			"html[1]/body[1]/div[1]/p[1]",
+		},
+	},
+	{
+		`<p id="1"><!-- --><p id="2">Hello<p id="3"><span>`,
+		`:empty`,
+		[]string{
+			"html[1]/head[1]",
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[3]/span[1]",
+		},
+	},
+	{
+		`<table><tr><td id="1"></td><td id="2"> </td><td id="3"><!-- c --></td><td id="4"><b></b></td></tr></table>`,
+		`td:empty`,
+		[]string{
+			"html[1]/body[1]/table[1]/tbody[1]/tr[1]/td[1]",
+			"html[1]/body[1]/table[1]/tbody[1]/tr[1]/td[3]",
+		},
+	},
+	{
+		`<html><head></head><body><div><html></html></div></body></html>`,
+		`html:root > body, :root:not(html)`,
+		[]string{
+			"html[1]/body[1]",
+		},
+	},
+	{
+		`<div><p id="1"><table><tr><td><p id="2"></table></div><p id="3">`,
+		`div p`,
+		[]string{
+			"html[1]/body[1]/div[1]/p[1]",
+			"html[1]/body[1]/div[1]/p[1]/table[1]/tbody[1]/tr[1]/td[1]/p[1]",
+		},
+	},
+	{
+		`<div><p id="1"><table><tr><td><p id="2"></table></div><p id="3">`,
+		`div table p`,
+		[]string{
+			"html[1]/body[1]/div[1]/p[1]/table[1]/tbody[1]/tr[1]/td[1]/p[1]",
+		},
+	},
+	{
+		`<div><p id="1"><div><p id="2"></div><table><tr><td><p id="3"></table></div>`,
+		`div > p`,
+		[]string{
+			"html[1]/body[1]/div[1]/p[1]",
+			"html[1]/body[1]/div[1]/div[1]/p[1]",
+		},
+	},
+	{
+		`<p id="1"><p id="2"></p><address></address><p id="3">`,
+		`p ~ p`,
+		[]string{
+			"html[1]/body[1]/p[2]",
+			"html[1]/body[1]/p[3]",
+		},
+	},
+	{
+		`<p id="1"></p>
+		 <!--comment-->
+		 <p id="2"></p><address></address><p id="3">`,
+		`p + p`,
+		[]string{
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<div>text<p id="1"></p><!--comment--><p id="2"></p></div>`,
+		`* + p`,
+		[]string{
+			"html[1]/body[1]/div[1]/p[2]",
+		},
+	},
+	{
+		`<div>text<!--comment--><p id="1"></p>more text<p id="2"></p></div>`,
+		`* ~ p`,
+		[]string{
+			"html[1]/body[1]/div[1]/p[2]",
+		},
+	},
+	{
+		`<h1>Title</h1>
+		 <!--comment-->
+		 <p id="1"></p><div></div><p id="2"></p>`,
+		`h1 ~ p`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<ul><li></li><li></li></ul><p>`,
+		`li, p`,
+		[]string{
+			"html[1]/body[1]/ul[1]/li[1]",
+			"html[1]/body[1]/ul[1]/li[2]",
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<h1 class="title"></h1><h2></h2><p class="title"><h3>`,
+		`h1 , h2,h3 ,	.title`,
+		[]string{
+			"html[1]/body[1]/h1[1]",
+			"html[1]/body[1]/h2[1]",
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/h3[1]",
+		},
+	},
+	{
+		`<a href="/1"></a><map><area href="/2"><area></map><a>`,
+		`a[href], area[href]`,
+		[]string{
+			"html[1]/body[1]/a[1]",
+			"html[1]/body[1]/map[1]/area[1]",
+		},
+	},
+	{
+		`<p id="1"><p id="2"></p><address></address><p id="3">`,
+		`p +/*This is a comment*/ p`,
+		[]string{
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<p>Text block that <span>wraps inner text</span> and continues</p>`,
+		`p:contains("that wraps")`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<p>Text block that <span>wraps inner text</span> and continues</p>`,
+		`p:containsOwn("that wraps")`,
+		[]string{},
+	},
+	{
+		`<p>Text block that <span>wraps inner text</span> and continues</p>`,
+		`:containsOwn("inner")`,
+		[]string{
+			"html[1]/body[1]/p[1]/span[1]",
+		},
+	},
+	{
+		`<p>Text block that <span>wraps inner text</span> and continues</p>`,
+		`p:containsOwn("block")`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<p id="1">foo<b>BAR</b>baz</p><p id="2">Say "Hello"</p><p id="3">Say hello</p>`,
+		`p:contains("obarb"), p:contains('say "hello"'), p:contains("SAY \"HELLO\"")`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<p id="1">foo<b>bar</b>baz</p><p id="2">bar</p>`,
+		`:containsOwn(bar)`,
+		[]string{
+			"html[1]/body[1]/p[1]/b[1]",
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<p id="1">foo<b>bar</b>baz</p><p id="2">Out of <i>stock</i></p><p id="3">Out of stock</p>`,
+		`p:contains-own("out of stock"), b:contains-own('BAR')`,
+		[]string{
+			"html[1]/body[1]/p[1]/b[1]",
+			"html[1]/body[1]/p[3]",
+		},
+	},
+	{
+		`<p id="1">It's "here"</p><p id="2">It's here</p>`,
+		`p:contains('it\'s "here"')`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<p id="1">one <!-- two --> three</p><p id="2">one two three</p>`,
+		`p:contains("one  three")`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<div id="d1"><p id="p1"><span>text content</span></p></div><div id="d2"/>`,
+		`div:has(#p1)`,
+		[]string{
+			"html[1]/body[1]/div[1]",
+		},
+	},
+	{
+		`<div id="d1"><p id="p1"><span>contents 1</span></p></div>
+		<div id="d2"><p>contents <em>2</em></p></div>`,
+		`div:has(:containsOwn("2"))`,
+		[]string{
+			"html[1]/body[1]/div[2]",
+		},
+	},
+	{
+		`<body><div id="d1"><p id="p1"><span>contents 1</span></p></div>
+		<div id="d2"><p id="p2">contents <em>2</em></p></div></body>`,
+		`body :has(:containsOwn("2"))`,
+		[]string{
+			"html[1]/body[1]/div[2]",
+			"html[1]/body[1]/div[2]/p[1]",
+		},
+	},
+	{
+		`<body><div id="d1"><p id="p1"><span>contents 1</span></p></div>
+		<div id="d2"><p id="p2">contents <em>2</em></p></div></body>`,
+		`body :haschild(:containsOwn("2"))`,
+		[]string{
+			"html[1]/body[1]/div[2]/p[1]",
+		},
+	},
+	{
+		`<p id="p1">0123456789</p><p id="p2">abcdef</p><p id="p3">0123ABCD</p>`,
+		`p:matches([\d])`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[3]",
+		},
+	},
+	{
+		`<p id="p1">0123456789</p><p id="p2">abcdef</p><p id="p3">0123ABCD</p>`,
+		`p:matches([a-z])`,
+		[]string{
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<p id="p1">0123456789</p><p id="p2">abcdef</p><p id="p3">0123ABCD</p>`,
+		`p:matches([a-zA-Z])`,
+		[]string{
+			"html[1]/body[1]/p[2]",
+			"html[1]/body[1]/p[3]",
+		},
+	},
+	{
+		`<p id="p1">0123456789</p><p id="p2">abcdef</p><p id="p3">0123ABCD</p>`,
+		`p:matches([^\d])`,
+		[]string{
+			"html[1]/body[1]/p[2]",
+			"html[1]/body[1]/p[3]",
+		},
+	},
+	{
+		`<p id="p1">0123456789</p><p id="p2">abcdef</p><p id="p3">0123ABCD</p>`,
+		`p:matches(^(0|a))`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[2]",
+			"html[1]/body[1]/p[3]",
+		},
+	},
+	{
+		`<p id="p1">0123456789</p><p id="p2">abcdef</p><p id="p3">0123ABCD</p>`,
+		`p:matches(^\d+$)`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<p id="p1">0123456789</p><p id="p2">abcdef</p><p id="p3">0123ABCD</p>`,
+		`p:not(:matches(^\d+$))`,
+		[]string{
+			"html[1]/body[1]/p[2]",
+			"html[1]/body[1]/p[3]",
+		},
+	},
+	{
+		`<div><p id="p1">01234<em>567</em>89</p><div>`,
+		`div :matchesOwn(^\d+$)`,
+		[]string{
+			"html[1]/body[1]/div[1]/p[1]",
+			"html[1]/body[1]/div[1]/p[1]/em[1]",
+		},
+	},
+	{
+		`<ul>
+			<li><a id="a1" href="http://www.google.com/finance"/>
+			<li><a id="a2" href="http://finance.yahoo.com/"/>
+			<li><a id="a2" href="http://finance.untrusted.com/"/>
+			<li><a id="a3" href="https://www.google.com/news"/>
+			<li><a id="a4" href="http://news.yahoo.com"/>
+		</ul>`,
+		`[href#=(fina)]:not([href#=(\/\/[^\/]+untrusted)])`,
+		[]string{
+			"html[1]/body[1]/ul[1]/li[1]/a[1]",
+			"html[1]/body[1]/ul[1]/li[2]/a[1]",
+		},
+	},
+	{
+		`<ul>
+			<li><a id="a1" href="http://www.google.com/finance"/>
+			<li><a id="a2" href="http://finance.yahoo.com/"/>
+			<li><a id="a3" href="https://www.google.com/news"/>
+			<li><a id="a4" href="http://news.yahoo.com"/>
+		</ul>`,
+		`[href#=(^https:\/\/[^\/]*\/?news)]`,
+		[]string{
+			"html[1]/body[1]/ul[1]/li[3]/a[1]",
+		},
+	},
+	{
+		`<p id="foo:bar"></p><p class="col.12"></p><p class="col 12"></p><p title="hello world"></p><p data-value='a"b'></p>`,
+		`#foo\:bar, .col\.12, [title="hello world"], [data-value="a\"b"]`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[2]",
+			"html[1]/body[1]/p[4]",
+			"html[1]/body[1]/p[5]",
+		},
+	},
+	{
+		`<div class="md:flex w-1/2" id="1"></div><div class="md flex" id="2"></div><div class="w-1" id="3"></div>`,
+		`.md\:flex, .w-1\/2`,
+		[]string{
+			"html[1]/body[1]/div[1]",
+		},
+	},
+	{
+		`<p class="123"></p><p class="1 23"></p>`,
+		`.\31 23`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<div id="1"><a href="https://example.com/"></a></div><div id="2"><a href="http://example.com/"></a></div>`,
+		`div:has(a[href^="https://"])`,
+		[]string{
+			"html[1]/body[1]/div[1]",
+		},
+	},
+	{
+		`<table><tr id="1"><td class="ok"></td><td class="error"></td></tr><tr id="2"><td class="ok"></td></tr></table>`,
+		`tr:has(td.error)`,
+		[]string{
+			"html[1]/body[1]/table[1]/tbody[1]/tr[1]",
+		},
+	},
+	{
+		`<div id="1"><ul><li></li></ul></div><div id="2"><ol><li></li></ol></div>`,
+		`div:has(ul > li)`,
+		[]string{
+			"html[1]/body[1]/div[1]",
+		},
+	},
+	{
+		`<section id="1"><div><p><b></b></p></div></section><section id="2"><div><p></p></div></section>`,
+		`section:has(div:has(b))`,
+		[]string{
+			"html[1]/body[1]/section[1]",
+		},
+	},
+	{
+		`<div class="active" id="1"></div><div id="2"></div><ul><li id="3"></li><li id="4"></li></ul><input id="5" disabled><input id="6">`,
+		`div:not(.active), li:not(:first-child), input:not([disabled])`,
+		[]string{
+			"html[1]/body[1]/div[2]",
+			"html[1]/body[1]/ul[1]/li[2]",
+			"html[1]/body[1]/input[2]",
+		},
+	},
+	{
+		`<div class="sidebar" id="s"><div id="1"><div id="2"></div></div></div>
+		<div id="main"><div id="3"></div></div>`,
+		`div:not(.sidebar *)`,
+		[]string{
+			"html[1]/body[1]/div[1]",
+			"html[1]/body[1]/div[2]",
+			"html[1]/body[1]/div[2]/div[1]",
+		},
+	},
+	{
+		`<div class="a"><p class="b" id="1"></p><span><p class="b" id="2"></p></span></div><p class="b" id="3"></p>`,
+		`p:not(.a > .b)`,
+		[]string{
+			"html[1]/body[1]/div[1]/span[1]/p[1]",
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<h1></h1><p id="1"></p><p id="2"></p><h2></h2><p id="3"></p>`,
+		`p:not(h1 + p)`,
+		[]string{
+			"html[1]/body[1]/p[2]",
+			"html[1]/body[1]/p[3]",
+		},
+	},
+	{
+		`<a id="a1" href="https://example.com/a"></a>
+		<a id="a2" href="http://example.com/b"></a>
+		<a id="a3" href="https://example.org/c"></a>
+		<a id="a4" href="https://www.example.com/d"></a>`,
+		`a[href#=(^https?://example\.com/)]`,
+		[]string{
+			"html[1]/body[1]/a[1]",
+			"html[1]/body[1]/a[2]",
+		},
+	},
+	{
+		`<a id="a1" href="https://example.com/a"></a>
+		<a id="a2" href="http://example.com/b"></a>
+		<a id="a3" href="https://example.org/c"></a>
+		<a id="a4" href="https://www.example.com/d"></a>`,
+		`a[href#=(example\.com)]`,
+		[]string{
+			"html[1]/body[1]/a[1]",
+			"html[1]/body[1]/a[2]",
+			"html[1]/body[1]/a[4]",
+		},
+	},
+	{
+		`<p title="a]b"></p><p title="a b=c"></p><p title="ab"></p>`,
+		`p[title#="^a[] =]"]`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<p title="a)b"></p><p title="ab"></p>`,
+		`p[title#='\\)']`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+		},
+	},
+	{
+		`<div class="col-6"><div class="row protocol-x"><div class="js-toggle
+		 col-md-4"><div class="xcol-1">`,
+		`:class-prefix(col-)`,
+		[]string{
+			"html[1]/body[1]/div[1]",
+			"html[1]/body[1]/div[1]/div[1]/div[1]",
+		},
+	},
+	{
+		`<a class="btn btn--active"><a class="btn--active-x"><a class="nav--active">`,
+		`a:class-suffix("--active")`,
+		[]string{
+			"html[1]/body[1]/a[1]",
+			"html[1]/body[1]/a[3]",
+		},
+	},
+	{
+		`<html><head></head><body><div><p></p></div></body></html>`,
+		`:scope > body, :scope div`,
+		[]string{
+			"html[1]/body[1]",
+			"html[1]/body[1]/div[1]",
+		},
+	},
+	{
+		`<form>
+			<label>Username <input type="text" name="username" /></label>
+			<label>Password <input type="password" name="password" /></label>
+			<label>Country
+				<select name="country">
+					<option value="ca">Canada</option>
+					<option value="us">United States</option>
+				</select>
+			</label>
+			<label>Bio <textarea name="bio"></textarea></label>
+			<button>Sign up</button>
+		</form>`,
+		`:input`,
+		[]string{
+			"html[1]/body[1]/form[1]/label[1]/input[1]",
+			"html[1]/body[1]/form[1]/label[2]/input[1]",
+			"html[1]/body[1]/form[1]/label[3]/select[1]",
+			"html[1]/body[1]/form[1]/label[4]/textarea[1]",
+			"html[1]/body[1]/form[1]/button[1]",
+		},
+	},
+	{
+		`<form>
+			<input type="checkbox" id="1" checked>
+			<input type="checkbox" id="2">
+			<select><option id="3">a</option><option id="4" selected>b</option></select>
+			<div id="5" checked selected></div>
+		</form>`,
+		`:checked`,
+		[]string{
+			"html[1]/body[1]/form[1]/input[1]",
+			"html[1]/body[1]/form[1]/select[1]/option[2]",
+		},
+	},
+	{
+		`<form>
+			<input id="1" disabled>
+			<button id="2" disabled>x</button>
+			<fieldset id="3" disabled><input id="4"></fieldset>
+			<select id="5"><optgroup id="6" disabled><option id="7">a</option></optgroup></select>
+			<textarea id="8"></textarea>
+			<div id="9" disabled></div>
+		</form>`,
+		`:disabled`,
+		[]string{
+			"html[1]/body[1]/form[1]/input[1]",
+			"html[1]/body[1]/form[1]/button[1]",
+			"html[1]/body[1]/form[1]/fieldset[1]",
+			"html[1]/body[1]/form[1]/fieldset[1]/input[1]",
+			"html[1]/body[1]/form[1]/select[1]/optgroup[1]",
+			"html[1]/body[1]/form[1]/select[1]/optgroup[1]/option[1]",
+		},
+	},
+	{
+		`<form>
+			<input id="1" disabled>
+			<button id="2" disabled>x</button>
+			<fieldset id="3" disabled><input id="4"></fieldset>
+			<select id="5"><optgroup id="6" disabled><option id="7">a</option></optgroup></select>
+			<textarea id="8"></textarea>
+			<div id="9" disabled></div>
+		</form>`,
+		`:enabled`,
+		[]string{
+			"html[1]/body[1]/form[1]/select[1]",
+			"html[1]/body[1]/form[1]/textarea[1]",
+		},
+	},
+	{
+		`<input id="1"><input id="2" readonly><input id="3" disabled>
+		<input id="4" type="checkbox"><input id="5" type="Email">
+		<textarea id="6"></textarea><textarea id="7" readonly></textarea>
+		<div id="8" contenteditable><p id="9">a<span id="10">b</span></p></div>
+		<div id="11" contenteditable="true"><p id="12" contenteditable="false"><span id="13">c</span></p></div>
+		<div id="14" contenteditable="bogus"></div>`,
+		`[id]:read-write`,
+		[]string{
+			"html[1]/body[1]/input[1]",
+			"html[1]/body[1]/input[5]",
+			"html[1]/body[1]/textarea[1]",
+			"html[1]/body[1]/div[1]",
+			"html[1]/body[1]/div[1]/p[1]",
+			"html[1]/body[1]/div[1]/p[1]/span[1]",
+			"html[1]/body[1]/div[2]",
+		},
+	},
+	{
+		`<input id="1"><input id="2" readonly><input id="3" disabled>
+		<input id="4" type="checkbox"><input id="5" type="Email">
+		<textarea id="6"></textarea><textarea id="7" readonly></textarea>
+		<div id="8" contenteditable><p id="9">a<span id="10">b</span></p></div>
+		<div id="11" contenteditable="true"><p id="12" contenteditable="false"><span id="13">c</span></p></div>
+		<div id="14" contenteditable="bogus"></div>`,
+		`[id]:read-only`,
+		[]string{
+			"html[1]/body[1]/input[2]",
+			"html[1]/body[1]/input[3]",
+			"html[1]/body[1]/input[4]",
+			"html[1]/body[1]/textarea[2]",
+			"html[1]/body[1]/div[2]/p[1]",
+			"html[1]/body[1]/div[2]/p[1]/span[1]",
+			"html[1]/body[1]/div[3]",
+		},
+	},
+	{
+		`<h2 id="1"></h2><div><p id="2"></p></div><p id="3"></p><h2 id="4"></h2>text<p id="5"></p>`,
+		`h2 + p`,
+		[]string{
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<h2 id="1"></h2><div><p id="2"></p></div><p id="3"></p><h2 id="4"></h2>text<p id="5"></p>`,
+		`h2 ~ p`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<div><p class="warning" id="1"></p><p id="2" hidden></p><p id="3"></p></div>
+		<section><p class="warning" id="4"></p></section>`,
+		`p:not(div > .warning, [hidden])`,
+		[]string{
+			"html[1]/body[1]/div[1]/p[3]",
+			"html[1]/body[1]/section[1]/p[1]",
+		},
+	},
+	{
+		`<div id="1"><a class="download"></a></div><div id="2"><p><a class="download"></a></p></div>`,
+		`div:has(> a.download)`,
+		[]string{
+			"html[1]/body[1]/div[1]",
+		},
+	},
+	{
+		`<div><section id="1"><p></p></section></div><section id="2"><div><p></p></div></section>`,
+		`section:has(div p)`,
+		[]string{
+			"html[1]/body[1]/section[1]",
+		},
+	},
+	{
+		`<h2 id="1"></h2><p></p><h2 id="2"></h2>text<div></div><p></p><h2 id="3"></h2><ul><li></li></ul>`,
+		`h2:has(+ p), h2:has(~ ul > li)`,
+		[]string{
+			"html[1]/body[1]/h2[1]",
+			"html[1]/body[1]/h2[2]",
+			"html[1]/body[1]/h2[3]",
+		},
+	},
+	{
+		`<h2 id="1"></h2><div><p><b></b></p></div><h2 id="2"></h2><div><b></b></div>`,
+		`h2:has(+ div > p b)`,
+		[]string{
+			"html[1]/body[1]/h2[1]",
+		},
+	},
+	{
+		`<table><tr id="1"><td>ok</td><td>error</td></tr><tr id="2"><td>ok</td></tr></table>`,
+		`tr:has(td:contains("error"))`,
+		[]string{
+			"html[1]/body[1]/table[1]/tbody[1]/tr[1]",
+		},
+	},
+	{
+		`<h1><a id="1"></a></h1><h2><a id="2"></a></h2><h4><a id="3"></a></h4><a id="4"></a>`,
+		`:is(h1, h2, h3) a`,
+		[]string{
+			"html[1]/body[1]/h1[1]/a[1]",
+			"html[1]/body[1]/h2[1]/a[1]",
+		},
+	},
+	{
+		`<p id="1" class="x"></p><p id="2"></p><div class="x"><p id="3"></p></div>`,
+		`p:where(.x, div > *)`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/div[1]/p[1]",
+		},
+	},
+	{
+		`<p id="1" class="x"></p><p id="2"></p><p id="3" class="y"></p>`,
+		`p:is(:unknown, .y, [=x], .x)`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[3]",
+		},
+	},
+	{
+		`<p id="1" class="x"></p>`,
+		`p:is(), p:where(:bogus)`,
+		[]string{},
+	},
+	{
+		`<p class="a B"><p class="b"><p class="ab">`,
+		`[class~=b i]`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[2]",
+		},
+	},
+	{
+		`<ol><li id=1 class=item><li id=2><li id=3 class=item><li id=4 class=item><li id=5 class=item></ol>`,
+		`li:nth-child(2n+1 of .item)`,
+		[]string{
+			"html[1]/body[1]/ol[1]/li[1]",
+			"html[1]/body[1]/ol[1]/li[4]",
+		},
+	},
+	{
+		`<ol><li id=1 class=item><li id=2><li id=3 class=item><li id=4 class=item><li id=5></ol>`,
+		`:nth-last-child(1 OF .item, #2)`,
+		[]string{
+			"html[1]/body[1]/ol[1]/li[4]",
+		},
+	},
+	{
+		`<table><tr><td id="1">Subtotal</td><td id="2">10</td></tr><tr><td id="3">Total:
+		</td><td id="4">12</td></tr></table>`,
+		`td:contains("total"), td:containsOwn("total:\n")`,
+		[]string{
+			"html[1]/body[1]/table[1]/tbody[1]/tr[1]/td[1]",
+			"html[1]/body[1]/table[1]/tbody[1]/tr[2]/td[1]",
+		},
+	},
+	{
+		`<fieldset id="1" disabled>
+			<legend><input id="2"></legend>
+			<legend><input id="3"></legend>
+			<fieldset id="4"><button id="5">x</button></fieldset>
+			<select id="6"><option id="7">a</option></select>
+		</fieldset>`,
+		`:enabled`,
+		[]string{
+			"html[1]/body[1]/fieldset[1]/legend[1]/input[1]",
+			"html[1]/body[1]/fieldset[1]/select[1]/option[1]",
+		},
+	},
+	{
+		`<input id="1" required><input id="2"><input id="3" type="submit" required>
+		<select id="4" required></select><textarea id="5"></textarea><button id="6"></button>`,
+		`:required`,
+		[]string{
+			"html[1]/body[1]/input[1]",
+			"html[1]/body[1]/select[1]",
+		},
+	},
+	{
+		`<input id="1" required><input id="2"><input id="3" type="submit" required>
+		<select id="4" required></select><textarea id="5"></textarea><button id="6"></button>`,
+		`:optional`,
+		[]string{
+			"html[1]/body[1]/input[2]",
+			"html[1]/body[1]/textarea[1]",
+		},
+	},
+	{
+		`<p id="123" class="foo:bar"></p><p id="2" class="--state"></p><p id="x.y" class="é😀"></p><p id="4"></p>`,
+		`.foo\:bar, #\31 23, .\--state, #x\.y.\E9\1F600`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[2]",
+			"html[1]/body[1]/p[3]",
+		},
+	},
+	{
+		`<div lang="en-US"><p id="1"><p id="2" lang="EN"><p id="3" lang="english"><p id="4" lang=""></div><p id="5">`,
+		`p:lang(en)`,
+		[]string{
+			"html[1]/body[1]/div[1]/p[1]",
+			"html[1]/body[1]/div[1]/p[2]",
+		},
+	},
+	{
+		`<p id="1" lang="de-CH"><p id="2" lang="de-Latn-CH"><p id="3" lang="de-x-ch"><p id="4" lang="fr-CH"><p id="5" lang="fr">`,
+		`p:lang("de-*-CH", fr)`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[2]",
+			"html[1]/body[1]/p[4]",
+			"html[1]/body[1]/p[5]",
+		},
+	},
+	{
+		`<div dir="RTL"><p id="1"><p id="2" dir="ltr"><p id="3" dir="bogus"></div><p id="4">`,
+		`p:dir(rtl)`,
+		[]string{
+			"html[1]/body[1]/div[1]/p[1]",
+			"html[1]/body[1]/div[1]/p[3]",
+		},
+	},
+	{
+		`<p id="1" dir="auto">1. שלום</p><p id="2" dir="auto"><b dir="rtl">שלום</b> hello</p><bdi id="3">مرحبا</bdi><p id="4" dir="auto"><bdi>שלום</bdi></p><input id="5" dir="auto" value="שלום">`,
+		`:dir(rtl)`,
+		[]string{
+			"html[1]/body[1]/p[1]",
+			"html[1]/body[1]/p[2]/b[1]",
+			"html[1]/body[1]/bdi[1]",
+			"html[1]/body[1]/p[3]/bdi[1]",
+			"html[1]/body[1]/input[1]",
+		},
+	},
+	{
+		`<table><colgroup><col id="c1"><col id="c2" class="total" span="2"></colgroup><colgroup id="g2" span="2"></colgroup><tr><th id="1" rowspan="2"><td id="2"><td id="3" colspan="3"><td id="4"></tr><tr><td id="5"><td id="6"><td id="7" colspan="0"></tr></table>`,
+		`col.total || td`,
+		[]string{
+			"html[1]/body[1]/table[1]/tbody[1]/tr[1]/td[1]",
+			"html[1]/body[1]/table[1]/tbody[1]/tr[1]/td[2]",
+			"html[1]/body[1]/table[1]/tbody[1]/tr[2]/td[1]",
+			"html[1]/body[1]/table[1]/tbody[1]/tr[2]/td[2]",
+		},
+	},
+	{
+		`<table><colgroup><col id="c1"><col id="c2" class="total" span="2"></colgroup><colgroup id="g2" span="2"></colgroup><tr><th id="1" rowspan="2"><td id="2"><td id="3" colspan="3"><td id="4"></tr><tr><td id="5"><td id="6"><td id="7" colspan="0"></tr></table>`,
+		`#g2||[id]`,
+		[]string{
+			"html[1]/body[1]/table[1]/tbody[1]/tr[1]/td[2]",
+			"html[1]/body[1]/table[1]/tbody[1]/tr[2]/td[3]",
+		},
+	},
+	{
+		`<table><colgroup><col id="c1"><col id="c2" class="total" span="2"></colgroup><colgroup id="g2" span="2"></colgroup><tr><th id="1" rowspan="2"><td id="2"><td id="3" colspan="3"><td id="4"></tr><tr><td id="5"><td id="6"><td id="7" colspan="0"></tr></table>`,
+		`:nth-col(3)`,
+		[]string{
+			"html[1]/body[1]/table[1]/tbody[1]/tr[1]/td[2]",
+			"html[1]/body[1]/table[1]/tbody[1]/tr[2]/td[2]",
+		},
+	},
+	{
+		`<table><colgroup><col id="c1"><col id="c2" class="total" span="2"></colgroup><colgroup id="g2" span="2"></colgroup><tr><th id="1" rowspan="2"><td id="2"><td id="3" colspan="3"><td id="4"></tr><tr><td id="5"><td id="6"><td id="7" colspan="0"></tr></table>`,
+		`td:nth-last-col(1)`,
+		[]string{
+			"html[1]/body[1]/table[1]/tbody[1]/tr[1]/td[3]",
+		},
+	},
+}
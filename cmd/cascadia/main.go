@@ -0,0 +1,213 @@
+// Command cascadia applies CSS selectors to HTML documents and prints the
+// elements they match.
+//
+// Usage:
+//
+//	cascadia [flags] selector [file ...]
+//	cascadia [flags] -s selector [-s selector ...] [file ...]
+//
+// The documents are read from the files, or from standard input if there are
+// none. By default, each match is printed as HTML, one per line. With -text,
+// its text content is printed instead, and with -attr name, the value of its
+// attribute name; matches without the attribute are skipped. Line breaks
+// within a printed value are replaced by spaces, so that each match takes
+// one line; with -0, the values are printed as they are, each followed by a
+// NUL byte instead of a newline, as xargs -0 expects. With -json, the
+// matches are printed as a JSON array of objects, with the selector, the file
+// name and the printed value.
+//
+// For example:
+//
+//	curl -s https://example.com/ | cascadia -attr href 'a[href]'
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// selectorFlags collects the values of a repeated -s flag.
+type selectorFlags []string
+
+func (s *selectorFlags) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *selectorFlags) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// A match is an element that a selector matched, as printed with -json.
+type match struct {
+	Selector string `json:"selector"`
+	File     string `json:"file,omitempty"`
+	HTML     string `json:"html,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Attr     string `json:"attr,omitempty"`
+}
+
+// run runs the command with the given arguments and files, and returns its
+// exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("cascadia", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var sels selectorFlags
+	fs.Var(&sels, "s", "a selector to apply; may be repeated")
+	text := fs.Bool("text", false, "print the text content of each match")
+	attr := fs.String("attr", "", "print the value of this attribute of each match")
+	asJSON := fs.Bool("json", false, "print the matches as a JSON array")
+	nul := fs.Bool("0", false, "end each match with a NUL byte instead of a newline, keeping its line breaks")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: cascadia [flags] selector [file ...]")
+		fmt.Fprintln(stderr, "       cascadia [flags] -s selector [-s selector ...] [file ...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	files := fs.Args()
+	if len(sels) == 0 {
+		if len(files) == 0 {
+			fs.Usage()
+			return 2
+		}
+		sels, files = selectorFlags{files[0]}, files[1:]
+	}
+	if *text && *attr != "" {
+		fmt.Fprintln(stderr, "cascadia: -text and -attr can't be used together")
+		return 2
+	}
+
+	compiled := make([]cascadia.Selector, len(sels))
+	for i, s := range sels {
+		var err error
+		if compiled[i], err = cascadia.Compile(s); err != nil {
+			fmt.Fprintf(stderr, "cascadia: %s\n", err)
+			return 2
+		}
+	}
+
+	var docs []*html.Node
+	if len(files) == 0 {
+		doc, err := html.Parse(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "cascadia: %s\n", err)
+			return 1
+		}
+		docs = append(docs, doc)
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(stderr, "cascadia: %s\n", err)
+			return 1
+		}
+		doc, err := html.Parse(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(stderr, "cascadia: %s: %s\n", name, err)
+			return 1
+		}
+		docs = append(docs, doc)
+	}
+
+	matches := []match{}
+	for i, doc := range docs {
+		file := ""
+		if len(files) > 0 {
+			file = files[i]
+		}
+		for j, s := range compiled {
+			for _, n := range s.MatchAll(doc) {
+				m := match{Selector: sels[j], File: file}
+				switch {
+				case *text:
+					m.Text = textContent(n)
+				case *attr != "":
+					val, ok := attribute(n, strings.ToLower(*attr))
+					if !ok {
+						continue
+					}
+					m.Attr = val
+				default:
+					var b bytes.Buffer
+					if err := html.Render(&b, n); err != nil {
+						fmt.Fprintf(stderr, "cascadia: %s\n", err)
+						return 1
+					}
+					m.HTML = b.String()
+				}
+				matches = append(matches, m)
+			}
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(matches); err != nil {
+			fmt.Fprintf(stderr, "cascadia: %s\n", err)
+			return 1
+		}
+		return 0
+	}
+	for _, m := range matches {
+		val := m.HTML + m.Text + m.Attr
+		if *nul {
+			fmt.Fprint(stdout, val, "\x00")
+		} else {
+			fmt.Fprintln(stdout, lineBreaks.Replace(val))
+		}
+	}
+	return 0
+}
+
+// lineBreaks replaces each line break with a space.
+var lineBreaks = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+// textContent returns the text of n and its descendants. It walks the tree
+// without recursion, so that deep documents can't overflow the stack.
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	for c := n; c != nil; {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+		if c.FirstChild != nil {
+			c = c.FirstChild
+			continue
+		}
+		for c != n && c.NextSibling == nil {
+			c = c.Parent
+		}
+		if c == n {
+			break
+		}
+		c = c.NextSibling
+	}
+	return b.String()
+}
+
+// attribute returns the value of the attribute of n named key, and whether
+// n has one.
+func attribute(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const page = `<div class="article"><h1>Title</h1><p>One <a href="/a">link</a></p><p>Two <a>none</a></p></div>`
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "page.html")
+	if err := os.WriteFile(file, []byte(page), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"div.article > h1"}, "<h1>Title</h1>\n"},
+		{[]string{"-text", "p"}, "One link\nTwo none\n"},
+		{[]string{"-attr", "HREF", "a"}, "/a\n"},
+		{[]string{"-s", "h1", "-s", "a[href]", "-text"}, "Title\nlink\n"},
+		{[]string{"-text", "h1", file, file}, "Title\nTitle\n"},
+		{[]string{"-json", "-attr", "href", "a", file}, `[
+  {
+    "selector": "a",
+    "file": "` + file + `",
+    "attr": "/a"
+  }
+]
+`},
+		{[]string{"-json", "nav"}, "[]\n"},
+	} {
+		var stdout, stderr bytes.Buffer
+		status := run(test.args, strings.NewReader(page), &stdout, &stderr)
+		if status != 0 || stdout.String() != test.want {
+			t.Errorf("%q: got status %d and output %q (%s), want %q", test.args, status, stdout.String(), stderr.String(), test.want)
+		}
+	}
+}
+
+func TestRunLineBreaks(t *testing.T) {
+	const page = "<p title=\"a\nb\">one\r\ntwo</p><pre>x\n\ny</pre>"
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-text", "p, pre"}, "one two\nx  y\n"},
+		{[]string{"-attr", "title", "p"}, "a b\n"},
+		{[]string{"-0", "-text", "p, pre"}, "one\ntwo\x00x\n\ny\x00"},
+		{[]string{"-0", "-attr", "title", "p"}, "a\nb\x00"},
+	} {
+		var stdout, stderr bytes.Buffer
+		status := run(test.args, strings.NewReader(page), &stdout, &stderr)
+		if status != 0 || stdout.String() != test.want {
+			t.Errorf("%q: got status %d and output %q (%s), want %q", test.args, status, stdout.String(), stderr.String(), test.want)
+		}
+	}
+}
+
+func TestTextContentDeep(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(strings.Repeat("<div>", 100000) + "deep" + "<span>er</span>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := textContent(doc); got != "deeper" {
+		t.Errorf("got %q, want %q", got, "deeper")
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	for _, test := range []struct {
+		args   []string
+		status int
+		want   string
+	}{
+		{nil, 2, "usage:"},
+		{[]string{"div["}, 2, "cascadia: "},
+		{[]string{"-text", "-attr", "href", "a"}, 2, "can't be used together"},
+		{[]string{"p", filepath.Join(t.TempDir(), "missing.html")}, 1, "missing.html"},
+	} {
+		var stdout, stderr bytes.Buffer
+		status := run(test.args, strings.NewReader(page), &stdout, &stderr)
+		if status != test.status || !strings.Contains(stderr.String(), test.want) {
+			t.Errorf("%q: got status %d and error %q, want %d and %q", test.args, status, stderr.String(), test.status, test.want)
+		}
+	}
+}
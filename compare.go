@@ -0,0 +1,166 @@
+package cascadia
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// comparing whole documents, with rules for the parts that don't matter
+
+// An AttrRule tells CompareDocuments to ignore an attribute, or part of one,
+// on the elements that match a selector.
+type AttrRule struct {
+	// Selector chooses the elements the rule applies to.
+	Selector string
+
+	// Attr is the name of the attribute to ignore.
+	Attr string
+
+	// If Value is not nil, only the parts of the attribute's value that
+	// match it are ignored, such as `\?.*$` for the query string of a URL.
+	// Otherwise the whole attribute is ignored.
+	Value *regexp.Regexp
+}
+
+func (r AttrRule) String() string {
+	if r.Value != nil {
+		return fmt.Sprintf("%s [%s] =~ /%s/", r.Selector, r.Attr, r.Value)
+	}
+	return fmt.Sprintf("%s [%s]", r.Selector, r.Attr)
+}
+
+// A Comparison is the result of CompareDocuments.
+type Comparison struct {
+	// Differences describes each place where the documents differ.
+	Differences []string
+
+	// Masked describes each attribute that an AttrRule hid from the
+	// comparison, so that rules that are too broad can be found.
+	Masked []string
+}
+
+// Equal returns whether the documents were equal, apart from the masked
+// attributes.
+func (c *Comparison) Equal() bool {
+	return len(c.Differences) == 0
+}
+
+func (c *Comparison) String() string {
+	var b strings.Builder
+	for _, d := range c.Differences {
+		fmt.Fprintf(&b, "differs: %s\n", d)
+	}
+	for _, m := range c.Masked {
+		fmt.Fprintf(&b, "masked: %s\n", m)
+	}
+	return b.String()
+}
+
+// CompareDocuments compares the trees rooted at a and b, node by node.
+// Elements must have the same tag name and attributes, in any order, and
+// text and comments must be identical. The attributes chosen by rules are
+// left out of the comparison, but everything else about those elements is
+// still compared.
+func CompareDocuments(a, b *html.Node, rules ...AttrRule) (*Comparison, error) {
+	c := &comparer{result: new(Comparison)}
+	for _, r := range rules {
+		s, err := Compile(r.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("rule %v: %v", r, err)
+		}
+		c.rules = append(c.rules, compiledRule{r, s})
+	}
+
+	c.compare(a, b)
+	return c.result, nil
+}
+
+type compiledRule struct {
+	AttrRule
+	sel Selector
+}
+
+type comparer struct {
+	rules  []compiledRule
+	result *Comparison
+}
+
+func (c *comparer) differ(n *html.Node, format string, args ...interface{}) {
+	c.result.Differences = append(c.result.Differences, nodePath(n)+": "+fmt.Sprintf(format, args...))
+}
+
+func (c *comparer) compare(a, b *html.Node) {
+	if a.Type != b.Type || a.Data != b.Data {
+		c.differ(a, "%s differs from %s", describeNode(a), describeNode(b))
+		return
+	}
+
+	if a.Type == html.ElementNode {
+		aAttrs, bAttrs := c.maskedAttrs(a, "old"), c.maskedAttrs(b, "new")
+		if x, y := attrString(&html.Node{Attr: aAttrs}), attrString(&html.Node{Attr: bAttrs}); x != y {
+			c.differ(a, "attributes [%s] differ from [%s]", x, y)
+		}
+	}
+
+	ac, bc := a.FirstChild, b.FirstChild
+	for ; ac != nil && bc != nil; ac, bc = ac.NextSibling, bc.NextSibling {
+		c.compare(ac, bc)
+	}
+	for ; ac != nil; ac = ac.NextSibling {
+		c.differ(a, "%s was removed", describeNode(ac))
+	}
+	for ; bc != nil; bc = bc.NextSibling {
+		c.differ(a, "%s was added", describeNode(bc))
+	}
+}
+
+// maskedAttrs returns n's attributes with the parts that the rules ignore
+// taken out, recording what was masked. which is "old" or "new".
+func (c *comparer) maskedAttrs(n *html.Node, which string) []html.Attribute {
+	attrs := append([]html.Attribute(nil), n.Attr...)
+	for _, r := range c.rules {
+		if !r.sel(n) {
+			continue
+		}
+		kept := attrs[:0]
+		for _, a := range attrs {
+			if a.Key != r.Attr {
+				kept = append(kept, a)
+				continue
+			}
+			if r.Value == nil {
+				c.mask(n, which, r, fmt.Sprintf("%s=%q", a.Key, a.Val))
+				continue
+			}
+			if masked := r.Value.ReplaceAllString(a.Val, ""); masked != a.Val {
+				c.mask(n, which, r, fmt.Sprintf("%q in %s=%q", r.Value.FindAllString(a.Val, -1), a.Key, a.Val))
+				a.Val = masked
+			}
+			kept = append(kept, a)
+		}
+		attrs = kept
+	}
+	return attrs
+}
+
+func (c *comparer) mask(n *html.Node, which string, r compiledRule, what string) {
+	c.result.Masked = append(c.result.Masked, fmt.Sprintf("rule %v masked %s on %s in %s document", r.AttrRule, what, nodePath(n), which))
+}
+
+// describeNode returns a short description of n for error messages.
+func describeNode(n *html.Node) string {
+	switch n.Type {
+	case html.ElementNode:
+		return "<" + n.Data + ">"
+	case html.TextNode:
+		return fmt.Sprintf("text %q", n.Data)
+	case html.CommentNode:
+		return fmt.Sprintf("comment %q", n.Data)
+	case html.DoctypeNode:
+		return "doctype " + n.Data
+	}
+	return "document"
+}
@@ -0,0 +1,78 @@
+package cascadia
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func parseDoc(t *testing.T, s string) *html.Node {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestCompareDocuments(t *testing.T) {
+	oldDoc := parseDoc(t, `<body data-build="1"><form><input name="csrf" value="abc"><input name="q" value="x"></form><script src="/app.js?v=1"></script></body>`)
+	newDoc := parseDoc(t, `<body data-build="2"><form><input name="csrf" value="def"><input name="q" value="x"></form><script src="/app.js?v=2"></script></body>`)
+
+	c, err := CompareDocuments(oldDoc, newDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(c.Differences); got != 3 {
+		t.Errorf("without rules: got %d differences, want 3:\n%s", got, c)
+	}
+
+	rules := []AttrRule{
+		{Selector: `input[name=csrf]`, Attr: "value"},
+		{Selector: `body`, Attr: "data-build"},
+		{Selector: `script[src]`, Attr: "src", Value: regexp.MustCompile(`\?.*$`)},
+	}
+	c, err = CompareDocuments(oldDoc, newDoc, rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Equal() {
+		t.Errorf("with rules: got differences:\n%s", c)
+	}
+	if got := len(c.Masked); got != 6 {
+		t.Errorf("got %d masked attributes, want 6:\n%s", got, c)
+	}
+	if want := `rule input[name=csrf] [value] masked value="abc" on html[1]/body[1]/form[1]/input[1] in old document`; len(c.Masked) > 2 && c.Masked[2] != want {
+		t.Errorf("got mask description %q, want %q", c.Masked[2], want)
+	}
+
+	// The rules only mask the attributes they name.
+	changed := parseDoc(t, `<body data-build="2"><form><input name="csrf" value="def" type="hidden"><input name="q" value="y"></form><script src="/lib.js?v=2"></script></body>`)
+	c, err = CompareDocuments(oldDoc, changed, rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(c.Differences); got != 3 {
+		t.Errorf("got %d differences, want 3:\n%s", got, c)
+	}
+
+	if _, err := CompareDocuments(oldDoc, newDoc, AttrRule{Selector: "input[", Attr: "value"}); err == nil {
+		t.Error("got no error for an invalid rule selector")
+	}
+}
+
+func TestCompareDocumentsStructure(t *testing.T) {
+	c, err := CompareDocuments(parseDoc(t, `<p>a</p><p>b</p>`), parseDoc(t, `<p>a</p><div>b</div><p>c</p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`html[1]/body[1]/p[2]: <p> differs from <div>`,
+		`html[1]/body[1]: <p> was added`,
+	}
+	if strings.Join(c.Differences, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got differences:\n%s\nwant:\n%s", strings.Join(c.Differences, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,54 @@
+package cascadia
+
+import (
+	"golang.org/x/net/html"
+)
+
+// A ComponentResult reports whether one part of a selector matched a node.
+type ComponentResult struct {
+	// Component is the part of the selector, in canonical form.
+	Component string
+
+	// Matched is true if the node satisfies the component.
+	Matched bool
+}
+
+// MatchComponents parses sel and reports, for each simple selector in its
+// subject (the compound selector after the last combinator), whether n
+// matches it. For example, with ".a.b[data-x]", the results are for ".a",
+// ".b" and "[data-x]".
+//
+// If sel has combinators, the results end with one more component for the
+// rest of the selector, such as "ul > *" for "ul > li.active"; it reports
+// whether n's ancestors or siblings satisfy that part. A selector list is
+// treated as a single component, as are the arguments of pseudo-classes.
+//
+// n matches sel if and only if all of the results are true.
+func MatchComponents(sel string, n *html.Node) ([]ComponentResult, error) {
+	p := &parser{s: sel}
+	m, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return matchComponents(m, n), nil
+}
+
+func matchComponents(m Sel, n *html.Node) []ComponentResult {
+	switch m := m.(type) {
+	case compoundSelector:
+		if len(m) == 0 {
+			return []ComponentResult{{m.String(), m.Match(n)}}
+		}
+		result := make([]ComponentResult, len(m))
+		for i, c := range m {
+			result[i] = ComponentResult{c.String(), c.Match(n)}
+		}
+		return result
+
+	case combinedSelector:
+		context := combinedSelector{first: m.first, combinator: m.combinator, second: compoundSelector{}}
+		return append(matchComponents(m.second, n), ComponentResult{context.String(), context.Match(n)})
+	}
+
+	return []ComponentResult{{m.String(), m.Match(n)}}
+}
@@ -0,0 +1,50 @@
+package cascadia
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestMatchComponents(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<ul><li class="a c" data-x="1" id="li"></li></ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	li := MustCompile("#li").MatchFirst(doc)
+
+	for _, test := range []struct {
+		sel  string
+		want []ComponentResult
+	}{
+		{".a.b[data-x]", []ComponentResult{{".a", true}, {".b", false}, {"[data-x]", true}}},
+		{"li", []ComponentResult{{"li", true}}},
+		{"*", []ComponentResult{{"*", true}}},
+		{"ol > li.c", []ComponentResult{{"li", true}, {".c", true}, {"ol > *", false}}},
+		{"body ul + li:not(.a)", []ComponentResult{{"li", true}, {":not(.a)", false}, {"body ul + *", false}}},
+		{"p, li", []ComponentResult{{"p, li", true}}},
+	} {
+		got, err := MatchComponents(test.sel, li)
+		if err != nil {
+			t.Errorf("%s: %s", test.sel, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.sel, got, test.want)
+		}
+
+		all := true
+		for _, r := range got {
+			all = all && r.Matched
+		}
+		if all != MustCompile(test.sel).Match(li) {
+			t.Errorf("%s: components say %v, selector says %v", test.sel, all, !all)
+		}
+	}
+
+	if _, err := MatchComponents("li[", li); err == nil {
+		t.Error("got no error for invalid selector")
+	}
+}
@@ -0,0 +1,156 @@
+package cascadia
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// comparing the matches of selectors between two versions of a document
+
+// A Change lists how the matches of one selector differ between an old and
+// a new version of a document.
+type Change struct {
+	// Added holds the matches in the new document that have no counterpart
+	// in the old one.
+	Added []*html.Node
+
+	// Removed holds the matches in the old document that have no
+	// counterpart in the new one.
+	Removed []*html.Node
+
+	// Changed holds the matches that are present in both documents, but
+	// whose text or attributes are different.
+	Changed []NodePair
+}
+
+// A NodePair is an element from an old document and its counterpart in a
+// new document.
+type NodePair struct {
+	Old, New *html.Node
+}
+
+// Diff compares the nodes matched by each member of group in oldRoot and
+// newRoot, and returns a Change for each member, in the same order as group.
+//
+// A match in the old document is paired with one in the new document if it
+// has the same structural path (the tag names and positions among siblings
+// of the same type, from the root down) and the same id, if any. Matches
+// that can't be paired that way are paired by tag name and id, and then by
+// tag name and class attribute. A pair is reported as changed if the elements' text (with
+// runs of whitespace collapsed) or attributes differ.
+func Diff(oldRoot, newRoot *html.Node, group SelectorGroup) []Change {
+	changes := make([]Change, len(group))
+	for i, s := range group {
+		changes[i] = diffMatches(s.MatchAll(oldRoot), s.MatchAll(newRoot))
+	}
+	return changes
+}
+
+// diffMatches pairs up the nodes in oldNodes and newNodes, and reports the
+// differences.
+func diffMatches(oldNodes, newNodes []*html.Node) Change {
+	var pairs []NodePair
+	paired := make(map[*html.Node]bool)
+
+	// Each pass pairs the remaining old nodes with the first remaining new
+	// node that has the same key.
+	for _, key := range []func(*html.Node) string{pathKey, idKey, classKey} {
+		available := make(map[string][]*html.Node)
+		for _, n := range newNodes {
+			if !paired[n] {
+				if k := key(n); k != "" {
+					available[k] = append(available[k], n)
+				}
+			}
+		}
+		for _, o := range oldNodes {
+			if paired[o] {
+				continue
+			}
+			k := key(o)
+			if k == "" || len(available[k]) == 0 {
+				continue
+			}
+			n := available[k][0]
+			available[k] = available[k][1:]
+			paired[o], paired[n] = true, true
+			pairs = append(pairs, NodePair{o, n})
+		}
+	}
+
+	var c Change
+	for _, o := range oldNodes {
+		if !paired[o] {
+			c.Removed = append(c.Removed, o)
+		}
+	}
+	for _, n := range newNodes {
+		if !paired[n] {
+			c.Added = append(c.Added, n)
+		}
+	}
+	for _, p := range pairs {
+		if normalizedText(p.Old) != normalizedText(p.New) || attrString(p.Old) != attrString(p.New) {
+			c.Changed = append(c.Changed, p)
+		}
+	}
+	return c
+}
+
+// nodePath returns the structural path of n from the root of its tree, like
+// "html[1]/body[1]/div[2]", where the numbers are positions among siblings
+// of the same type.
+func nodePath(n *html.Node) string {
+	var parts []string
+	for ; n != nil && n.Type == html.ElementNode; n = n.Parent {
+		parts = append(parts, n.Data+"["+strconv.Itoa(nthIndex(n, false, true))+"]")
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, "/")
+}
+
+// pathKey returns n's structural path and id.
+func pathKey(n *html.Node) string {
+	return nodePath(n) + "#" + attributeValue(n, "id")
+}
+
+// idKey returns n's tag name and id, or "" if it has no id.
+func idKey(n *html.Node) string {
+	id := attributeValue(n, "id")
+	if id == "" {
+		return ""
+	}
+	return n.Data + "#" + id
+}
+
+// classKey returns n's tag name and class attribute, or "" if it has no
+// class.
+func classKey(n *html.Node) string {
+	class := strings.Join(strings.Fields(attributeValue(n, "class")), " ")
+	if class == "" {
+		return ""
+	}
+	return n.Data + "." + class
+}
+
+// normalizedText returns the text of n, with leading and trailing whitespace
+// removed and other runs of whitespace replaced by a single space.
+func normalizedText(n *html.Node) string {
+	return strings.Join(strings.Fields(nodeText(n)), " ")
+}
+
+// attrString returns n's attributes in a canonical form, so that elements
+// with the same attributes in a different order compare equal.
+func attrString(n *html.Node) string {
+	attrs := make([]string, len(n.Attr))
+	for i, a := range n.Attr {
+		attrs[i] = a.Namespace + ":" + a.Key + "=" + strconv.Quote(a.Val)
+	}
+	sort.Strings(attrs)
+	return strings.Join(attrs, " ")
+}
@@ -0,0 +1,88 @@
+package cascadia
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// idList returns the id attributes of nodes, separated by spaces.
+func idList(nodes []*html.Node) string {
+	ids := make([]string, len(nodes))
+	for i, n := range nodes {
+		ids[i] = attributeValue(n, "id")
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestDiff(t *testing.T) {
+	oldDoc, err := html.Parse(strings.NewReader(`
+		<div class="price" id="p1">$10</div>
+		<div class="price" id="p2">$20</div>
+		<ul><li id="a">A</li><li id="b">B</li><li id="c">C</li></ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newDoc, err := html.Parse(strings.NewReader(`
+		<div class="price" id="p1">$10</div>
+		<div class="price" id="p2">  $25 </div>
+		<ul><li id="b">B</li><li id="c" title="x">C</li><li id="d">D</li></ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group, err := CompileGroup(".price, li, h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := Diff(oldDoc, newDoc, group)
+	if len(changes) != 3 {
+		t.Fatalf("got %d changes, want 3", len(changes))
+	}
+
+	for i, want := range []struct{ added, removed, changed string }{
+		{"", "", "p2"},
+		// The items have moved, so they are paired by id instead of by
+		// path.
+		{"d", "a", "c"},
+		{"", "", ""},
+	} {
+		c := changes[i]
+		var changedIDs []string
+		for _, p := range c.Changed {
+			changedIDs = append(changedIDs, attributeValue(p.Old, "id"))
+		}
+		if got := idList(c.Added); got != want.added {
+			t.Errorf("member %d: added %q, want %q", i, got, want.added)
+		}
+		if got := idList(c.Removed); got != want.removed {
+			t.Errorf("member %d: removed %q, want %q", i, got, want.removed)
+		}
+		if got := strings.Join(changedIDs, " "); got != want.changed {
+			t.Errorf("member %d: changed %q, want %q", i, got, want.changed)
+		}
+	}
+}
+
+func TestDiffFallback(t *testing.T) {
+	oldDoc, err := html.Parse(strings.NewReader(`<div><p id="x">one</p><p class="k" id="1">two</p><p id="gone">three</p></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newDoc, err := html.Parse(strings.NewReader(`<section><p id="x">one</p></section><p class="k" id="2">two</p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := Diff(oldDoc, newDoc, SelectorGroup{MustCompile("p")})[0]
+	if len(c.Added) != 0 {
+		t.Errorf("added %q, want none", idList(c.Added))
+	}
+	if got, want := idList(c.Removed), "gone"; got != want {
+		t.Errorf("removed %q, want %q", got, want)
+	}
+	if len(c.Changed) != 1 || attributeValue(c.Changed[0].New, "id") != "2" {
+		t.Errorf("got %d changed pairs, want p.k with its new id", len(c.Changed))
+	}
+}
@@ -0,0 +1,91 @@
+package cascadia
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// document-level helpers that look at more than one node at a time
+
+// DuplicateIDs returns the id values that are used by more than one element
+// in root and its descendants, mapped to the elements that use them, in
+// document order.
+//
+// Selectors don't assume that ids are unique: MatchAll with a selector like
+// "#x" returns every element with id="x", in document order.
+func DuplicateIDs(root *html.Node) map[string][]*html.Node {
+	ids := make(map[string][]*html.Node)
+	collectIDs(root, ids)
+
+	for id, nodes := range ids {
+		if len(nodes) < 2 {
+			delete(ids, id)
+		}
+	}
+	return ids
+}
+
+// collectIDs adds the elements in root and its descendants that have an id
+// attribute to ids.
+func collectIDs(root *html.Node, ids map[string][]*html.Node) {
+	for n := root; n != nil; n = nextInSubtree(n, root) {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		for _, a := range n.Attr {
+			if a.Key == "id" {
+				ids[a.Val] = append(ids[a.Val], n)
+				break
+			}
+		}
+	}
+}
+
+var fragmentLinkSelector = MustCompile(`a[href^="#"], area[href^="#"]`)
+var namedAnchorSelector = MustCompile(`a[name]`)
+
+// BrokenFragmentLinks returns the in-page links (a or area elements with an
+// href starting with "#") in root and its descendants whose fragment doesn't
+// identify any element in root. A fragment identifies an element if it equals
+// the element's id, or the name of an a element. The empty fragment and
+// "#top" refer to the top of the document, so they are never broken.
+func BrokenFragmentLinks(root *html.Node) []*html.Node {
+	targets := make(map[string]bool)
+	ids := make(map[string][]*html.Node)
+	collectIDs(root, ids)
+	for id := range ids {
+		targets[id] = true
+	}
+	for _, a := range namedAnchorSelector.MatchAll(root) {
+		targets[attributeValue(a, "name")] = true
+	}
+
+	var broken []*html.Node
+	for _, link := range fragmentLinkSelector.MatchAll(root) {
+		fragment := attributeValue(link, "href")[1:]
+		if fragment == "" || targets[fragment] {
+			continue
+		}
+		if decoded, err := url.PathUnescape(fragment); err == nil && targets[decoded] {
+			continue
+		}
+		if strings.EqualFold(fragment, "top") {
+			continue
+		}
+		broken = append(broken, link)
+	}
+	return broken
+}
+
+// attributeValue returns the value of n's attribute named key, or the empty
+// string if there is no such attribute.
+func attributeValue(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package cascadia
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestDuplicateIDs(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p id="a">1</p><div id="b"><p id="a">2</p></div><span id="c"></span><b id="a">3</b><i id="b"></i>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dups := DuplicateIDs(doc)
+	if len(dups) != 2 {
+		t.Fatalf("got %d duplicate ids, want 2", len(dups))
+	}
+
+	want := MustCompile("#a").MatchAll(doc)
+	if len(want) != 3 {
+		t.Fatalf("#a: got %d matches, want 3", len(want))
+	}
+	for i, n := range dups["a"] {
+		if n != want[i] {
+			t.Errorf("a: element %d: got %s, want %s", i, nodeString(n), nodeString(want[i]))
+		}
+	}
+
+	if got := len(dups["b"]); got != 2 {
+		t.Errorf("b: got %d elements, want 2", got)
+	}
+	if _, ok := dups["c"]; ok {
+		t.Error("unique id c reported as duplicate")
+	}
+
+	// Only the first element with a duplicated id is the target.
+	target, err := CompileWithOptions(":target", Options{Context: &DocumentContext{Fragment: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := target.MatchAll(doc); len(got) != 1 || got[0] != want[0] {
+		t.Errorf(":target: got %d matches, want only the first #a", len(got))
+	}
+}
+
+func TestBrokenFragmentLinks(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`
+		<h1 id="intro">Intro</h1>
+		<a name="legacy"></a>
+		<h2 id="café">Café</h2>
+		<a id="l1" href="#intro">ok</a>
+		<a id="l2" href="#missing">broken</a>
+		<a id="l3" href="#">top</a>
+		<a id="l4" href="#TOP">top</a>
+		<a id="l5" href="#legacy">named</a>
+		<a id="l6" href="#caf%C3%A9">encoded</a>
+		<a id="l7" href="/page#intro">other page</a>
+		<map><area id="l8" href="#nowhere"></map>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, n := range BrokenFragmentLinks(doc) {
+		got = append(got, attributeValue(n, "id"))
+	}
+	if want := "l2 l8"; strings.Join(got, " ") != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,104 @@
+package cascadia
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// A Field describes how to extract one value from each item matched by
+// ExtractRecords.
+type Field struct {
+	// Selector is matched against the item and its descendants; the first
+	// match in document order is used. Within Selector, :scope refers to the
+	// item, so ":scope > a" selects only links that are children of the item.
+	Selector string
+
+	// Kind is "text" for the text content of the match, "html" for its inner
+	// HTML, or "attr:name" for the value of the attribute name. An empty Kind
+	// is the same as "text".
+	Kind string
+
+	// Required makes ExtractRecords fail if the selector doesn't match (or
+	// the attribute is missing) for an item. Otherwise the field is set to
+	// the empty string.
+	Required bool
+}
+
+// A Schema maps field names to the Fields used to fill them in.
+type Schema map[string]Field
+
+// ExtractRecords returns one record for each node matched by item (from root
+// and its descendants, in document order). Each record maps the field names
+// in schema to the values extracted from the item.
+func ExtractRecords(root *html.Node, item Selector, schema Schema) ([]map[string]string, error) {
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	scope := new(scopeRef)
+	fields := make([]Selector, len(names))
+	for i, name := range names {
+		f := schema[name]
+		switch {
+		case f.Kind == "", f.Kind == "text", f.Kind == "html", strings.HasPrefix(f.Kind, "attr:"):
+		default:
+			return nil, fmt.Errorf("field %q: unknown kind %q", name, f.Kind)
+		}
+		p := &parser{s: f.Selector, scope: scope}
+		sel, err := p.compile()
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %v", name, err)
+		}
+		fields[i] = sel
+	}
+
+	var records []map[string]string
+	for i, n := range item.MatchAll(root) {
+		scope.node = n
+		record := make(map[string]string, len(names))
+		for j, name := range names {
+			f := schema[name]
+			val, ok := extractField(fields[j].MatchFirst(n), f.Kind)
+			if !ok && f.Required {
+				return nil, fmt.Errorf("item %d: required field %q not found", i, name)
+			}
+			record[name] = val
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// extractField returns the value of kind for n. It returns false if n is
+// nil or doesn't have the requested attribute.
+func extractField(n *html.Node, kind string) (string, bool) {
+	if n == nil {
+		return "", false
+	}
+
+	switch {
+	case kind == "html":
+		var b bytes.Buffer
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			html.Render(&b, c)
+		}
+		return b.String(), true
+	case strings.HasPrefix(kind, "attr:"):
+		key := kind[len("attr:"):]
+		for _, a := range n.Attr {
+			if a.Key == key {
+				return a.Val, true
+			}
+		}
+		return "", false
+	}
+
+	return nodeText(n), true
+}
@@ -0,0 +1,73 @@
+package cascadia
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+var extractHTML = `<ul>
+	<li class="item"><a href="/a">Apple</a> <span class="price">1.00</span></li>
+	<li class="item"><a href="/b">Banana</a></li>
+	<li class="item"><span class="price">3.00</span>
+		<ul><li class="item"><a href="/c">Cherry</a> <span class="price">0.50</span></li></ul>
+	</li>
+</ul>`
+
+func TestExtractRecords(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(extractHTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ExtractRecords(doc, MustCompile("li.item"), Schema{
+		"name":  {Selector: ":scope > a"},
+		"link":  {Selector: ":scope > a", Kind: "attr:href"},
+		"price": {Selector: ".price"},
+		"tag":   {Selector: ":scope > .price", Kind: "html"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []map[string]string{
+		{"name": "Apple", "link": "/a", "price": "1.00", "tag": "1.00"},
+		{"name": "Banana", "link": "/b", "price": "", "tag": ""},
+		{"name": "", "link": "", "price": "3.00", "tag": "3.00"},
+		{"name": "Cherry", "link": "/c", "price": "0.50", "tag": "0.50"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got %v, want %v", records, want)
+	}
+}
+
+func TestExtractRecordsRequired(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(extractHTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ExtractRecords(doc, MustCompile("li.item"), Schema{
+		"name":  {Selector: "a"},
+		"price": {Selector: ".price", Required: true},
+	})
+	if err == nil || !strings.Contains(err.Error(), `item 1: required field "price" not found`) {
+		t.Errorf("got error %v, want missing price in item 1", err)
+	}
+
+	_, err = ExtractRecords(doc, MustCompile("li.item"), Schema{
+		"link": {Selector: "a", Kind: "attr:title", Required: true},
+	})
+	if err == nil {
+		t.Error("missing required attribute: got no error")
+	}
+
+	_, err = ExtractRecords(doc, MustCompile("li.item"), Schema{
+		"name": {Selector: "a", Kind: "markdown"},
+	})
+	if err == nil {
+		t.Error("unknown kind: got no error")
+	}
+}
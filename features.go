@@ -0,0 +1,103 @@
+package cascadia
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Feature is a set of selector features, which can be checked with
+// ValidateFeatures to limit what user-supplied selectors may use.
+type Feature uint
+
+const (
+	// FeatureCombinators is the descendant and child combinators (" " and ">").
+	FeatureCombinators Feature = 1 << iota
+	// FeatureSiblings is the sibling combinators ("+" and "~").
+	FeatureSiblings
+	// FeatureNegation is the :not() pseudo-class.
+	FeatureNegation
+	// FeatureStructural is the :nth-child() family, :first-child, etc., and
+	// the column selectors: :nth-col(), :nth-last-col() and "||".
+	FeatureStructural
+	// FeatureHas is the :has() and :haschild() pseudo-classes, which examine
+	// the descendants of every candidate element.
+	FeatureHas
+	// FeatureContains is the :contains() and :containsOwn() (or
+	// :contains-own()) pseudo-classes,
+	// which examine the text of every candidate element.
+	FeatureContains
+	// FeatureRegexp is the regular expression extensions: :matches(),
+	// :matchesOwn() and [attr#=(regexp)].
+	FeatureRegexp
+	// FeatureNonStandard is every extension that isn't part of CSS, including
+	// the ones in FeatureContains and FeatureRegexp.
+	FeatureNonStandard
+
+	// AllFeatures is the set of all features.
+	AllFeatures Feature = 1<<iota - 1
+)
+
+var featureNames = []string{
+	"combinators",
+	"sibling combinators",
+	":not()",
+	"structural pseudo-classes",
+	":has()",
+	":contains()",
+	"regular expressions",
+	"non-standard extensions",
+}
+
+// String returns a comma-separated list of the features in f.
+func (f Feature) String() string {
+	var names []string
+	for i, name := range featureNames {
+		if f&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// pseudoclassFeatures lists the features used by each pseudo-class that
+// isn't allowed unconditionally.
+var pseudoclassFeatures = map[string]Feature{
+	"not":              FeatureNegation,
+	"has":              FeatureHas,
+	"haschild":         FeatureHas | FeatureNonStandard,
+	"contains":         FeatureContains | FeatureNonStandard,
+	"containsown":      FeatureContains | FeatureNonStandard,
+	"contains-own":     FeatureContains | FeatureNonStandard,
+	"matches":          FeatureRegexp | FeatureNonStandard,
+	"matchesown":       FeatureRegexp | FeatureNonStandard,
+	"class-prefix":     FeatureNonStandard,
+	"class-suffix":     FeatureNonStandard,
+	"input":            FeatureNonStandard,
+	"nth-child":        FeatureStructural,
+	"nth-last-child":   FeatureStructural,
+	"nth-of-type":      FeatureStructural,
+	"nth-last-of-type": FeatureStructural,
+	"first-child":      FeatureStructural,
+	"last-child":       FeatureStructural,
+	"first-of-type":    FeatureStructural,
+	"last-of-type":     FeatureStructural,
+	"only-child":       FeatureStructural,
+	"only-of-type":     FeatureStructural,
+	"nth-col":          FeatureStructural,
+	"nth-last-col":     FeatureStructural,
+}
+
+// ValidateFeatures parses sel and checks that it only uses the features in
+// allowed. Type, class, id and attribute selectors are always allowed.
+// If sel uses other features, the error lists them.
+func ValidateFeatures(sel string, allowed Feature) error {
+	p := &parser{s: sel}
+	if _, err := p.compile(); err != nil {
+		return err
+	}
+
+	if extra := p.features &^ allowed; extra != 0 {
+		return fmt.Errorf("selector %q uses disallowed features: %s", sel, extra)
+	}
+	return nil
+}
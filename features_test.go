@@ -0,0 +1,44 @@
+package cascadia
+
+import (
+	"strings"
+	"testing"
+)
+
+var featureTests = []struct {
+	sel     string
+	allowed Feature
+	bad     string // the disallowed features listed in the error, if any
+}{
+	{`div.a#b[c="d"]`, 0, ""},
+	{`div p`, 0, "combinators"},
+	{`div > p + a`, FeatureCombinators, "sibling combinators"},
+	{`p:contains("x"), a:has(b)`, FeatureCombinators, ":has(), :contains(), non-standard extensions"},
+	{`li:not(:nth-child(odd))`, FeatureNegation | FeatureStructural, ""},
+	{`[href#=(^https)]`, FeatureRegexp, "non-standard extensions"},
+	{`:matchesOwn(\d)`, AllFeatures &^ FeatureRegexp, "regular expressions"},
+	{`div :haschild(p)`, AllFeatures, ""},
+}
+
+func TestValidateFeatures(t *testing.T) {
+	for _, test := range featureTests {
+		err := ValidateFeatures(test.sel, test.allowed)
+		if test.bad == "" {
+			if err != nil {
+				t.Errorf("%s: got error (%s), want none", test.sel, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: got no error, want %q", test.sel, test.bad)
+			continue
+		}
+		if !strings.HasSuffix(err.Error(), "disallowed features: "+test.bad) {
+			t.Errorf("%s: got error (%s), want %q", test.sel, err, test.bad)
+		}
+	}
+
+	if err := ValidateFeatures(`div[`, AllFeatures); err == nil {
+		t.Error("invalid selector: got no error")
+	}
+}
@@ -0,0 +1,108 @@
+package cascadia
+
+// Hints returns the tag names, ids and class names that an element must
+// have at least one of to match sel, as parsed by Parse, so that a program
+// with an index of its documents can look up the candidates instead of
+// matching every node. Each member of a selector list contributes one
+// name, from the rightmost compound selector: its id if it has one, or else
+// its tag name, or else a class. If the compound selector has none of them,
+// but has an :is() or :where() whose members all do, as with :is(h1, h2),
+// each of those members contributes one.
+//
+// If some member of sel can match elements without a particular tag name,
+// id or class, as with [href] or *, all three are nil: an index can't
+// narrow the search. exact reports whether every element that has one of
+// the names matches sel, as with "h1, #main, .note", so that the
+// candidates don't need to be matched against sel at all. If sel can't
+// match anything, as with :hover, all three are nil and exact is true.
+//
+// The Hints methods of ObservedSelector and IndexedSelector give the same
+// results for compiled selectors.
+func Hints(sel Sel) (tags, ids, classes []string, exact bool) {
+	members := []Sel{optimize(sel)}
+	if u, ok := members[0].(unionSelector); ok {
+		members = u
+	}
+
+	seen := make(map[selectorKey]bool)
+	exact = true
+	for _, m := range members {
+		if _, ok := m.(neverSelector); ok {
+			continue
+		}
+		keys, memberExact, ok := hintKeys(m, true)
+		if !ok {
+			return nil, nil, nil, false
+		}
+		exact = exact && memberExact
+		for _, key := range keys {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			switch key.kind {
+			case 't':
+				tags = append(tags, key.val)
+			case '#':
+				ids = append(ids, key.val)
+			case '.':
+				classes = append(classes, key.val)
+			}
+		}
+	}
+	return tags, ids, classes, exact
+}
+
+// hintKeys returns the keys that an element must have one of to match m, a
+// member of a selector list, and whether having one is enough. If flatten
+// is true and m's rightmost compound selector has no key of its own, the
+// keys may come from the members of an :is() or :where() in it.
+func hintKeys(m Sel, flatten bool) (keys []selectorKey, exact, ok bool) {
+	exact = true
+	if c, ok := m.(combinedSelector); ok {
+		m, exact = c.second, false
+	}
+	if key, rest, ok := splitKey(m); ok {
+		return []selectorKey{key}, exact && rest == nil, true
+	}
+	if !flatten {
+		return nil, false, false
+	}
+
+	compound, _ := m.(compoundSelector)
+parts:
+	for _, part := range compound {
+		is, ok := part.(matchesAnySelector)
+		if !ok {
+			continue
+		}
+		members := []Sel{is.sel}
+		if u, ok := is.sel.(unionSelector); ok {
+			members = u
+		}
+		keys = nil
+		isExact := exact && len(compound) == 1
+		for _, member := range members {
+			if _, ok := member.(neverSelector); ok {
+				continue
+			}
+			k, e, ok := hintKeys(member, false)
+			if !ok {
+				continue parts
+			}
+			keys, isExact = append(keys, k...), isExact && e
+		}
+		return keys, isExact, true
+	}
+	return nil, false, false
+}
+
+// Hints is like the Hints function, for the selector s was compiled from.
+func (s *ObservedSelector) Hints() (tags, ids, classes []string, exact bool) {
+	return Hints(s.m)
+}
+
+// Hints is like the Hints function, for the selector s was compiled from.
+func (s *IndexedSelector) Hints() (tags, ids, classes []string, exact bool) {
+	return Hints(s.m)
+}
@@ -0,0 +1,111 @@
+package cascadia
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestHints(t *testing.T) {
+	for _, test := range []struct {
+		sel                string
+		tags, ids, classes []string
+		exact              bool
+	}{
+		{`h1, #main, .note`, []string{"h1"}, []string{"main"}, []string{"note"}, true},
+		{`div.row#x`, nil, []string{"x"}, nil, false},
+		{`P.a, p.b`, []string{"p"}, nil, nil, false},
+		{`ul > li.item`, []string{"li"}, nil, nil, false},
+		{`.a.b`, nil, nil, []string{"a"}, false},
+		{`h1, [href]`, nil, nil, nil, false},
+		{`*`, nil, nil, nil, false},
+		{`div, p:hover`, []string{"div"}, nil, nil, true},
+		{`:hover`, nil, nil, nil, true},
+		{`:is(div, p)`, []string{"div", "p"}, nil, nil, true},
+		{`:where(.a)`, nil, nil, []string{"a"}, true},
+		{`ul > :is(li, #x)`, []string{"li"}, []string{"x"}, nil, false},
+		{`:is(div, p).a`, nil, nil, []string{"a"}, false},
+		{`:is(div, p)[href]`, []string{"div", "p"}, nil, nil, false},
+		{`:is(div p, h1.x)`, []string{"p", "h1"}, nil, nil, false},
+		{`:is(div, [href])`, nil, nil, nil, false},
+		{`:is(div, :is(p))`, nil, nil, nil, false},
+	} {
+		p := &parser{s: test.sel, opts: Options{DynamicPseudoclasses: true}}
+		sel, err := p.parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tags, ids, classes, exact := Hints(sel)
+		if !reflect.DeepEqual(tags, test.tags) || !reflect.DeepEqual(ids, test.ids) || !reflect.DeepEqual(classes, test.classes) || exact != test.exact {
+			t.Errorf("%s: got %q %q %q %v, want %q %q %q %v", test.sel, tags, ids, classes, exact, test.tags, test.ids, test.classes, test.exact)
+		}
+	}
+}
+
+func TestSelectorHints(t *testing.T) {
+	const sel = `h1, :is(#main, .note)`
+	want := []interface{}{[]string{"h1"}, []string{"main"}, []string{"note"}, true}
+
+	observed, err := CompileObserved(sel, Options{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, ids, classes, exact := observed.Hints()
+	if got := []interface{}{tags, ids, classes, exact}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ObservedSelector: got %q, want %q", got, want)
+	}
+
+	indexed, err := CompileIndexed(sel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, ids, classes, exact = indexed.Hints()
+	if got := []interface{}{tags, ids, classes, exact}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IndexedSelector: got %q, want %q", got, want)
+	}
+}
+
+// TestHintsFindAllMatches checks that, for each selector in the conformance
+// table that has hints, every node it matches has one of them.
+func TestHintsFindAllMatches(t *testing.T) {
+	for _, test := range selectorTests {
+		sel, err := Parse(test.Selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tags, ids, classes, _ := Hints(sel)
+		if tags == nil && ids == nil && classes == nil {
+			continue
+		}
+		doc, err := html.Parse(strings.NewReader(test.HTML))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range CompileSel(sel).MatchAll(doc) {
+			if !hasHint(n, tags, ids, classes) {
+				t.Errorf("%s: %s matches but has none of the hints", test.Selector, nodeString(n))
+			}
+		}
+	}
+}
+
+func hasHint(n *html.Node, tags, ids, classes []string) bool {
+	for _, tag := range tags {
+		if n.Type == html.ElementNode && n.Data == tag {
+			return true
+		}
+	}
+	for _, id := range ids {
+		if (idSelector{id: id}).Match(n) {
+			return true
+		}
+	}
+	for _, class := range classes {
+		if (classSelector{class: class}).Match(n) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package cascadia
+
+import (
+	"golang.org/x/net/html"
+)
+
+// An Iterator steps through the nodes matched by a selector, in the same
+// order as MatchAll. It is created by Selector.Iter or Selector.LiveIter.
+type Iterator struct {
+	s    Selector
+	root *html.Node
+	live bool
+
+	// for snapshot iteration
+	nodes []*html.Node
+
+	// for live iteration
+	cur        *html.Node // the next node to test
+	last       *html.Node // the node most recently returned by Next
+	lastParent *html.Node // last.Parent when it was returned
+	after      *html.Node // the node following last's subtree when it was returned
+}
+
+// Iter returns an Iterator over the nodes that match s, from n and its
+// children. The matches are collected when Iter is called, so the tree may
+// be modified freely during the iteration (for example, by removing each
+// node as it is returned); later changes don't affect which nodes are
+// returned.
+func (s Selector) Iter(n *html.Node) *Iterator {
+	return &Iterator{s: s, root: n, nodes: s.MatchAll(n)}
+}
+
+// LiveIter is like Iter, but it finds each match when Next is called,
+// instead of collecting them all in advance. This saves memory, and the
+// iteration reflects changes made to the part of the tree that hasn't been
+// visited yet.
+//
+// The node most recently returned by Next may be removed from the tree; its
+// descendants are then skipped. The effect of any other change to that node's
+// ancestors or siblings is undefined: nodes may be skipped or visited twice.
+func (s Selector) LiveIter(n *html.Node) *Iterator {
+	return &Iterator{s: s, root: n, live: true, cur: n}
+}
+
+// Next returns the next matching node, or nil if there are no more.
+func (it *Iterator) Next() *html.Node {
+	if !it.live {
+		if len(it.nodes) == 0 {
+			return nil
+		}
+		n := it.nodes[0]
+		it.nodes = it.nodes[1:]
+		return n
+	}
+
+	if it.last != nil {
+		if it.last.FirstChild != nil && (it.last == it.root || it.last.Parent == it.lastParent) {
+			it.cur = it.last.FirstChild
+		} else {
+			it.cur = it.after
+		}
+		it.last = nil
+	}
+
+	for it.cur != nil {
+		n := it.cur
+		if it.s(n) {
+			it.last, it.lastParent, it.after = n, n.Parent, it.following(n)
+			it.cur = nil
+			return n
+		}
+		if n.FirstChild != nil {
+			it.cur = n.FirstChild
+		} else {
+			it.cur = it.following(n)
+		}
+	}
+	return nil
+}
+
+// following returns the node that comes after n and its descendants in
+// document order, without leaving the iterator's root.
+func (it *Iterator) following(n *html.Node) *html.Node {
+	for ; n != nil && n != it.root; n = n.Parent {
+		if n.NextSibling != nil {
+			return n.NextSibling
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package cascadia
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestIter(t *testing.T) {
+	for _, test := range selectorTests {
+		s, err := Compile(test.Selector)
+		if err != nil {
+			t.Errorf("error compiling %q: %s", test.Selector, err)
+			continue
+		}
+
+		doc, err := html.Parse(strings.NewReader(test.HTML))
+		if err != nil {
+			t.Errorf("error parsing %q: %s", test.HTML, err)
+			continue
+		}
+
+		want := s.MatchAll(doc)
+		for _, it := range []*Iterator{s.Iter(doc), s.LiveIter(doc)} {
+			var got []*html.Node
+			for n := it.Next(); n != nil; n = it.Next() {
+				got = append(got, n)
+			}
+			if len(got) != len(want) {
+				t.Errorf("%s (live=%v): got %d matches, want %d", test.Selector, it.live, len(got), len(want))
+				continue
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Errorf("%s (live=%v): match %d: got %s, want %s", test.Selector, it.live, i, nodeString(got[i]), nodeString(want[i]))
+				}
+			}
+		}
+	}
+}
+
+const iterRemoveHTML = `<div id="a"><p id="1"><b id="2"></b></p><p id="3"></p></div><div id="b"><b id="4"></b><p id="5"></p></div><p id="6"></p>`
+
+// iterIDs returns the ids of the nodes returned by it, calling remove on
+// each of them first.
+func iterIDs(it *Iterator, remove func(n *html.Node)) string {
+	var ids []string
+	for n := it.Next(); n != nil; n = it.Next() {
+		ids = append(ids, attributeValue(n, "id"))
+		remove(n)
+	}
+	return strings.Join(ids, " ")
+}
+
+func removeNode(n *html.Node) {
+	if n.Parent != nil {
+		n.Parent.RemoveChild(n)
+	}
+}
+
+func TestIterRemove(t *testing.T) {
+	sel := MustCompile("p, b")
+
+	for _, test := range []struct {
+		live   bool
+		remove func(n *html.Node)
+		want   string
+	}{
+		{false, removeNode, "1 2 3 4 5 6"},
+		{true, removeNode, "1 3 4 5 6"},
+		{false, func(n *html.Node) { removeNode(n.Parent) }, "1 2 3 4 5 6"},
+		// Removing div#a while visiting p#1 detaches the rest of the walk
+		// from the document, so it ends after div#a's descendants.
+		{true, func(n *html.Node) { removeNode(n.Parent) }, "1 2 3"},
+	} {
+		doc, err := html.Parse(strings.NewReader(iterRemoveHTML))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var it *Iterator
+		if test.live {
+			it = sel.LiveIter(doc)
+		} else {
+			it = sel.Iter(doc)
+		}
+		got := iterIDs(it, test.remove)
+		if got != test.want {
+			t.Errorf("live=%v: got %q, want %q", test.live, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package cascadia
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Severity says how serious a Diagnostic is.
+type Severity int
+
+const (
+	// SeverityWarning marks a construct that was accepted, but probably
+	// doesn't do what its author intended.
+	SeverityWarning Severity = iota
+
+	// SeverityError marks a selector that could not be compiled.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// A Diagnostic is a problem found while compiling a selector.
+type Diagnostic struct {
+	Severity Severity
+
+	// Start and End are the byte offsets of the problem in the source
+	// text. For an error, they cover the whole member of the selector list
+	// that was dropped.
+	Start, End int
+
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d-%d: %v: %s", d.Start, d.End, d.Severity, d.Message)
+}
+
+// A LenientResult is the result of CompileLenient.
+type LenientResult struct {
+	// Group holds the members of the selector list that compiled.
+	Group SelectorGroup
+
+	// Diagnostics holds an error for each member that was dropped, and the
+	// warnings for the members that were kept, in source order.
+	Diagnostics []Diagnostic
+}
+
+// CompileLenient compiles a comma-separated selector list the way a
+// browser parses a forgiving selector list: a member that fails to compile
+// is dropped, instead of invalidating the whole list. It never fails, but
+// the result's Diagnostics record the members that were dropped, and
+// constructs that were accepted but never match, such as :hover or
+// [attr^=""].
+func CompileLenient(sel string) *LenientResult {
+	result := new(LenientResult)
+	for _, span := range splitSelectorList(sel) {
+		start, end := span[0], span[1]
+		p := &parser{s: sel[:end], i: start, opts: Options{DynamicPseudoclasses: true}}
+		p.skipWhitespace()
+		if p.i == end {
+			result.Diagnostics = append(result.Diagnostics, Diagnostic{SeverityError, start, end, "empty selector in selector group"})
+			continue
+		}
+
+		m, err := p.parseSelector()
+		if err == nil {
+			p.skipWhitespace()
+			if p.i < end {
+				err = fmt.Errorf("unexpected %q", sel[p.i:end])
+			}
+		}
+		if err != nil {
+			msg := err.Error()
+			if se, ok := err.(*SyntaxError); ok {
+				msg = se.Msg
+			}
+			result.Diagnostics = append(result.Diagnostics, Diagnostic{SeverityError, start, end, msg})
+			continue
+		}
+
+		result.Group = append(result.Group, compileSel(m))
+		result.Diagnostics = append(result.Diagnostics, p.warnings...)
+	}
+	return result
+}
+
+// splitSelectorList returns the start and end offsets of the members of a
+// comma-separated selector list, without parsing them. Commas inside
+// parentheses, brackets, strings and comments, and escaped commas, don't
+// separate members.
+func splitSelectorList(sel string) [][2]int {
+	spans, _ := scanSelectorList(sel, false)
+	return spans
+}
+
+// scanSelectorList is like splitSelectorList, but if nested is true, the
+// list ends at the first unmatched ')', as in the argument of a
+// pseudo-class. It also returns the offset where the list ends, which is
+// len(sel) if there is no such parenthesis.
+func scanSelectorList(sel string, nested bool) (spans [][2]int, end int) {
+	start, depth := 0, 0
+	for i := 0; i < len(sel); i++ {
+		switch c := sel[i]; c {
+		case '\\':
+			i++
+		case '"', '\'':
+			for i++; i < len(sel) && sel[i] != c; i++ {
+				if sel[i] == '\\' {
+					i++
+				}
+			}
+		case '/':
+			if strings.HasPrefix(sel[i:], "/*") {
+				if end := strings.Index(sel[i+2:], "*/"); end != -1 {
+					i += end + 3
+				} else {
+					i = len(sel)
+				}
+			}
+		case '(', '[':
+			depth++
+		case ')', ']':
+			if depth > 0 {
+				depth--
+			} else if nested && c == ')' {
+				return append(spans, [2]int{start, i}), i
+			}
+		case ',':
+			if depth == 0 {
+				spans = append(spans, [2]int{start, i})
+				start = i + 1
+			}
+		}
+	}
+	return append(spans, [2]int{start, len(sel)}), len(sel)
+}
@@ -0,0 +1,75 @@
+package cascadia
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestCompileLenient(t *testing.T) {
+	src := `p, div[=x], a:hover, [title^=""], :foo(x, y), span:not(.a, ), b[title="a,b"], , i /* , */`
+	result := CompileLenient(src)
+
+	doc, err := html.Parse(strings.NewReader(`<p></p><div></div><a></a><span></span><b title="a,b"></b><i></i>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tags []string
+	for _, n := range result.Group.MatchAll(doc) {
+		tags = append(tags, n.Data)
+	}
+	if got, want := strings.Join(tags, " "), "p b i"; got != want {
+		t.Errorf("matched %q, want %q", got, want)
+	}
+	if got, want := len(result.Group), 5; got != want {
+		t.Errorf("got %d members, want %d", got, want)
+	}
+
+	want := []struct {
+		severity Severity
+		text     string
+		message  string
+	}{
+		{SeverityError, " div[=x]", "expected identifier"},
+		{SeverityWarning, ":hover", "never matches"},
+		{SeverityWarning, `[title^=""]`, "never matches"},
+		{SeverityError, " :foo(x, y)", "unknown pseudoclass :foo"},
+		{SeverityError, " span:not(.a, )", "expected selector after ','"},
+		{SeverityError, " ", "empty selector"},
+	}
+	if len(result.Diagnostics) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d: %v", len(result.Diagnostics), len(want), result.Diagnostics)
+	}
+	for i, d := range result.Diagnostics {
+		w := want[i]
+		if d.Severity != w.severity || src[d.Start:d.End] != w.text || !strings.Contains(d.Message, w.message) {
+			t.Errorf("diagnostic %d: got %v (%q), want %v for %q containing %q", i, d, src[d.Start:d.End], w.severity, w.text, w.message)
+		}
+	}
+}
+
+func TestEmptyValueOperators(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p id="1" title=""></p><p id="2" title="x"></p><p id="3"></p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for sel, want := range map[string]int{
+		`[title^=""]`:  0,
+		`[title$=""]`:  0,
+		`[title*=""]`:  0,
+		`[title~=""]`:  0,
+		`[title=""]`:   1,
+		`[title|=""]`:  1,
+		`:hover`:       0,
+		`:not(:focus)`: 6,
+	} {
+		s, err := CompileWithOptions(sel, Options{DynamicPseudoclasses: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(s.MatchAll(doc)); got != want {
+			t.Errorf("%s: got %d matches, want %d", sel, got, want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package cascadia
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// A DocumentContext describes where a document is being viewed, which the
+// :visited, :target and :target-within pseudo-classes depend on. Without
+// one, they never match, as in Compile.
+//
+// A selector compiled with a DocumentContext keeps a pointer to it, so
+// changing its fields, such as setting Fragment after following a link,
+// affects later matches. It must not be changed while a selector that uses
+// it is being matched.
+//
+// The element that Fragment identifies is looked up once for each document
+// and remembered while Fragment stays the same, so that :target and
+// :target-within don't search the whole document for every element they
+// test. If a document is changed so that a different element becomes its
+// target, use a new DocumentContext to match against it.
+type DocumentContext struct {
+	// BaseURL is the URL that relative links are resolved against before
+	// they are passed to Visited. It should take any <base> element into
+	// account, as MatchAllResolvedAttr does. If it is nil, relative links
+	// are passed as they are.
+	BaseURL *url.URL
+
+	// Fragment is the fragment of the document's URL, without the '#'
+	// and with any percent-encoding decoded. The element it identifies is
+	// the one that :target matches; if several elements have it as their
+	// id, only the first in document order does, as in a browser. If it is
+	// empty, no element matches :target.
+	Fragment string
+
+	// Visited reports whether the URL of a link has been visited, for
+	// :visited and :link. If it is nil, no link has been visited.
+	Visited func(u *url.URL) bool
+
+	mu     sync.Mutex
+	target targetMemo
+}
+
+// targetMemo is the target that was last found in a document.
+type targetMemo struct {
+	root     *html.Node
+	fragment string
+	node     *html.Node
+}
+
+// findTarget returns the element that c.Fragment identifies in the document
+// containing n, using the one remembered for that document if there is one.
+func (c *DocumentContext) findTarget(n *html.Node) *html.Node {
+	root := n
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m := c.target; m.root == root && m.fragment == c.Fragment && (m.node == nil || mayBeTarget(m.node, c.Fragment) && (m.node == root || isAncestor(root, m.node))) {
+		return m.node
+	}
+	t := findTarget(root, c.Fragment)
+	c.target = targetMemo{root: root, fragment: c.Fragment, node: t}
+	return t
+}
+
+// linkSelector implements the pseudo-classes that depend on a
+// DocumentContext: :any-link, :link, :visited, :target and :target-within.
+// ctx is nil for :any-link and :link when no context was given.
+type linkSelector struct {
+	name string
+	ctx  *DocumentContext
+}
+
+func (s linkSelector) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	switch s.name {
+	case "any-link":
+		return isLink(n)
+	case "link":
+		return isLink(n) && !s.visited(n)
+	case "visited":
+		return isLink(n) && s.visited(n)
+	case "target":
+		return s.ctx.Fragment != "" && mayBeTarget(n, s.ctx.Fragment) && s.ctx.findTarget(n) == n
+	case "target-within":
+		if s.ctx.Fragment == "" {
+			return false
+		}
+		t := s.ctx.findTarget(n)
+		return t != nil && (t == n || isAncestor(n, t))
+	}
+	return false
+}
+
+// isLink returns whether n is a hyperlink: an a or area element with an
+// href attribute.
+func isLink(n *html.Node) bool {
+	return (n.Data == "a" || n.Data == "area") && n.Namespace == "" && (attrSelector{key: "href"}).Match(n)
+}
+
+// visited returns whether the link n has been visited, according to s.ctx.
+func (s linkSelector) visited(n *html.Node) bool {
+	if s.ctx == nil || s.ctx.Visited == nil {
+		return false
+	}
+	u, err := url.Parse(strings.TrimSpace(attributeValue(n, "href")))
+	if err != nil {
+		return false
+	}
+	if s.ctx.BaseURL != nil {
+		u = s.ctx.BaseURL.ResolveReference(u)
+	}
+	return s.ctx.Visited(u)
+}
+
+// mayBeTarget returns whether n could be the element that the fragment
+// identifies: whether it has the fragment as its id, or is an a element
+// with the fragment as its name.
+func mayBeTarget(n *html.Node, fragment string) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	return attributeValue(n, "id") == fragment || n.Data == "a" && attributeValue(n, "name") == fragment
+}
+
+// findTarget returns the element in the document containing n that the
+// fragment identifies, as in HTML: the first element with the fragment as
+// its id, or if there is none, the first a element with the fragment as its
+// name. It returns nil if there is no such element.
+func findTarget(n *html.Node, fragment string) *html.Node {
+	root := n
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	var named *html.Node
+	for c := root; c != nil; c = nextInSubtree(c, root) {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		if attributeValue(c, "id") == fragment {
+			return c
+		}
+		if named == nil && c.Data == "a" && attributeValue(c, "name") == fragment {
+			named = c
+		}
+	}
+	return named
+}
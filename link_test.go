@@ -0,0 +1,120 @@
+package cascadia
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestLinkPseudoclasses(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div id="d">
+		<a id="1" href="/seen">x</a><a id="2" href="other">y</a><a id="3">z</a>
+		<map><area id="4" href="https://elsewhere.example/"></map>
+		<section id="s"><p id="top"><a id="5" name="top"></a></p><a id="6" name="intro"></a></section>
+	</div><p id="top"></p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, _ := url.Parse("https://example.com/docs/page")
+	ctx := &DocumentContext{
+		BaseURL:  base,
+		Fragment: "top",
+		Visited: func(u *url.URL) bool {
+			return u.String() == "https://example.com/seen"
+		},
+	}
+
+	match := func(sel string) string {
+		s, err := CompileWithOptions(sel, Options{Context: ctx})
+		if err != nil {
+			t.Fatalf("%s: %s", sel, err)
+		}
+		var ids []string
+		for _, n := range s.MatchAll(doc) {
+			ids = append(ids, attributeValue(n, "id"))
+		}
+		return strings.Join(ids, " ")
+	}
+
+	for _, test := range []struct {
+		fragment string
+		sel      string
+		want     string
+	}{
+		{"top", `:any-link`, "1 2 4"},
+		{"top", `:link`, "2 4"},
+		{"top", `:visited`, "1"},
+		{"top", `:target`, "top"},
+		{"top", `[id]:target-within`, "d s top"},
+		{"intro", `:target`, "6"},
+		{"intro", `[id]:target-within`, "d s 6"},
+		{"missing", `:target, :target-within`, ""},
+		{"", `:target, :target-within`, ""},
+	} {
+		ctx.Fragment = test.fragment
+		if got := match(test.sel); got != test.want {
+			t.Errorf("%s with #%s: got %q, want %q", test.sel, test.fragment, got, test.want)
+		}
+	}
+}
+
+func TestLinkPseudoclassesWithoutContext(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<a id="1" href="/x"></a><p id="x"></p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := MustCompile(":link").MatchAll(doc); len(got) != 1 {
+		t.Errorf(":link: got %d matches, want 1", len(got))
+	}
+	for _, sel := range []string{":visited", ":target", ":target-within"} {
+		if !MustCompile(sel).NeverMatches() {
+			t.Errorf("%s: should never match without a context", sel)
+		}
+	}
+
+	// Without a Visited function, :visited still never matches.
+	s, err := CompileWithOptions(":visited", Options{Context: &DocumentContext{Fragment: "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.NeverMatches() {
+		t.Error(":visited should never match without a Visited function")
+	}
+}
+
+func TestTargetAcrossDocuments(t *testing.T) {
+	ctx := &DocumentContext{Fragment: "t"}
+	s, err := CompileWithOptions("[id]:target-within", Options{Context: ctx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := func(doc *html.Node) string {
+		var ids []string
+		for _, n := range s.MatchAll(doc) {
+			ids = append(ids, attributeValue(n, "id"))
+		}
+		return strings.Join(ids, " ")
+	}
+
+	first, _ := html.Parse(strings.NewReader(`<div id="a"><p id="t"></p></div><div id="b"></div>`))
+	second, _ := html.Parse(strings.NewReader(`<div id="a"></div><div id="b"><p id="t"></p></div>`))
+	if got := ids(first); got != "a t" {
+		t.Errorf("first document: got %q, want %q", got, "a t")
+	}
+	if got := ids(second); got != "b t" {
+		t.Errorf("second document: got %q, want %q", got, "b t")
+	}
+
+	// Removing the remembered target makes it be looked up again.
+	target := s.MatchFirst(first)
+	for target.FirstChild != nil {
+		target = target.FirstChild
+	}
+	target.Parent.RemoveChild(target)
+	if got := ids(first); got != "" {
+		t.Errorf("after removing the target: got %q, want none", got)
+	}
+}
@@ -0,0 +1,224 @@
+package cascadia
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// A MatcherSet matches many selectors against a document in a single walk,
+// as for a ruleset of scraping selectors. Like the members of a large
+// selector list, the selectors are indexed by the id, tag name or class of
+// their rightmost compound selector, so each node is only tested against
+// the selectors it could match.
+//
+// Selectors are identified by their index in the list the MatcherSet was
+// made from.
+type MatcherSet struct {
+	// Observer, if not nil, is notified of each call to Matching, MatchAll
+	// and Each. The Query's Selector is the canonical forms of the
+	// selectors, separated by commas. Observer should be set before the
+	// MatcherSet is used.
+	Observer QueryObserver
+
+	sels    []Sel
+	n       int
+	buckets map[selectorKey][]setMember
+	others  []setMember
+
+	sourceOnce sync.Once
+	source     string
+}
+
+// A setMember is a selector in a MatcherSet, without its key if it is in a
+// bucket.
+type setMember struct {
+	index int
+	rest  Sel // nil if the key is all there is to match
+}
+
+// NewMatcherSet returns a MatcherSet for sels, such as the results of Parse
+// or of functions like Tag and Combine.
+func NewMatcherSet(sels ...Sel) *MatcherSet {
+	m := &MatcherSet{sels: sels, n: len(sels), buckets: make(map[selectorKey][]setMember)}
+	for i, sel := range sels {
+		m.add(i, optimize(sel))
+	}
+	return m
+}
+
+// add adds sel to m with the index i. The members of a selector list are
+// added separately, so that each can go in its own bucket.
+func (m *MatcherSet) add(i int, sel Sel) {
+	if u, ok := sel.(unionSelector); ok {
+		for _, c := range u {
+			m.add(i, c)
+		}
+		return
+	}
+	switch c := withKey(sel).(type) {
+	case neverSelector:
+	case keyedSelector:
+		m.buckets[c.key] = append(m.buckets[c.key], setMember{i, c.rest})
+	default:
+		m.others = append(m.others, setMember{i, c})
+	}
+}
+
+// CompileMatcherSet parses each of sels, which may be selector lists, and
+// returns a MatcherSet for them. If one doesn't parse, the error says which.
+func CompileMatcherSet(sels ...string) (*MatcherSet, error) {
+	parsed := make([]Sel, len(sels))
+	for i, sel := range sels {
+		var err error
+		if parsed[i], err = Parse(sel); err != nil {
+			return nil, fmt.Errorf("selector %d: %w", i, err)
+		}
+	}
+	return NewMatcherSet(parsed...), nil
+}
+
+// Len returns the number of selectors in the set.
+func (m *MatcherSet) Len() int {
+	return m.n
+}
+
+// Matching returns the indexes of the selectors that match n, in increasing
+// order.
+func (m *MatcherSet) Matching(n *html.Node) []int {
+	q, start := m.start("Matching")
+	result := m.matchingInto(n, nil)
+	if q != nil {
+		q.Visited = 1
+		m.end(q, start, len(result))
+	}
+	return result
+}
+
+// start notifies the observer, if there is one, that a query is starting,
+// like ObservedSelector.start.
+func (m *MatcherSet) start(method string) (*Query, time.Time) {
+	if m.Observer == nil {
+		return nil, time.Time{}
+	}
+	m.sourceOnce.Do(func() {
+		sources := make([]string, len(m.sels))
+		for i, sel := range m.sels {
+			sources[i] = sel.String()
+		}
+		m.source = strings.Join(sources, ", ")
+	})
+	q := &Query{Selector: m.source, Method: method}
+	m.Observer.OnQueryStart(q)
+	return q, time.Now()
+}
+
+// end notifies the observer that the query q has finished.
+func (m *MatcherSet) end(q *Query, start time.Time, matched int) {
+	if q == nil {
+		return
+	}
+	q.Duration = time.Since(start)
+	q.Matched = matched
+	m.Observer.OnQueryEnd(q)
+}
+
+// matchingInto appends the indexes of the selectors that match n to dst, in
+// increasing order.
+func (m *MatcherSet) matchingInto(n *html.Node, dst []int) []int {
+	start := len(dst)
+	add := func(members []setMember) {
+		for _, c := range members {
+			if c.rest == nil || c.rest.Match(n) {
+				dst = append(dst, c.index)
+			}
+		}
+	}
+
+	if n.Type == html.ElementNode && len(m.buckets) > 0 {
+		add(m.buckets[selectorKey{'t', n.Data}])
+		for _, a := range n.Attr {
+			switch a.Key {
+			case "id":
+				add(m.buckets[selectorKey{'#', a.Val}])
+			case "class":
+				anyToken(a.Val, func(class string) bool {
+					add(m.buckets[selectorKey{'.', class}])
+					return false
+				})
+			}
+		}
+	}
+	add(m.others)
+
+	// A selector can match through more than one key, as with a selector
+	// list or a repeated class name, so the indexes are sorted and
+	// deduplicated.
+	found := dst[start:]
+	if len(found) > 1 {
+		sort.Ints(found)
+		j := 1
+		for i := 1; i < len(found); i++ {
+			if found[i] != found[j-1] {
+				found[j] = found[i]
+				j++
+			}
+		}
+		dst = dst[:start+j]
+	}
+	return dst
+}
+
+// MatchAll walks the tree rooted at root once, and returns the nodes that
+// match each selector: the result has an entry for each selector, holding
+// its matches in document order, or nil if it has none. For an Observer,
+// the number of nodes matched is the number that match any selector.
+func (m *MatcherSet) MatchAll(root *html.Node) [][]*html.Node {
+	q, start := m.start("MatchAll")
+	result := make([][]*html.Node, m.n)
+	var indexes []int
+	visited, matched := 0, 0
+	for n := root; n != nil; n = nextInSubtree(n, root) {
+		visited++
+		indexes = m.matchingInto(n, indexes[:0])
+		if len(indexes) > 0 {
+			matched++
+		}
+		for _, i := range indexes {
+			result[i] = append(result[i], n)
+		}
+	}
+	if q != nil {
+		q.Visited = visited
+		m.end(q, start, matched)
+	}
+	return result
+}
+
+// Each walks the tree rooted at root once, and calls fn for each node that
+// matches at least one of the selectors, with the indexes of the ones it
+// matches, in increasing order. The slice is reused for the next node, so
+// fn must copy it to keep it. If fn returns false, Each stops.
+func (m *MatcherSet) Each(root *html.Node, fn func(n *html.Node, indexes []int) bool) {
+	q, start := m.start("Each")
+	var indexes []int
+	visited, matched := 0, 0
+	for n := root; n != nil; n = nextInSubtree(n, root) {
+		visited++
+		indexes = m.matchingInto(n, indexes[:0])
+		if len(indexes) > 0 {
+			matched++
+			if !fn(n, indexes) {
+				break
+			}
+		}
+	}
+	if q != nil {
+		q.Visited = visited
+		m.end(q, start, matched)
+	}
+}
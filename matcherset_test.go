@@ -0,0 +1,74 @@
+package cascadia
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestMatcherSet(t *testing.T) {
+	sels := make([]string, 0, len(selectorTests)+3)
+	for _, test := range selectorTests {
+		sels = append(sels, test.Selector)
+	}
+	// A selector that never matches, and one whose members are in different
+	// buckets.
+	sels = append(sels, ":visited", "p.a, #foo, span")
+
+	set, err := CompileMatcherSet(sels...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Len() != len(sels) {
+		t.Errorf("Len: got %d, want %d", set.Len(), len(sels))
+	}
+
+	for _, test := range selectorTests {
+		doc, err := html.Parse(strings.NewReader(test.HTML))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := set.MatchAll(doc)
+		for i, sel := range sels {
+			if want := MustCompile(sel).MatchAll(doc); !reflect.DeepEqual(got[i], want) {
+				t.Errorf("%s in %s: got %d matches, want %d", sel, test.HTML, len(got[i]), len(want))
+			}
+		}
+	}
+}
+
+func TestMatcherSetMatching(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p id="x" class="a b a">text</p><div class="b"></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := CompileMatcherSet(`.a`, `div`, `p, .b`, `:not(div)`, `#x.b`, `.c`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := MustCompile("p").MatchFirst(doc)
+	if got, want := set.Matching(p), []int{0, 2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Matching: got %v, want %v", got, want)
+	}
+	if got := set.Matching(p.FirstChild); got != nil {
+		t.Errorf("Matching a text node: got %v, want none", got)
+	}
+
+	var nodes []string
+	set.Each(doc, func(n *html.Node, indexes []int) bool {
+		nodes = append(nodes, n.Data)
+		return n.Data != "p"
+	})
+	if got, want := strings.Join(nodes, " "), "html head body p"; got != want {
+		t.Errorf("Each: got %q, want %q", got, want)
+	}
+
+	_, err = CompileMatcherSet("p", "div[")
+	var syntaxErr *SyntaxError
+	if err == nil || !strings.HasPrefix(err.Error(), "selector 1: ") || !errors.As(err, &syntaxErr) {
+		t.Errorf("got error %v, want a SyntaxError for selector 1", err)
+	}
+}
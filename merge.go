@@ -0,0 +1,166 @@
+package cascadia
+
+import (
+	"container/heap"
+	"sort"
+
+	"golang.org/x/net/html"
+)
+
+// MergeMatches merges lists of nodes that are each in document order, such
+// as the results of MatchAll on different subtrees of a document, into a
+// single list in document order, with each node included only once. The
+// lists may overlap. All the nodes must be in the same tree.
+func MergeMatches(lists ...[]*html.Node) []*html.Node {
+	h := &mergeHeap{order: new(documentOrder)}
+	total := 0
+	for _, l := range lists {
+		if len(l) > 0 {
+			h.lists = append(h.lists, l)
+			total += len(l)
+		}
+	}
+	heap.Init(h)
+
+	result := make([]*html.Node, 0, total)
+	seen := make(map[*html.Node]bool, total)
+	for len(h.lists) > 0 {
+		n := h.lists[0][0]
+		if !seen[n] {
+			seen[n] = true
+			result = append(result, n)
+		}
+		if h.lists[0] = h.lists[0][1:]; len(h.lists[0]) == 0 {
+			heap.Pop(h)
+		} else {
+			heap.Fix(h, 0)
+		}
+	}
+	return result
+}
+
+// SortDocumentOrder returns a copy of nodes sorted into document order
+// within the tree rooted at root, such as to combine the results of several
+// queries. Duplicates are kept; use MergeMatches to merge lists that are
+// already sorted, dropping duplicates. Nodes that are not root or its
+// descendants go at the end, in their original order.
+//
+// SortDocumentOrder walks the whole tree to number its nodes, so it is best
+// suited to sorting many nodes at once.
+func SortDocumentOrder(root *html.Node, nodes []*html.Node) []*html.Node {
+	position := make(map[*html.Node]int)
+	i := 0
+	for n := root; n != nil; n = nextInSubtree(n, root) {
+		position[n] = i
+		i++
+	}
+	key := func(n *html.Node) int {
+		if p, ok := position[n]; ok {
+			return p
+		}
+		return i
+	}
+
+	result := append([]*html.Node(nil), nodes...)
+	sort.SliceStable(result, func(a, b int) bool {
+		return key(result[a]) < key(result[b])
+	})
+	return result
+}
+
+// mergeHeap is a heap of node lists, ordered by their first nodes.
+type mergeHeap struct {
+	lists [][]*html.Node
+	order *documentOrder
+}
+
+func (h *mergeHeap) Len() int { return len(h.lists) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	return h.order.compare(h.lists[i][0], h.lists[j][0]) < 0
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.lists[i], h.lists[j] = h.lists[j], h.lists[i] }
+
+func (h *mergeHeap) Push(x interface{}) { h.lists = append(h.lists, x.([]*html.Node)) }
+
+func (h *mergeHeap) Pop() interface{} {
+	x := h.lists[len(h.lists)-1]
+	h.lists = h.lists[:len(h.lists)-1]
+	return x
+}
+
+// A documentOrder compares nodes by their position in a document. It
+// caches the positions of nodes among their siblings, so that comparing
+// many nodes with the same parent doesn't scan the siblings each time.
+// It must not be used after the tree is modified.
+type documentOrder struct {
+	position map[*html.Node]int
+}
+
+// siblingPosition returns the position of n among its parent's children.
+func (o *documentOrder) siblingPosition(n *html.Node) int {
+	if p, ok := o.position[n]; ok {
+		return p
+	}
+	if o.position == nil {
+		o.position = make(map[*html.Node]int)
+	}
+	i := 0
+	for c := n.Parent.FirstChild; c != nil; c = c.NextSibling {
+		o.position[c] = i
+		i++
+	}
+	return o.position[n]
+}
+
+// compareDocumentOrder returns -1 if a comes before b in document order
+// (a pre-order walk of the tree), 1 if it comes after, and 0 if they are
+// the same node. An ancestor comes before its descendants. Nodes in
+// different trees compare as equal.
+func compareDocumentOrder(a, b *html.Node) int {
+	return new(documentOrder).compare(a, b)
+}
+
+// compare is like compareDocumentOrder, using the cached positions.
+func (o *documentOrder) compare(a, b *html.Node) int {
+	if a == b {
+		return 0
+	}
+
+	depth := func(n *html.Node) int {
+		d := 0
+		for ; n.Parent != nil; n = n.Parent {
+			d++
+		}
+		return d
+	}
+	da, db := depth(a), depth(b)
+
+	// Bring both nodes to the same depth.
+	for ; da > db; da-- {
+		if a.Parent == b {
+			return 1
+		}
+		a = a.Parent
+	}
+	for ; db > da; db-- {
+		if b.Parent == a {
+			return -1
+		}
+		b = b.Parent
+	}
+
+	// Climb until the nodes are siblings.
+	for a.Parent != b.Parent {
+		a, b = a.Parent, b.Parent
+	}
+	if a.Parent == nil {
+		return 0
+	}
+
+	if o.siblingPosition(a) < o.siblingPosition(b) {
+		return -1
+	}
+	return 1
+}
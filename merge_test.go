@@ -0,0 +1,133 @@
+package cascadia
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestCompareDocumentOrder(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div><p><b></b></p><p></p></div><span></span>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := MustCompile("*").MatchAll(doc)
+	for i, a := range all {
+		for j, b := range all {
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := compareDocumentOrder(a, b); got != want {
+				t.Errorf("compare(%s #%d, %s #%d): got %d, want %d", nodeString(a), i, nodeString(b), j, got, want)
+			}
+		}
+	}
+}
+
+// mergeOracle merges lists by concatenating, sorting and removing
+// duplicates.
+func mergeOracle(lists [][]*html.Node) []*html.Node {
+	var all []*html.Node
+	for _, l := range lists {
+		all = append(all, l...)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return compareDocumentOrder(all[i], all[j]) < 0
+	})
+	var result []*html.Node
+	for i, n := range all {
+		if i == 0 || n != all[i-1] {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+func TestMergeMatches(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(strings.Repeat(`<div><p><b>x</b><i></i></p><ul><li></li><li><a></a></li></ul></div>`, 5)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subtrees := MustCompile("div, p, ul, li").MatchAll(doc)
+	selectors := []Selector{MustCompile("*"), MustCompile("li, b"), MustCompile("p ~ *"), MustCompile(":empty")}
+
+	r := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 200; trial++ {
+		lists := make([][]*html.Node, r.Intn(6))
+		for i := range lists {
+			root := subtrees[r.Intn(len(subtrees))]
+			lists[i] = selectors[r.Intn(len(selectors))].MatchAll(root)
+		}
+
+		got := MergeMatches(lists...)
+		want := mergeOracle(lists)
+		if len(got) != len(want) {
+			t.Fatalf("trial %d: got %d nodes, want %d", trial, len(got), len(want))
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("trial %d: node %d: got %s, want %s", trial, i, nodeString(got[i]), nodeString(want[i]))
+			}
+		}
+	}
+
+	if got := MergeMatches(); len(got) != 0 {
+		t.Errorf("merging nothing: got %d nodes", len(got))
+	}
+}
+
+func BenchmarkMergeMatches(b *testing.B) {
+	rows := MustCompile("div.row").MatchAll(largeDoc)
+	all := MustCompile("*")
+	var lists [][]*html.Node
+	for i := 0; i+100 <= len(rows); i += 50 {
+		var l []*html.Node
+		for _, row := range rows[i : i+100] {
+			l = append(l, all.MatchAll(row)...)
+		}
+		lists = append(lists, l)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		MergeMatches(lists...)
+	}
+}
+
+func TestSortDocumentOrder(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div><p><b></b></p><p></p></div><span></span>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := MustCompile("*").MatchAll(doc)
+	body := MustCompile("body").MatchFirst(doc)
+	outside := MustCompile("head").MatchFirst(doc)
+	orphan := &html.Node{Type: html.ElementNode, Data: "em"}
+
+	shuffled := append([]*html.Node(nil), all...)
+	rand.New(rand.NewSource(1)).Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	got := SortDocumentOrder(doc, shuffled)
+	for i := range all {
+		if got[i] != all[i] {
+			t.Fatalf("node %d: got %s, want %s", i, nodeString(got[i]), nodeString(all[i]))
+		}
+	}
+
+	// Duplicates are kept, and nodes outside root go last.
+	p := MustCompile("p").MatchFirst(doc)
+	got = SortDocumentOrder(body, []*html.Node{orphan, p, outside, body, p})
+	want := []*html.Node{body, p, p, orphan, outside}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("with duplicates, node %d: got %s, want %s", i, nodeString(got[i]), nodeString(want[i]))
+		}
+	}
+}
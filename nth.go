@@ -0,0 +1,185 @@
+package cascadia
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// the structural position helpers used by :nth-child and friends
+
+// nthIndex returns the 1-based position of n among its parent's element
+// children, or 0 if n isn't an element or has no parent.
+// If last is true, positions are counted from the last child instead.
+// If ofType is true, only siblings with the same tag name as n are counted.
+func nthIndex(n *html.Node, last, ofType bool) int {
+	if n.Type != html.ElementNode {
+		return 0
+	}
+
+	if n.Parent == nil {
+		return 0
+	}
+
+	// Count the siblings on the side that the positions start from.
+	next := func(c *html.Node) *html.Node { return c.PrevSibling }
+	if last {
+		next = func(c *html.Node) *html.Node { return c.NextSibling }
+	}
+	i := 1
+	for c := next(n); c != nil; c = next(c) {
+		if c.Type == html.ElementNode && (!ofType || c.Data == n.Data) {
+			i++
+		}
+	}
+	return i
+}
+
+// nthIndexMatching is like nthIndex, but it only counts the siblings that
+// match f. n itself is assumed to match.
+func nthIndexMatching(n *html.Node, last bool, f func(*html.Node) bool) int {
+	next := func(c *html.Node) *html.Node { return c.PrevSibling }
+	if last {
+		next = func(c *html.Node) *html.Node { return c.NextSibling }
+	}
+	i := 1
+	for c := next(n); c != nil; c = next(c) {
+		if c.Type == html.ElementNode && f(c) {
+			i++
+		}
+	}
+	return i
+}
+
+// hasSibling returns whether n has an element sibling before it, or after it
+// if after is true. If ofType is true, only siblings with the same tag name
+// as n count.
+func hasSibling(n *html.Node, after, ofType bool) bool {
+	next := func(c *html.Node) *html.Node { return c.PrevSibling }
+	if after {
+		next = func(c *html.Node) *html.Node { return c.NextSibling }
+	}
+	for c := next(n); c != nil; c = next(c) {
+		if c.Type == html.ElementNode && (!ofType || c.Data == n.Data) {
+			return true
+		}
+	}
+	return false
+}
+
+// anbMatches returns whether the 1-based position i satisfies an+b for some
+// non-negative integer n.
+func anbMatches(a, b, i int) bool {
+	i -= b
+	if a == 0 {
+		return i == 0
+	}
+
+	return i%a == 0 && i/a >= 0
+}
+
+// NthIndex returns the 1-based position of n among its parent's element
+// children, as used by :nth-child. It returns 0 if n isn't an element or has
+// no parent.
+func NthIndex(n *html.Node) int {
+	return nthIndex(n, false, false)
+}
+
+// NthLastIndex is like NthIndex, but counts from the last child, as used by
+// :nth-last-child.
+func NthLastIndex(n *html.Node) int {
+	return nthIndex(n, true, false)
+}
+
+// NthIndexOfType is like NthIndex, but only counts siblings with the same tag
+// name as n, as used by :nth-of-type.
+func NthIndexOfType(n *html.Node) int {
+	return nthIndex(n, false, true)
+}
+
+// NthLastIndexOfType is like NthIndexOfType, but counts from the last
+// sibling, as used by :nth-last-of-type.
+func NthLastIndexOfType(n *html.Node) int {
+	return nthIndex(n, true, true)
+}
+
+// An ANB is an expression of the form an+b, as used in the argument of
+// :nth-child.
+type ANB struct {
+	A, B int
+}
+
+// ParseANB parses an an+b expression, such as "2n+1", "-n+3", "odd" or "5".
+func ParseANB(s string) (ANB, error) {
+	p := &parser{s: strings.TrimSpace(s)}
+	a, b, err := p.parseNth()
+	if err != nil {
+		return ANB{}, err
+	}
+
+	if p.i < len(p.s) {
+		return ANB{}, p.errorf(p.i, "unexpected %s in an+b expression", p.nextToken())
+	}
+
+	return ANB{a, b}, nil
+}
+
+// Matches returns whether the 1-based position pos is selected by x.
+func (x ANB) Matches(pos int) bool {
+	return anbMatches(x.A, x.B, pos)
+}
+
+// Eq returns the node at index i in nodes, such as the result of MatchAll,
+// like jQuery's eq method. A negative i counts from the end, so -1 is the
+// last node. If i is out of range, Eq returns nil.
+func Eq(nodes []*html.Node, i int) *html.Node {
+	if i < 0 {
+		i += len(nodes)
+	}
+	if i < 0 || i >= len(nodes) {
+		return nil
+	}
+	return nodes[i]
+}
+
+// NthWithinEach returns a function that finds the elements matching
+// container, from a node and its children, and returns the index'th
+// descendant of each one that matches item (counting from 1, in document
+// order). Containers that have fewer than index matching descendants are
+// skipped. Nested containers are searched independently, so an item inside
+// both counts toward each of them.
+func NthWithinEach(container, item Selector, index int) func(*html.Node) []*html.Node {
+	return func(root *html.Node) []*html.Node {
+		if index < 1 {
+			return nil
+		}
+		var result []*html.Node
+		for _, c := range container.MatchAll(root) {
+			if n := nthDescendantMatch(c, item, index); n != nil {
+				result = append(result, n)
+			}
+		}
+		return result
+	}
+}
+
+// nthDescendantMatch returns the index'th descendant of n that matches s,
+// or nil if there aren't that many.
+func nthDescendantMatch(n *html.Node, s Selector, index int) *html.Node {
+	var found *html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil && found == nil; c = c.NextSibling {
+			if s(c) {
+				index--
+				if index == 0 {
+					found = c
+					return
+				}
+			}
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
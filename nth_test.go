@@ -0,0 +1,223 @@
+package cascadia
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+var anbTests = map[string]ANB{
+	"odd":   {2, 1},
+	"EVEN":  {2, 0},
+	"2n+1":  {2, 1},
+	"-n+3":  {-1, 3},
+	"3":     {0, 3},
+	"n":     {1, 0},
+	" 4n ":  {4, 0},
+	"n - 2": {1, -2},
+	"2n":    {2, 0},
+	"+n":    {1, 0},
+	"-n":    {-1, 0},
+	"+3":    {0, 3},
+	"-3":    {0, -3},
+	"-2n+5": {-2, 5},
+	"2N+1":  {2, 1},
+	"n+ 2":  {1, 2},
+	"+3n+1": {3, 1},
+	"+3N-1": {3, -1},
+	"n+0":   {1, 0},
+	"+0n+5": {0, 5},
+	"2n -1": {2, -1},
+	"0n+0":  {0, 0},
+	"Odd":   {2, 1},
+}
+
+func TestParseNthChild(t *testing.T) {
+	for source, want := range anbTests {
+		for _, pseudo := range []string{"nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type"} {
+			sel := ":" + pseudo + "(" + source + ")"
+			p := &parser{s: sel}
+			m, err := p.parse()
+			if err != nil {
+				t.Errorf("parsing %q: %s", sel, err)
+				continue
+			}
+			c, ok := m.(compoundSelector)
+			if !ok || len(c) != 1 {
+				t.Errorf("parsing %q: got %#v, want a single pseudo-class", sel, m)
+				continue
+			}
+			nth, ok := c[0].(nthChildSelector)
+			if !ok {
+				t.Errorf("parsing %q: got %#v, want nthChildSelector", sel, c[0])
+				continue
+			}
+			if got := (ANB{nth.a, nth.b}); got != want {
+				t.Errorf("parsing %q: got %v, want %v", sel, got, want)
+			}
+		}
+	}
+}
+
+// invalidNthTests maps invalid :nth-child() arguments to the expected error
+// message and its offset in ":nth-child(" + argument + ")".
+var invalidNthTests = map[string]struct {
+	msg    string
+	offset int
+}{
+	"":      {`expected an+b expression, found ")" instead`, 11},
+	"2x+1":  {`unexpected "x+1" in :nth-child() argument`, 12},
+	"+ n":   {`expected an+b expression, found " " instead`, 12},
+	"- n":   {`expected an+b expression, found " " instead`, 12},
+	"n-":    {`expected integer, found ")" instead`, 13},
+	"2n+-1": {`expected integer, found "-1" instead`, 14},
+	"3 n":   {`unexpected "n" in :nth-child() argument`, 13},
+	"odd x": {`unexpected "x" in :nth-child() argument`, 15},
+	"oddly": {`expected 'odd' or 'even', but found 'oddly' instead`, 11},
+	"++n":   {`expected an+b expression, found "+n" instead`, 12},
+	"+-3":   {`expected an+b expression, found "-3" instead`, 12},
+	"2n of": {`unexpected "of" in :nth-child() argument`, 14},
+	"1 of ": {`expected identifier, found ) instead`, 16},
+	"2 ofx": {`unexpected "ofx" in :nth-child() argument`, 13},
+}
+
+func TestInvalidNthChild(t *testing.T) {
+	for arg, want := range invalidNthTests {
+		sel := ":nth-child(" + arg + ")"
+		_, err := Compile(sel)
+		se, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("%s: got error %v, want a *SyntaxError", sel, err)
+			continue
+		}
+		if se.Msg != want.msg || se.Offset != want.offset {
+			t.Errorf("%s: got %q at offset %d, want %q at offset %d", sel, se.Msg, se.Offset, want.msg, want.offset)
+		}
+	}
+}
+
+func TestParseANB(t *testing.T) {
+	for source, want := range anbTests {
+		got, err := ParseANB(source)
+		if err != nil {
+			t.Errorf("parsing %q: got error (%s), want %v", source, err, want)
+			continue
+		}
+		if got != want {
+			t.Errorf("parsing %q: got %v, want %v", source, got, want)
+		}
+	}
+
+	for _, source := range []string{"", "2x", "n+", "odd2"} {
+		if got, err := ParseANB(source); err == nil {
+			t.Errorf("parsing %q: got %v, want error", source, got)
+		}
+	}
+}
+
+func TestNthIndex(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<table><tr><td id="1"></td><th></th><td id="2"></td>text<td id="3"></td></tr></table>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	odd := ANB{2, 1}
+	for i, td := range MustCompile("td").MatchAll(doc) {
+		want := [][4]int{{1, 4, 1, 3}, {3, 2, 2, 2}, {4, 1, 3, 1}}[i]
+		got := [4]int{NthIndex(td), NthLastIndex(td), NthIndexOfType(td), NthLastIndexOfType(td)}
+		if got != want {
+			t.Errorf("td %d: got %v, want %v", i+1, got, want)
+		}
+		if odd.Matches(NthIndex(td)) != MustCompile(":nth-child(odd)").Match(td) {
+			t.Errorf("td %d: ANB.Matches disagrees with :nth-child(odd)", i+1)
+		}
+	}
+
+	if got := NthIndex(doc); got != 0 {
+		t.Errorf("document node: got %d, want 0", got)
+	}
+}
+
+func TestFirstLastChild(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div>text<span id="a"></span><!-- c --><p id="b"></p><p id="c"></p><span id="d"></span>text</div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"div > :first-child":       "a",
+		"div > :last-child":        "d",
+		"p:first-of-type":          "b",
+		"p:last-of-type":           "c",
+		"span:first-of-type":       "a",
+		"span:last-of-type":        "d",
+		"p:first-child":            "",
+		"p:last-child":             "",
+		"div > :nth-child(1)":      "a",
+		"div > :nth-last-child(1)": "d",
+		"div > :nth-child(odd)":    "a c",
+		"div > :nth-child(EVEN)":   "b d",
+	}
+	for sel, want := range tests {
+		var ids []string
+		for _, n := range MustCompile(sel).MatchAll(doc) {
+			ids = append(ids, attributeValue(n, "id"))
+		}
+		if got := strings.Join(ids, " "); got != want {
+			t.Errorf("%s: got %q, want %q", sel, got, want)
+		}
+	}
+
+	if MustCompile(":first-child").Match(doc) {
+		t.Error(":first-child matched the document node")
+	}
+}
+
+func TestEq(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p id="0"></p><p id="1"></p><p id="2"></p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := MustCompile("p").MatchAll(doc)
+
+	for i, want := range map[int]string{0: "0", 2: "2", -1: "2", -3: "0", 3: "", -4: ""} {
+		got := ""
+		if n := Eq(nodes, i); n != nil {
+			got = attributeValue(n, "id")
+		}
+		if got != want {
+			t.Errorf("Eq(nodes, %d): got %q, want %q", i, got, want)
+		}
+	}
+	if n := Eq(nil, -1); n != nil {
+		t.Errorf("Eq(nil, -1): got %s, want nil", nodeString(n))
+	}
+}
+
+func TestNthWithinEach(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`
+		<div class="list" id="l1"><p class="item" id="1"></p><div><p class="item" id="2"></p></div><p class="item" id="3"></p></div>
+		<div class="list" id="l2"><p class="item" id="4"></p></div>
+		<div class="list" id="l3"><p class="item" id="5"></p><div class="list" id="l4"><p class="item" id="6"></p><p class="item" id="7"></p></div></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, item := MustCompile(".list"), MustCompile(".item")
+	for index, want := range map[int]string{
+		0: "",
+		1: "1 4 5 6",
+		2: "2 6 7",
+		3: "3 7",
+		4: "",
+	} {
+		var ids []string
+		for _, n := range NthWithinEach(list, item, index)(doc) {
+			ids = append(ids, attributeValue(n, "id"))
+		}
+		if got := strings.Join(ids, " "); got != want {
+			t.Errorf("index %d: got %q, want %q", index, got, want)
+		}
+	}
+}
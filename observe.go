@@ -0,0 +1,241 @@
+package cascadia
+
+import (
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// A QueryObserver is notified when an ObservedSelector or a MatcherSet runs
+// a query, so that queries can be timed, logged or recorded in a tracing
+// system without this package depending on one. Selectors from a Cache can
+// be observed with Cache.GetObserved.
+//
+// OnQueryStart and OnQueryEnd are called with the same *Query, on the
+// goroutine that runs the query. OnQueryStart may set q.Data, for example
+// to a span that OnQueryEnd finishes.
+type QueryObserver interface {
+	OnQueryStart(q *Query)
+	OnQueryEnd(q *Query)
+}
+
+// A Query describes one call to a method of an ObservedSelector. The fields
+// after Method are filled in before OnQueryEnd is called.
+type Query struct {
+	// Selector is the canonical form of the selector, as returned by
+	// Sel.String.
+	Selector string
+
+	// Method is the name of the method that was called, such as
+	// "MatchAll" or "MatchFirst".
+	Method string
+
+	// Visited is the number of nodes the selector was tested against,
+	// and Matched is the number of nodes returned.
+	Visited, Matched int
+
+	Duration time.Duration
+
+	// Data is for the use of the observer.
+	Data interface{}
+}
+
+// An ObservedSelector is a compiled selector that reports each query it runs
+// to the QueryObserver it was compiled with. Without an observer, it runs
+// queries just like a Selector does.
+//
+// Every method that walks a tree is a query: the matching methods of
+// Selector, the routing methods of SelectorGroup (whose members are those
+// of the selector list), and MatchAllIndexed.
+type ObservedSelector struct {
+	m        Sel
+	sel      Selector
+	group    SelectorGroup
+	needles  []string
+	source   string
+	observer QueryObserver
+}
+
+// CompileObserved is like CompileWithOptions, but it returns an
+// ObservedSelector, which reports its queries to observer. sel may be a
+// selector list.
+func CompileObserved(sel string, opts Options, observer QueryObserver) (*ObservedSelector, error) {
+	p := &parser{s: sel, opts: opts}
+	m, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	s := newObservedSelector(m, compileSel(m))
+	if observer != nil {
+		s.observe(observer)
+	}
+	return s, nil
+}
+
+// newObservedSelector returns an ObservedSelector for m, whose compiled form
+// is sel, without an observer.
+func newObservedSelector(m Sel, sel Selector) *ObservedSelector {
+	s := &ObservedSelector{m: m, sel: sel}
+	members := []Sel{m}
+	if u, ok := m.(unionSelector); ok {
+		members = u
+	}
+	s.group = make(SelectorGroup, len(members))
+	for i, c := range members {
+		s.group[i] = compileSel(c)
+	}
+	collectNeedles(m, &s.needles)
+	return s
+}
+
+// observe makes s report its queries to observer.
+func (s *ObservedSelector) observe(observer QueryObserver) {
+	s.observer = observer
+	if s.source == "" {
+		s.source = s.m.String()
+	}
+}
+
+// start notifies the observer that a query is starting, and returns the
+// Query and the time it started. If there is no observer, the Query is nil.
+func (s *ObservedSelector) start(method string) (*Query, time.Time) {
+	if s.observer == nil {
+		return nil, time.Time{}
+	}
+	q := &Query{Selector: s.source, Method: method}
+	s.observer.OnQueryStart(q)
+	return q, time.Now()
+}
+
+// counting returns a Selector that matches like sel and counts the nodes it
+// is tested against in q.Visited. If q is nil, it returns sel.
+func counting(q *Query, sel Selector) Selector {
+	if q == nil || sel.NeverMatches() {
+		return sel
+	}
+	return func(n *html.Node) bool {
+		q.Visited++
+		return sel(n)
+	}
+}
+
+// end notifies the observer that the query q has finished.
+func (s *ObservedSelector) end(q *Query, start time.Time, matched int) {
+	if q == nil {
+		return
+	}
+	q.Duration = time.Since(start)
+	q.Matched = matched
+	s.observer.OnQueryEnd(q)
+}
+
+// MatchAll is like Selector.MatchAll.
+func (s *ObservedSelector) MatchAll(n *html.Node) []*html.Node {
+	q, start := s.start("MatchAll")
+	result := counting(q, s.sel).MatchAll(n)
+	s.end(q, start, len(result))
+	return result
+}
+
+// MatchFirst is like Selector.MatchFirst.
+func (s *ObservedSelector) MatchFirst(n *html.Node) *html.Node {
+	q, start := s.start("MatchFirst")
+	result := counting(q, s.sel).MatchFirst(n)
+	matched := 0
+	if result != nil {
+		matched = 1
+	}
+	s.end(q, start, matched)
+	return result
+}
+
+// MatchAllInto is like Selector.MatchAllInto.
+func (s *ObservedSelector) MatchAllInto(n *html.Node, dst []*html.Node) []*html.Node {
+	q, start := s.start("MatchAllInto")
+	result := counting(q, s.sel).MatchAllInto(n, dst)
+	s.end(q, start, len(result)-len(dst))
+	return result
+}
+
+// MatchN is like Selector.MatchN.
+func (s *ObservedSelector) MatchN(n *html.Node, max int) []*html.Node {
+	q, start := s.start("MatchN")
+	result := counting(q, s.sel).MatchN(n, max)
+	s.end(q, start, len(result))
+	return result
+}
+
+// EachMatch is like Selector.EachMatch. The query ends when EachMatch
+// returns, so its Duration includes the time spent in fn.
+func (s *ObservedSelector) EachMatch(n *html.Node, fn func(*html.Node) bool) {
+	s.eachMatch("EachMatch", n, fn)
+}
+
+func (s *ObservedSelector) eachMatch(method string, n *html.Node, fn func(*html.Node) bool) {
+	q, start := s.start(method)
+	if q == nil {
+		s.sel.EachMatch(n, fn)
+		return
+	}
+	matched := 0
+	counting(q, s.sel).EachMatch(n, func(c *html.Node) bool {
+		matched++
+		return fn(c)
+	})
+	s.end(q, start, matched)
+}
+
+// Iter is like Selector.Iter. The matches are collected when Iter is
+// called, so that is when the query runs.
+func (s *ObservedSelector) Iter(n *html.Node) *Iterator {
+	q, start := s.start("Iter")
+	nodes := counting(q, s.sel).MatchAll(n)
+	s.end(q, start, len(nodes))
+	return &Iterator{s: s.sel, root: n, nodes: nodes}
+}
+
+// Route is like SelectorGroup.Route, with the members of the selector list
+// as the group.
+func (s *ObservedSelector) Route(root *html.Node) []Routed {
+	return s.route("Route", root, false)
+}
+
+// RouteNested is like SelectorGroup.RouteNested, with the members of the
+// selector list as the group.
+func (s *ObservedSelector) RouteNested(root *html.Node) []Routed {
+	return s.route("RouteNested", root, true)
+}
+
+func (s *ObservedSelector) route(method string, root *html.Node, nested bool) []Routed {
+	q, start := s.start(method)
+	g := s.group
+	if q != nil {
+		// Every node that is visited is tested against the first member,
+		// so counting its tests counts the nodes.
+		g = append(SelectorGroup{counting(q, g[0])}, g[1:]...)
+	}
+	result := g.route(root, nested, nil)
+	s.end(q, start, len(result))
+	return result
+}
+
+// Filter is like Selector.Filter.
+func (s *ObservedSelector) Filter(nodes []*html.Node) []*html.Node {
+	q, start := s.start("Filter")
+	result := counting(q, s.sel).Filter(nodes)
+	s.end(q, start, len(result))
+	return result
+}
+
+// MatchAllIndexed is like IndexedSelector.MatchAll. The time spent building
+// the text index is included in the query's Duration.
+func (s *ObservedSelector) MatchAllIndexed(n *html.Node) []*html.Node {
+	q, start := s.start("MatchAllIndexed")
+	sel := s.sel
+	if len(s.needles) > 0 {
+		sel = withTextIndex(s.m, buildTextIndex(n, s.needles)).Match
+	}
+	result := counting(q, sel).MatchAll(n)
+	s.end(q, start, len(result))
+	return result
+}
@@ -0,0 +1,226 @@
+package cascadia
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// A fakeSpan stands in for a span in a tracing system.
+type fakeSpan struct {
+	name  string
+	attrs map[string]interface{}
+}
+
+// A spanRecorder is a QueryObserver that records a span for each query, as
+// an adapter for a tracing system would.
+type spanRecorder struct {
+	finished []*fakeSpan
+}
+
+func (r *spanRecorder) OnQueryStart(q *Query) {
+	q.Data = &fakeSpan{
+		name:  "cascadia." + q.Method,
+		attrs: map[string]interface{}{"selector": q.Selector},
+	}
+}
+
+func (r *spanRecorder) OnQueryEnd(q *Query) {
+	span := q.Data.(*fakeSpan)
+	span.attrs["visited"] = q.Visited
+	span.attrs["matched"] = q.Matched
+	r.finished = append(r.finished, span)
+}
+
+func ExampleQueryObserver() {
+	doc, err := html.Parse(strings.NewReader(`<ul><li>a</li><li class="x">b</li></ul>`))
+	if err != nil {
+		panic(err)
+	}
+
+	recorder := new(spanRecorder)
+	sel, err := CompileObserved("UL > LI.x", Options{}, recorder)
+	if err != nil {
+		panic(err)
+	}
+	sel.MatchAll(doc)
+	sel.MatchFirst(doc)
+
+	for _, span := range recorder.finished {
+		fmt.Println(span.name, span.attrs["selector"], span.attrs["visited"], span.attrs["matched"])
+	}
+	// Output:
+	// cascadia.MatchAll ul > li.x 9 1
+	// cascadia.MatchFirst ul > li.x 8 1
+}
+
+// An eventLog is a QueryObserver that records the calls it receives.
+type eventLog []string
+
+func (l *eventLog) OnQueryStart(q *Query) {
+	*l = append(*l, "start "+q.Method+" "+q.Selector)
+}
+
+func (l *eventLog) OnQueryEnd(q *Query) {
+	if q.Duration < 0 {
+		*l = append(*l, "negative duration")
+	}
+	*l = append(*l, fmt.Sprintf("end %s %d/%d", q.Method, q.Matched, q.Visited))
+}
+
+func TestObservedSelector(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p>Hello</p><p>World</p><div>hello</div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MustCompile("p:contains(hello), div").MatchAll(doc)
+
+	var log eventLog
+	sel, err := CompileObserved("p:contains(hello), div", Options{}, &log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sel.MatchAll(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("MatchAll: got %d nodes, want %d", len(got), len(want))
+	}
+	if got := sel.MatchAllIndexed(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("MatchAllIndexed: got %d nodes, want %d", len(got), len(want))
+	}
+	if got := sel.MatchFirst(doc); got != want[0] {
+		t.Errorf("MatchFirst: got %v, want %v", got, want[0])
+	}
+	if got := sel.Filter(want); !reflect.DeepEqual(got, want) {
+		t.Errorf("Filter: got %d nodes, want %d", len(got), len(want))
+	}
+
+	wantLog := eventLog{
+		`start MatchAll p:contains("hello"), div`,
+		"end MatchAll 2/10",
+		`start MatchAllIndexed p:contains("hello"), div`,
+		"end MatchAllIndexed 2/10",
+		`start MatchFirst p:contains("hello"), div`,
+		"end MatchFirst 1/5",
+		`start Filter p:contains("hello"), div`,
+		"end Filter 2/2",
+	}
+	if !reflect.DeepEqual(log, wantLog) {
+		t.Errorf("got events:\n%s\nwant:\n%s", strings.Join(log, "\n"), strings.Join(wantLog, "\n"))
+	}
+
+	// Without an observer, queries work the same.
+	sel, err = CompileObserved("p:contains(hello), div", Options{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sel.MatchAll(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("MatchAll without an observer: got %d nodes, want %d", len(got), len(want))
+	}
+}
+
+// A callCounter is a QueryObserver that counts the queries for each method,
+// and checks that each start is followed by an end.
+type callCounter struct {
+	t       *testing.T
+	running *Query
+	counts  map[string]int
+}
+
+func (c *callCounter) OnQueryStart(q *Query) {
+	if c.running != nil {
+		c.t.Errorf("%s started during %s", q.Method, c.running.Method)
+	}
+	c.running = q
+}
+
+func (c *callCounter) OnQueryEnd(q *Query) {
+	if q != c.running {
+		c.t.Errorf("%s ended without starting", q.Method)
+	}
+	c.running = nil
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	c.counts[q.Method]++
+}
+
+func TestObserverEntryPoints(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p>a</p><p class="x">b</p><div>c</div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obs := &callCounter{t: t}
+	sel, err := CompileObserved("p.x, div:contains(c)", Options{}, obs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sel.MatchAll(doc)
+	sel.MatchAllInto(doc, nil)
+	sel.MatchAllIndexed(doc)
+	sel.MatchFirst(doc)
+	sel.MatchN(doc, 1)
+	sel.Filter([]*html.Node{doc})
+	sel.EachMatch(doc, func(*html.Node) bool { return true })
+	for it := sel.Iter(doc); it.Next() != nil; {
+	}
+	if got := sel.Route(doc); len(got) != 2 || got[0].Index != 0 || got[1].Index != 1 {
+		t.Errorf("Route: got %v", got)
+	}
+	sel.RouteNested(doc)
+
+	var c Cache
+	cached, err := c.GetObserved("p", obs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached.MatchAll(doc)
+	if c.MustGet("p")(doc) {
+		t.Error("the document matched p")
+	}
+
+	set, err := CompileMatcherSet("p", "div")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.Observer = obs
+	set.Matching(doc)
+	set.MatchAll(doc)
+	set.Each(doc, func(*html.Node, []int) bool { return false })
+
+	want := map[string]int{
+		"MatchAll": 3, "MatchAllInto": 1, "MatchAllIndexed": 1, "MatchFirst": 1,
+		"MatchN": 1, "Filter": 1, "EachMatch": 1, "Iter": 1, "Route": 1,
+		"RouteNested": 1, "Matching": 1, "Each": 1,
+	}
+	if !reflect.DeepEqual(obs.counts, want) {
+		t.Errorf("got calls %v, want %v", obs.counts, want)
+	}
+}
+
+func TestMatcherSetObserver(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p>a</p><p class="x">b</p><div>c</div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log eventLog
+	set, err := CompileMatcherSet("P", "p.x, div")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.Observer = &log
+	set.MatchAll(doc)
+	set.Each(doc, func(*html.Node, []int) bool { return false })
+
+	wantLog := eventLog{
+		"start MatchAll p, p.x, div",
+		"end MatchAll 3/10",
+		"start Each p, p.x, div",
+		"end Each 1/5",
+	}
+	if !reflect.DeepEqual(log, wantLog) {
+		t.Errorf("got events:\n%s\nwant:\n%s", strings.Join(log, "\n"), strings.Join(wantLog, "\n"))
+	}
+}
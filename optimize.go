@@ -0,0 +1,333 @@
+package cascadia
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// rewriting parsed selectors into equivalent ones that match faster
+
+// compileSel returns the Selector for a parsed selector: Never if it can't
+// match anything, or else the Match method of its optimized form.
+func compileSel(m Sel) Selector {
+	m = optimize(m)
+	if _, ok := m.(neverSelector); ok {
+		return Never
+	}
+	return withKey(m).Match
+}
+
+// neverSelector matches nothing. It is produced by optimize, for selectors
+// that can't match.
+type neverSelector struct{}
+
+func (neverSelector) Match(n *html.Node) bool {
+	return false
+}
+
+func (neverSelector) String() string {
+	return ":not(*)"
+}
+
+// optimize returns a selector that matches the same nodes as m, but may be
+// faster. The result is only for matching: unlike m, it doesn't necessarily
+// print as the selector that was parsed.
+func optimize(m Sel) Sel {
+	switch m := m.(type) {
+	case compoundSelector:
+		return optimizeCompound(m)
+	case unionSelector:
+		var result unionSelector
+		for _, c := range m {
+			if c = optimize(c); c != (neverSelector{}) {
+				result = append(result, c)
+			}
+		}
+		switch len(result) {
+		case 0:
+			return neverSelector{}
+		case 1:
+			return result[0]
+		}
+		return result
+	case negatedSelector:
+		return negatedSelector{optimize(m.sel)}
+	case hasSelector:
+		sel := optimize(m.sel)
+		if sel == (neverSelector{}) {
+			return sel
+		}
+		return hasSelector{sel: sel, child: m.child}
+	case matchesAnySelector:
+		sel := optimize(m.sel)
+		if sel == (neverSelector{}) {
+			return sel
+		}
+		return matchesAnySelector{sel: sel, where: m.where}
+	case relativeSelector:
+		sel := optimize(m.sel)
+		if sel == (neverSelector{}) {
+			return sel
+		}
+		return relativeSelector{combinator: m.combinator, sel: sel}
+	case combinedSelector:
+		first, second := optimize(m.first), optimize(m.second)
+		if first == (neverSelector{}) || second == (neverSelector{}) {
+			return neverSelector{}
+		}
+		return combinedSelector{first: first, combinator: m.combinator, second: second}
+	case dynamicSelector:
+		return neverSelector{}
+	case attrSelector:
+		switch m.operation {
+		case "~=", "^=", "$=", "*=":
+			if m.val == "" {
+				return neverSelector{}
+			}
+		}
+	case nthColSelector:
+		if m.a <= 0 && m.b <= 0 {
+			return neverSelector{}
+		}
+	case nthChildSelector:
+		// With a and b both zero or negative, an+b is never a valid position.
+		if m.a <= 0 && m.b <= 0 {
+			return neverSelector{}
+		}
+		if m.of != nil {
+			if m.of = optimize(m.of); m.of == (neverSelector{}) {
+				return neverSelector{}
+			}
+		}
+	}
+	return m
+}
+
+// optimizeCompound drops the attribute existence tests in s that are
+// implied by a value test on the same attribute, so that a selector like
+// [data-x][data-x^="a"] only looks through the attributes once. If any
+// part of s can't match, neither can s.
+func optimizeCompound(s compoundSelector) Sel {
+	result := make(compoundSelector, 0, len(s))
+	for _, c := range s {
+		if a, ok := c.(attrSelector); ok && a.operation == "" && hasValueTest(s, a) {
+			continue
+		}
+		c = optimize(c)
+		if c == (neverSelector{}) {
+			return c
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// hasValueTest returns whether s contains a test of the value of the
+// attribute that exists tests for.
+func hasValueTest(s compoundSelector, exists attrSelector) bool {
+	for _, c := range s {
+		if a, ok := c.(attrSelector); ok && a.operation != "" && a.key == exists.key && sameNamespace(a.namespace, exists.namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameNamespace returns whether a and b refer to the same namespace, where
+// nil means any namespace.
+func sameNamespace(a, b *namespace) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.name == b.name
+}
+
+// A selectorKey is an id, tag name or class that an element must have to
+// match a compound selector.
+type selectorKey struct {
+	kind byte // '#', 't' or '.'
+	val  string
+}
+
+func (k selectorKey) match(n *html.Node) bool {
+	switch k.kind {
+	case '#':
+		return idSelector{id: k.val}.Match(n)
+	case 't':
+		return n.Type == html.ElementNode && n.Data == k.val
+	}
+	return classSelector{class: k.val}.Match(n)
+}
+
+// A keyedSelector is the compiled form of a selector whose rightmost
+// compound selector has a key. Like the rule buckets in browser engines, it
+// tests the key, which is cheap and rules out most nodes, before the rest
+// of the selector.
+type keyedSelector struct {
+	key  selectorKey
+	rest Sel // the selector without its key, or nil if that matches anything
+	sel  Sel // the whole selector
+}
+
+func (s keyedSelector) Match(n *html.Node) bool {
+	return s.key.match(n) && (s.rest == nil || s.rest.Match(n))
+}
+
+func (s keyedSelector) String() string {
+	return s.sel.String()
+}
+
+func (s keyedSelector) Specificity() Specificity {
+	return s.sel.Specificity()
+}
+
+// minBucketed is the number of members with keys that a selector list needs
+// before they are looked up by key, instead of each being tested in turn.
+const minBucketed = 4
+
+// A bucketedUnion is the compiled form of a selector list with many
+// members that have keys. It only tests the members whose keys a node has,
+// and the members without keys.
+type bucketedUnion struct {
+	buckets map[selectorKey][]keyedSelector
+	others  []Sel
+	sel     unionSelector
+}
+
+func (s bucketedUnion) Match(n *html.Node) bool {
+	if n.Type == html.ElementNode {
+		if s.matchBucket(n, selectorKey{'t', n.Data}) {
+			return true
+		}
+		for _, a := range n.Attr {
+			switch a.Key {
+			case "id":
+				if s.matchBucket(n, selectorKey{'#', a.Val}) {
+					return true
+				}
+			case "class":
+				if anyToken(a.Val, func(class string) bool { return s.matchBucket(n, selectorKey{'.', class}) }) {
+					return true
+				}
+			}
+		}
+	}
+	for _, m := range s.others {
+		if m.Match(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchBucket returns whether n matches any of the members with key k.
+// n is known to have the key.
+func (s bucketedUnion) matchBucket(n *html.Node, k selectorKey) bool {
+	for _, m := range s.buckets[k] {
+		if m.rest == nil || m.rest.Match(n) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s bucketedUnion) String() string {
+	return s.sel.String()
+}
+
+func (s bucketedUnion) Specificity() Specificity {
+	return s.sel.Specificity()
+}
+
+// withKey returns a selector that matches the same nodes as m, with the
+// keys of m and of the selectors to the left of its combinators split off
+// into keyedSelectors. Combinators are already matched from right to left,
+// so the key of the rightmost compound selector is tested first.
+func withKey(m Sel) Sel {
+	switch m := m.(type) {
+	case unionSelector:
+		members := make(unionSelector, len(m))
+		buckets := make(map[selectorKey][]keyedSelector)
+		var others []Sel
+		for i, c := range m {
+			members[i] = withKey(c)
+			if k, ok := members[i].(keyedSelector); ok {
+				buckets[k.key] = append(buckets[k.key], k)
+			} else {
+				others = append(others, members[i])
+			}
+		}
+		if len(m)-len(others) < minBucketed {
+			return members
+		}
+		return bucketedUnion{buckets: buckets, others: others, sel: m}
+	case combinedSelector:
+		c := combinedSelector{first: withKey(m.first), combinator: m.combinator, second: m.second}
+		key, rest, ok := splitKey(m.second)
+		if !ok {
+			return c
+		}
+		if rest != nil {
+			c.second = rest
+		} else {
+			c.second = compoundSelector{}
+		}
+		return keyedSelector{key: key, rest: c, sel: m}
+	}
+
+	key, rest, ok := splitKey(m)
+	if !ok {
+		return m
+	}
+	return keyedSelector{key: key, rest: rest, sel: m}
+}
+
+// splitKey returns the key of the compound selector m, preferring an id to a
+// tag name and a tag name to a class, and the rest of m, or nil if nothing
+// else is left. If m has no key, ok is false.
+func splitKey(m Sel) (key selectorKey, rest Sel, ok bool) {
+	s, isCompound := m.(compoundSelector)
+	if !isCompound {
+		s = compoundSelector{m}
+	}
+
+	best := -1
+	for i, c := range s {
+		if k, ok := keyOf(c); ok && (best == -1 || keyRank(k) < keyRank(key)) {
+			best, key = i, k
+		}
+	}
+	switch {
+	case best == -1:
+		return selectorKey{}, nil, false
+	case len(s) == 1:
+		return key, nil, true
+	case len(s) == 2:
+		return key, s[1-best], true
+	}
+	r := make(compoundSelector, 0, len(s)-1)
+	r = append(r, s[:best]...)
+	return key, append(r, s[best+1:]...), true
+}
+
+// keyOf returns the key that m is, if it is an id, tag or class selector.
+// Ids and classes compared case-insensitively have no key, since keys are
+// looked up as they are written in the document.
+func keyOf(m Sel) (selectorKey, bool) {
+	switch m := m.(type) {
+	case idSelector:
+		return selectorKey{'#', m.id}, !m.ignoreCase
+	case tagSelector:
+		return selectorKey{'t', m.tag}, true
+	case classSelector:
+		return selectorKey{'.', m.class}, !m.ignoreCase
+	}
+	return selectorKey{}, false
+}
+
+// keyRank returns how much k is preferred as a key, lower ranks being
+// better.
+func keyRank(k selectorKey) int {
+	return strings.IndexByte("#t.", k.kind)
+}
@@ -0,0 +1,166 @@
+package cascadia
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+var optimizeTests = map[string]string{
+	`[data-x][data-x^="a"]`:       `[data-x^="a"]`,
+	`p[data-x^="a"][data-x].b`:    `p[data-x^="a"].b`,
+	`[data-x][data-y="a"]`:        `[data-x][data-y="a"]`,
+	`[xlink|href][href="a"]`:      `[xlink|href][href="a"]`,
+	`:not([a][a=b]), [a][a$=b] c`: `:not([a="b"]), [a$="b"] c`,
+	`[a]`:                         `[a]`,
+}
+
+func TestOptimize(t *testing.T) {
+	for source, want := range optimizeTests {
+		p := &parser{s: source}
+		m, err := p.parse()
+		if err != nil {
+			t.Errorf("parsing %q: %s", source, err)
+			continue
+		}
+		before := m.String()
+		if got := optimize(m).String(); got != want {
+			t.Errorf("optimizing %q: got %q, want %q", source, got, want)
+		}
+		if m.String() != before {
+			t.Errorf("optimizing %q modified the parsed selector", source)
+		}
+	}
+}
+
+// TestAttributeValues pins the behavior of the attribute selectors on
+// elements where the attribute is empty, whitespace-only, or missing.
+func TestAttributeValues(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p id="empty" title=""></p><p id="space" title=" "></p><p id="x" title="x"></p><p id="missing"></p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for sel, want := range map[string]string{
+		`[title]`:             "empty space x",
+		`[title=""]`:          "empty",
+		`[title=" "]`:         "space",
+		`[title="" i]`:        "empty",
+		`[title~=""]`:         "",
+		`[title~=" "]`:        "",
+		`[title|=""]`:         "empty",
+		`[title^=""]`:         "",
+		`[title$=""]`:         "",
+		`[title*=""]`:         "",
+		`[title*=" "]`:        "space",
+		`[title][title=""]`:   "empty",
+		`[title][title^="x"]`: "x",
+		`p:not([title=""])`:   "space x missing",
+	} {
+		var ids []string
+		for _, n := range MustCompile(sel).MatchAll(doc) {
+			ids = append(ids, attributeValue(n, "id"))
+		}
+		if got := strings.Join(ids, " "); got != want {
+			t.Errorf("%s: got %q, want %q", sel, got, want)
+		}
+	}
+}
+
+func TestNeverMatches(t *testing.T) {
+	for sel, want := range map[string]bool{
+		`:hover`:            true,
+		`a:focus, b:active`: true,
+		`[a^=""]`:           true,
+		`p [a*=""]`:         true,
+		`div:has(:visited)`: true,
+		`:nth-child(-n+0)`:  true,
+		`a:hover, b`:        false,
+		`:not(:hover)`:      false,
+		`[a=""]`:            false,
+		`:nth-child(-n+1)`:  false,
+		`p`:                 false,
+	} {
+		s, err := CompileWithOptions(sel, Options{DynamicPseudoclasses: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.NeverMatches(); got != want {
+			t.Errorf("%s: got %v, want %v", sel, got, want)
+		}
+	}
+
+	if !Never.NeverMatches() || All.NeverMatches() {
+		t.Error("Never and All report the wrong values from NeverMatches")
+	}
+	var nilSelector Selector
+	if nilSelector.NeverMatches() {
+		t.Error("nil selector reports NeverMatches")
+	}
+
+	doc, err := html.Parse(strings.NewReader(`<p>text</p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Never.MatchAll(doc); len(got) != 0 {
+		t.Errorf("Never.MatchAll: got %d nodes", len(got))
+	}
+	if got := Never.MatchFirst(doc); got != nil {
+		t.Errorf("Never.MatchFirst: got %s", nodeString(got))
+	}
+	if got, want := len(All.MatchAll(doc)), len(MustCompile("*").MatchAll(doc)); got != want {
+		t.Errorf("All.MatchAll: got %d nodes, want %d", got, want)
+	}
+
+	result := CompileLenient(`:hover, div[`)
+	if !result.Group.NeverMatches() {
+		t.Error("lenient group with no usable members doesn't report NeverMatches")
+	}
+	if CompileLenient(`:hover, p`).Group.NeverMatches() {
+		t.Error("lenient group with a usable member reports NeverMatches")
+	}
+}
+
+// TestWithKey checks that the keyed forms of selectors match the same nodes
+// as the parsed selectors.
+func TestWithKey(t *testing.T) {
+	check := func(source, fixture string) {
+		doc, err := html.Parse(strings.NewReader(fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := &parser{s: source}
+		m, err := p.parse()
+		if err != nil {
+			t.Errorf("parsing %q: %s", source, err)
+			return
+		}
+		keyed := withKey(optimize(m))
+		if got, want := Selector(keyed.Match).MatchAll(doc), Selector(m.Match).MatchAll(doc); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %d matches, want %d", source, len(got), len(want))
+		}
+		if got, want := keyed.String(), optimize(m).String(); got != want {
+			t.Errorf("%s: String got %q, want %q", source, got, want)
+		}
+	}
+
+	for _, test := range selectorTests {
+		check(test.Selector, test.HTML)
+	}
+
+	list := `#a, p.x, .y, div, div > .x, p:first-child, :not(.x), li.y ~ li, #b span, #a, span#b.y`
+	fixture := `<div id="a" class="x y"><p class="x">a</p><p id="b" class="y  x"><span>b</span></p></div>
+		<ul><li class="y">1</li><li>2</li><li class="x">3</li></ul><span id="b" class="y"></span>`
+	check(list, fixture)
+
+	p := &parser{s: list}
+	m, err := p.parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := withKey(optimize(m)).(bucketedUnion); !ok {
+		t.Errorf("%s: got %T, want a bucketedUnion", list, withKey(optimize(m)))
+	}
+}
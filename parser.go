@@ -2,39 +2,120 @@
 package cascadia
 
 import (
-	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
-
-	"golang.org/x/net/html"
+	"unicode"
 )
 
 // a parser for CSS selectors
 type parser struct {
 	s string // the source text
 	i int    // the current position
+
+	// inNegation is true while parsing the argument of :not().
+	inNegation bool
+
+	// features records the features used by the selector.
+	features Feature
+
+	// scope holds the element that :scope refers to at match time.
+	// If it is nil, :scope matches the root element.
+	scope *scopeRef
+
+	// opts holds the options passed to CompileWithOptions.
+	opts Options
+
+	// warnings records constructs that were accepted but are suspect.
+	warnings []Diagnostic
+
+	// allowPseudoElement is true if a pseudo-element may end the selector,
+	// which is then recorded in pseudoElement. It is cleared while parsing
+	// the arguments of pseudo-classes.
+	allowPseudoElement bool
+	pseudoElement      string
+}
+
+// A SyntaxError is returned when a selector can't be parsed. Offset is the
+// byte offset in Input where the problem was found, which can be used to
+// point out the problem to the user.
+type SyntaxError struct {
+	Input  string // the selector that was being parsed
+	Offset int
+	Msg    string
+
+	// Token is the text at Offset: a run of characters up to the next
+	// whitespace, parenthesis or comma, or a single one of those. It is
+	// empty if Offset is at the end of Input.
+	Token string
+
+	// Expected describes what the parser was looking for at Offset, such
+	// as "identifier" or "')'", if the problem is that it found something
+	// else. Otherwise it is empty.
+	Expected string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("parsing %q: %s at offset %d", e.Input, e.Msg, e.Offset)
+}
+
+// errorf returns a SyntaxError for the source text at offset.
+func (p *parser) errorf(offset int, format string, args ...interface{}) error {
+	return &SyntaxError{Input: p.s, Offset: offset, Msg: fmt.Sprintf(format, args...), Token: tokenAt(p.s, offset)}
+}
+
+// expectedf is like errorf, for when the parser was looking for expected at
+// offset but found something else.
+func (p *parser) expectedf(offset int, expected, format string, args ...interface{}) error {
+	err := p.errorf(offset, format, args...).(*SyntaxError)
+	err.Expected = expected
+	return err
+}
+
+// warn records a warning about the source text from start to p.i.
+func (p *parser) warn(start int, format string, args ...interface{}) {
+	p.warnings = append(p.warnings, Diagnostic{
+		Severity: SeverityWarning,
+		Start:    start,
+		End:      p.i,
+		Message:  fmt.Sprintf(format, args...),
+	})
+	if p.opts.Warn != nil {
+		p.opts.Warn(p.warnings[len(p.warnings)-1])
+	}
+}
+
+// checkLength returns an error if s, an identifier or string read from the
+// source text at p.i, is longer than the limit in p.opts.
+func (p *parser) checkLength(s string) error {
+	if max := p.opts.MaxIdentifierLength; max > 0 && len(s) > max {
+		return p.errorf(p.i, "identifier or string of %d bytes exceeds the limit of %d", len(s), max)
+	}
+	return nil
 }
 
 // parseEscape parses a backslash escape.
 func (p *parser) parseEscape() (result string, err error) {
 	if len(p.s) < p.i+2 || p.s[p.i] != '\\' {
-		return "", errors.New("invalid escape sequence")
+		return "", p.errorf(p.i, "invalid escape sequence")
 	}
 
 	start := p.i + 1
 	c := p.s[start]
 	switch {
 	case c == '\r' || c == '\n' || c == '\f':
-		return "", errors.New("escaped line ending outside string")
+		return "", p.errorf(p.i, "escaped line ending outside string")
 	case hexDigit(c):
 		// unicode escape (hex)
 		var i int
-		for i = start; i < p.i+6 && i < len(p.s) && hexDigit(p.s[i]); i++ {
+		for i = start; i < start+6 && i < len(p.s) && hexDigit(p.s[i]); i++ {
 			// empty
 		}
-		v, _ := strconv.ParseUint(p.s[start:i], 16, 21)
+		v, _ := strconv.ParseUint(p.s[start:i], 16, 32)
+		if v == 0 || 0xD800 <= v && v <= 0xDFFF || v > unicode.MaxRune {
+			v = unicode.ReplacementChar
+		}
 		if len(p.s) > i {
 			switch p.s[i] {
 			case '\r':
@@ -82,11 +163,13 @@ func (p *parser) parseIdentifier() (result string, err error) {
 	}
 
 	if len(p.s) <= p.i {
-		return "", errors.New("expected identifier, found EOF instead")
+		return "", p.expectedf(p.i, "identifier", "expected identifier, found EOF instead")
 	}
 
-	if c := p.s[p.i]; !(nameStart(c) || c == '\\') {
-		return "", fmt.Errorf("expected identifier, found %c instead", c)
+	// As in CSS Syntax Level 3, a second dash may follow the first, as in
+	// custom property names like --x.
+	if c := p.s[p.i]; !(nameStart(c) || c == '\\' || startingDash && c == '-') {
+		return "", p.expectedf(p.i, "identifier", "expected identifier, found %c instead", c)
 	}
 
 	result, err = p.parseName()
@@ -124,7 +207,10 @@ loop:
 	}
 
 	if result == "" {
-		return "", errors.New("expected name, found EOF instead")
+		return "", p.expectedf(p.i, "name", "expected name, found EOF instead")
+	}
+	if err := p.checkLength(result); err != nil {
+		return "", err
 	}
 
 	p.i = i
@@ -135,7 +221,7 @@ loop:
 func (p *parser) parseString() (result string, err error) {
 	i := p.i
 	if len(p.s) < i+2 {
-		return "", errors.New("expected string, found EOF instead")
+		return "", p.expectedf(p.i, "string", "expected string, found EOF instead")
 	}
 
 	quote := p.s[i]
@@ -168,7 +254,7 @@ loop:
 		case quote:
 			break loop
 		case '\r', '\n', '\f':
-			return "", errors.New("unexpected end of line in string")
+			return "", p.errorf(i, "unexpected end of line in string")
 		default:
 			start := i
 			for i < len(p.s) {
@@ -182,7 +268,11 @@ loop:
 	}
 
 	if i >= len(p.s) {
-		return "", errors.New("EOF in string")
+		return "", p.errorf(i, "EOF in string")
+	}
+
+	if err := p.checkLength(result); err != nil {
+		return "", err
 	}
 
 	// Consume the final quote.
@@ -197,7 +287,7 @@ loop:
 func (p *parser) parseRegex() (rx *regexp.Regexp, err error) {
 	i := p.i
 	if len(p.s) < i+2 {
-		return nil, errors.New("expected regular expression, found EOF instead")
+		return nil, p.expectedf(p.i, "regular expression", "expected regular expression, found EOF instead")
 	}
 
 	// number of open parens or brackets;
@@ -219,11 +309,17 @@ loop:
 	}
 
 	if i >= len(p.s) {
-		return nil, errors.New("EOF in regular expression")
+		return nil, p.errorf(i, "EOF in regular expression")
+	}
+	if err := p.checkLength(p.s[p.i:i]); err != nil {
+		return nil, err
 	}
 	rx, err = regexp.Compile(p.s[p.i:i])
+	if err != nil {
+		return nil, p.errorf(p.i, "%s", err)
+	}
 	p.i = i
-	return rx, err
+	return rx, nil
 }
 
 // skipWhitespace consumes whitespace characters and comments.
@@ -279,23 +375,92 @@ func (p *parser) consumeClosingParenthesis() bool {
 	return false
 }
 
-// parseTypeSelector parses a type selector (one that matches by tag name).
-func (p *parser) parseTypeSelector() (result Selector, err error) {
-	tag, err := p.parseIdentifier()
+// parseTypeSelector parses a type selector (one that matches by tag name),
+// or a universal selector, either of which may have a namespace prefix
+// (ns|tag, *|tag, |tag, ns|*). It returns nil for a selector that matches
+// any element.
+func (p *parser) parseTypeSelector() (result Sel, err error) {
+	start := p.i
+	var prefix, tag string
+	hasPrefix, anyNamespace := false, false
+
+	if p.i < len(p.s) && p.s[p.i] == '*' {
+		p.i++
+		tag = "*"
+	} else if p.i >= len(p.s) || p.s[p.i] != '|' {
+		tag, err = p.parseIdentifier()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A '|' that isn't part of a |= operator or a || combinator separates
+	// the namespace prefix from the tag name.
+	if p.i < len(p.s) && p.s[p.i] == '|' && (p.i+1 >= len(p.s) || p.s[p.i+1] != '=' && p.s[p.i+1] != '|') {
+		p.i++
+		hasPrefix = true
+		prefix, anyNamespace = tag, tag == "*"
+		if p.i < len(p.s) && p.s[p.i] == '*' {
+			p.i++
+			tag = "*"
+		} else {
+			tag, err = p.parseIdentifier()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if !hasPrefix || anyNamespace {
+		if tag == "*" {
+			return nil, nil
+		}
+		return tagSelector{tag: toLowerASCII(tag)}, nil
+	}
+
+	ns, err := p.resolveNamespace(prefix, start)
 	if err != nil {
 		return nil, err
 	}
+	if tag == "*" {
+		tag = ""
+	}
+	return namespaceTagSelector{namespace: ns, tag: toLowerASCII(tag)}, nil
+}
 
-	return typeSelector(tag), nil
+// defaultNamespaces holds the namespace prefixes that are available
+// without being listed in Options.Namespaces.
+var defaultNamespaces = map[string]string{
+	"svg":   "svg",
+	"math":  "math",
+	"xlink": "xlink",
+	"xml":   "xml",
+	"xmlns": "xmlns",
+}
+
+// resolveNamespace looks up a namespace prefix, which is at offset in the
+// source text. The empty prefix stands for no namespace.
+func (p *parser) resolveNamespace(prefix string, offset int) (*namespace, error) {
+	if prefix == "" {
+		return &namespace{}, nil
+	}
+	name, ok := p.opts.Namespaces[prefix]
+	if !ok {
+		name, ok = defaultNamespaces[prefix]
+	}
+	if !ok {
+		return nil, p.errorf(offset, "undeclared namespace prefix %q", prefix)
+	}
+	return &namespace{prefix: prefix, name: name}, nil
 }
 
 // parseIDSelector parses a selector that matches by id attribute.
-func (p *parser) parseIDSelector() (Selector, error) {
+func (p *parser) parseIDSelector() (Sel, error) {
 	if p.i >= len(p.s) {
-		return nil, fmt.Errorf("expected id selector (#id), found EOF instead")
+		return nil, p.expectedf(p.i, "id selector", "expected id selector (#id), found EOF instead")
 	}
 	if p.s[p.i] != '#' {
-		return nil, fmt.Errorf("expected id selector (#id), found '%c' instead", p.s[p.i])
+		return nil, p.expectedf(p.i, "id selector", "expected id selector (#id), found '%c' instead", p.s[p.i])
 	}
 
 	p.i++
@@ -304,16 +469,19 @@ func (p *parser) parseIDSelector() (Selector, error) {
 		return nil, err
 	}
 
-	return attributeEqualsSelector("id", id), nil
+	if p.opts.QuirksMode {
+		return idSelector{id: toLowerASCII(id), ignoreCase: true}, nil
+	}
+	return idSelector{id: id}, nil
 }
 
 // parseClassSelector parses a selector that matches by class attribute.
-func (p *parser) parseClassSelector() (Selector, error) {
+func (p *parser) parseClassSelector() (Sel, error) {
 	if p.i >= len(p.s) {
-		return nil, fmt.Errorf("expected class selector (.class), found EOF instead")
+		return nil, p.expectedf(p.i, "class selector", "expected class selector (.class), found EOF instead")
 	}
 	if p.s[p.i] != '.' {
-		return nil, fmt.Errorf("expected class selector (.class), found '%c' instead", p.s[p.i])
+		return nil, p.expectedf(p.i, "class selector", "expected class selector (.class), found '%c' instead", p.s[p.i])
 	}
 
 	p.i++
@@ -322,55 +490,80 @@ func (p *parser) parseClassSelector() (Selector, error) {
 		return nil, err
 	}
 
-	return attributeIncludesSelector("class", class), nil
+	if p.opts.QuirksMode {
+		return classSelector{class: toLowerASCII(class), ignoreCase: true}, nil
+	}
+	return classSelector{class: class}, nil
 }
 
 // parseAttributeSelector parses a selector that matches by attribute value.
-func (p *parser) parseAttributeSelector() (Selector, error) {
+func (p *parser) parseAttributeSelector() (Sel, error) {
 	if p.i >= len(p.s) {
-		return nil, fmt.Errorf("expected attribute selector ([attribute]), found EOF instead")
+		return nil, p.expectedf(p.i, "attribute selector", "expected attribute selector ([attribute]), found EOF instead")
 	}
 	if p.s[p.i] != '[' {
-		return nil, fmt.Errorf("expected attribute selector ([attribute]), found '%c' instead", p.s[p.i])
+		return nil, p.expectedf(p.i, "attribute selector", "expected attribute selector ([attribute]), found '%c' instead", p.s[p.i])
 	}
 
+	start := p.i
 	p.i++
 	p.skipWhitespace()
-	key, err := p.parseIdentifier()
+	ns, key, err := p.parseAttributeName()
 	if err != nil {
 		return nil, err
 	}
 
 	p.skipWhitespace()
 	if p.i >= len(p.s) {
-		return nil, errors.New("unexpected EOF in attribute selector")
+		return nil, p.errorf(p.i, "unexpected EOF in attribute selector")
 	}
 
 	if p.s[p.i] == ']' {
 		p.i++
-		return attributeExistsSelector(key), nil
+		return attrSelector{key: toLowerASCII(key), namespace: ns}, nil
 	}
 
-	if p.i+2 >= len(p.s) {
-		return nil, errors.New("unexpected EOF in attribute selector")
+	if p.i+2 > len(p.s) {
+		return nil, p.errorf(p.i, "unexpected EOF in attribute selector")
 	}
 
+	opStart := p.i
 	op := p.s[p.i : p.i+2]
 	if op[0] == '=' {
 		op = "="
 	} else if op[1] != '=' {
-		return nil, fmt.Errorf(`expected equality operator, found "%s" instead`, op)
+		return nil, p.expectedf(p.i, "equality operator", `expected equality operator, found "%s" instead`, op)
 	}
 	p.i += len(op)
 
 	p.skipWhitespace()
 	if p.i >= len(p.s) {
-		return nil, errors.New("unexpected EOF in attribute selector")
+		return nil, p.errorf(p.i, "unexpected EOF in attribute selector")
+	}
+	if p.s[p.i] == ']' {
+		return nil, p.expectedf(p.i, "attribute value", "expected attribute value")
 	}
 	var val string
 	var rx *regexp.Regexp
 	if op == "#=" {
-		rx, err = p.parseRegex()
+		p.features |= FeatureRegexp | FeatureNonStandard
+		if p.opts.Strict {
+			return nil, p.errorf(opStart, "the #= operator is not standard CSS")
+		}
+		switch p.s[p.i] {
+		case '\'', '"':
+			patternStart := p.i
+			var pattern string
+			pattern, err = p.parseString()
+			if err == nil {
+				rx, err = regexp.Compile(pattern)
+				if err != nil {
+					err = p.errorf(patternStart, "%s", err)
+				}
+			}
+		default:
+			rx, err = p.parseRegex()
+		}
 	} else {
 		switch p.s[p.i] {
 		case '\'', '"':
@@ -385,81 +578,182 @@ func (p *parser) parseAttributeSelector() (Selector, error) {
 
 	p.skipWhitespace()
 	if p.i >= len(p.s) {
-		return nil, errors.New("unexpected EOF in attribute selector")
+		return nil, p.errorf(p.i, "unexpected EOF in attribute selector")
 	}
+
+	// check if the attribute contains a case-sensitivity flag:
+	// i for ASCII case-insensitive, s for case-sensitive (the default)
+	ignoreCase := false
+	if c := p.s[p.i]; op != "#=" && (c == 'i' || c == 'I' || c == 's' || c == 'S') {
+		ignoreCase = c == 'i' || c == 'I'
+		p.i++
+		p.skipWhitespace()
+		if p.i >= len(p.s) {
+			return nil, p.errorf(p.i, "unexpected EOF in attribute selector")
+		}
+	}
+
 	if p.s[p.i] != ']' {
-		return nil, fmt.Errorf("expected ']', found '%c' instead", p.s[p.i])
+		return nil, p.expectedf(p.i, "']'", "expected ']', found '%c' instead", p.s[p.i])
 	}
 	p.i++
 
 	switch op {
-	case "=":
-		return attributeEqualsSelector(key, val), nil
-	case "~=":
-		return attributeIncludesSelector(key, val), nil
-	case "|=":
-		return attributeDashmatchSelector(key, val), nil
-	case "^=":
-		return attributePrefixSelector(key, val), nil
-	case "$=":
-		return attributeSuffixSelector(key, val), nil
-	case "*=":
-		return attributeSubstringSelector(key, val), nil
+	case "~=", "^=", "$=", "*=":
+		if val == "" {
+			p.warn(start, "%s with an empty value never matches", op)
+		}
+	}
+
+	switch op {
+	case "=", "~=", "|=", "^=", "$=", "*=":
+		if ignoreCase {
+			val = toLowerASCII(val)
+		}
+		return attrSelector{key: toLowerASCII(key), namespace: ns, val: val, operation: op, ignoreCase: ignoreCase}, nil
 	case "#=":
-		return attributeRegexSelector(key, rx), nil
+		return attrSelector{key: toLowerASCII(key), namespace: ns, operation: op, regexp: rx}, nil
 	}
 
-	return nil, fmt.Errorf("attribute operator %q is not supported", op)
+	return nil, p.errorf(opStart, "attribute operator %q is not supported", op)
 }
 
-var expectedParenthesis = errors.New("expected '(' but didn't find it")
-var expectedClosingParenthesis = errors.New("expected ')' but didn't find it")
-var unmatchedParenthesis = errors.New("unmatched '('")
+// parseAttributeName parses the name in an attribute selector, with an
+// optional namespace prefix (ns|attr, *|attr, |attr). The namespace is nil
+// if the attribute may be in any namespace.
+func (p *parser) parseAttributeName() (ns *namespace, key string, err error) {
+	start := p.i
+	hasPrefix := p.i+1 < len(p.s) && p.s[p.i+1] != '=' &&
+		(p.s[p.i] == '|' || p.s[p.i] == '*' && p.s[p.i+1] == '|')
+	var prefix string
+	if !hasPrefix {
+		key, err = p.parseIdentifier()
+		if err != nil {
+			return nil, "", err
+		}
+		if p.i+1 >= len(p.s) || p.s[p.i] != '|' || p.s[p.i+1] == '=' {
+			return nil, key, nil
+		}
+		prefix = key
+	} else if p.s[p.i] == '*' {
+		prefix = "*"
+		p.i++
+	}
+	p.i++ // the '|'
+
+	key, err = p.parseIdentifier()
+	if err != nil {
+		return nil, "", err
+	}
+	if prefix == "*" {
+		return nil, key, nil
+	}
+	ns, err = p.resolveNamespace(prefix, start)
+	return ns, key, err
+}
 
 // parsePseudoclassSelector parses a pseudoclass selector like :not(p).
-func (p *parser) parsePseudoclassSelector() (Selector, error) {
+func (p *parser) parsePseudoclassSelector() (Sel, error) {
 	if p.i >= len(p.s) {
-		return nil, fmt.Errorf("expected pseudoclass selector (:pseudoclass), found EOF instead")
+		return nil, p.expectedf(p.i, "pseudoclass selector", "expected pseudoclass selector (:pseudoclass), found EOF instead")
 	}
 	if p.s[p.i] != ':' {
-		return nil, fmt.Errorf("expected attribute selector (:pseudoclass), found '%c' instead", p.s[p.i])
+		return nil, p.expectedf(p.i, "pseudoclass selector", "expected pseudoclass selector (:pseudoclass), found '%c' instead", p.s[p.i])
 	}
 
+	allowPseudoElement := p.allowPseudoElement
+	p.allowPseudoElement = false
+	defer func() { p.allowPseudoElement = allowPseudoElement }()
+
+	start := p.i
 	p.i++
 	name, err := p.parseIdentifier()
 	if err != nil {
 		return nil, err
 	}
 	name = toLowerASCII(name)
+	p.features |= pseudoclassFeatures[name]
+	if p.opts.Strict && pseudoclassFeatures[name]&FeatureNonStandard != 0 {
+		return nil, p.errorf(start, ":%s is not standard CSS", name)
+	}
+
+	if dynamicPseudoclasses[name] && p.opts.DynamicPseudoclasses {
+		p.warn(start, ":%s depends on user interaction, so it never matches", name)
+		return dynamicSelector{name}, nil
+	}
 
 	switch name {
-	case "not", "has", "haschild":
+	case "not":
+		if p.inNegation {
+			return nil, p.errorf(start, ":not() cannot be nested")
+		}
 		if !p.consumeParenthesis() {
-			return nil, expectedParenthesis
+			return nil, p.expectedf(p.i, "'('", "expected '(' but didn't find it")
 		}
+		if p.consumeClosingParenthesis() {
+			return nil, p.errorf(start, ":not() requires an argument")
+		}
+		// As in Selectors Level 4, the argument may be a list of complex
+		// selectors, such as :not(.sidebar *, [hidden]).
+		p.inNegation = true
 		sel, err := p.parseSelectorGroup()
+		p.inNegation = false
 		if err != nil {
 			return nil, err
 		}
 		if !p.consumeClosingParenthesis() {
-			return nil, expectedClosingParenthesis
+			p.skipWhitespace()
+			if p.i >= len(p.s) {
+				return nil, p.expectedf(p.i, "')'", "expected ')' to close :not(), found EOF instead")
+			}
+			return nil, p.expectedf(p.i, "')'", "expected ')' to close :not(), found '%c' instead", p.s[p.i])
+		}
+		return negatedSelector{sel}, nil
+
+	case "is", "where":
+		if !p.consumeParenthesis() {
+			return nil, p.expectedf(p.i, "'('", "expected '(' but didn't find it")
+		}
+		sel, err := p.parseForgivingList(name)
+		if err != nil {
+			return nil, err
+		}
+		return matchesAnySelector{sel: sel, where: name == "where"}, nil
+
+	case "has", "haschild":
+		if !p.consumeParenthesis() {
+			return nil, p.expectedf(p.i, "'('", "expected '(' but didn't find it")
+		}
+		inNegation := p.inNegation
+		p.inNegation = false
+		var sel Sel
+		var err error
+		if name == "has" {
+			sel, err = p.parseGroup(p.parseRelativeSelector)
+		} else {
+			sel, err = p.parseSelectorGroup()
+		}
+		p.inNegation = inNegation
+		if err != nil {
+			return nil, err
+		}
+		if !p.consumeClosingParenthesis() {
+			return nil, p.expectedf(p.i, "')'", "expected ')' but didn't find it")
 		}
 
 		switch name {
-		case "not":
-			return negatedSelector(sel), nil
 		case "has":
-			return hasDescendantSelector(sel), nil
+			return hasSelector{sel: sel}, nil
 		case "haschild":
-			return hasChildSelector(sel), nil
+			return hasSelector{sel: sel, child: true}, nil
 		}
 
-	case "contains", "containsown":
+	case "contains", "containsown", "contains-own":
 		if !p.consumeParenthesis() {
-			return nil, expectedParenthesis
+			return nil, p.expectedf(p.i, "'('", "expected '(' but didn't find it")
 		}
 		if p.i == len(p.s) {
-			return nil, unmatchedParenthesis
+			return nil, p.errorf(p.i, "unmatched '('")
 		}
 		var val string
 		switch p.s[p.i] {
@@ -471,79 +765,205 @@ func (p *parser) parsePseudoclassSelector() (Selector, error) {
 		if err != nil {
 			return nil, err
 		}
-		val = strings.ToLower(val)
 		p.skipWhitespace()
 		if p.i >= len(p.s) {
-			return nil, errors.New("unexpected EOF in pseudo selector")
+			return nil, p.errorf(p.i, "unexpected EOF in pseudo selector")
 		}
 		if !p.consumeClosingParenthesis() {
-			return nil, expectedClosingParenthesis
+			return nil, p.expectedf(p.i, "')'", "expected ')' but didn't find it")
+		}
+
+		s := textSubstrSelector{val: val, own: name != "contains"}
+		if p.opts.ContainsCollapsesWhitespace {
+			s.val, s.collapse = collapseSpace(s.val), true
+		}
+		if !p.opts.CaseSensitiveContains {
+			s.val, s.ignoreCase = strings.ToLower(s.val), true
+		}
+		return s, nil
+
+	case "class-prefix", "class-suffix":
+		if !p.consumeParenthesis() {
+			return nil, p.expectedf(p.i, "'('", "expected '(' but didn't find it")
+		}
+		if p.i == len(p.s) {
+			return nil, p.errorf(p.i, "unmatched '('")
+		}
+		var val string
+		switch p.s[p.i] {
+		case '\'', '"':
+			val, err = p.parseString()
+		default:
+			val, err = p.parseName()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !p.consumeClosingParenthesis() {
+			return nil, p.expectedf(p.i, "')'", "expected ')' but didn't find it")
 		}
 
 		switch name {
-		case "contains":
-			return textSubstrSelector(val), nil
-		case "containsown":
-			return ownTextSubstrSelector(val), nil
+		case "class-prefix":
+			return classAffixSelector{val: val}, nil
+		case "class-suffix":
+			return classAffixSelector{val: val, suffix: true}, nil
+		}
+
+	case "any-link", "link":
+		return linkSelector{name, p.opts.Context}, nil
+	case "visited", "target", "target-within":
+		if ctx := p.opts.Context; ctx == nil || name == "visited" && ctx.Visited == nil {
+			p.warn(start, ":%s depends on the document's context, so it never matches without one", name)
+			return dynamicSelector{name}, nil
 		}
+		return linkSelector{name, p.opts.Context}, nil
+
+	case "lang":
+		if !p.consumeParenthesis() {
+			return nil, p.expectedf(p.i, "'('", "expected '(' but didn't find it")
+		}
+		var ranges []string
+		for {
+			if p.i >= len(p.s) {
+				return nil, p.errorf(p.i, "unexpected EOF in pseudo selector")
+			}
+			var r string
+			switch p.s[p.i] {
+			case '\'', '"':
+				r, err = p.parseString()
+			default:
+				r, err = p.parseIdentifier()
+			}
+			if err != nil {
+				return nil, err
+			}
+			ranges = append(ranges, toLowerASCII(r))
+			p.skipWhitespace()
+			if p.i < len(p.s) && p.s[p.i] == ',' {
+				p.i++
+				p.skipWhitespace()
+				continue
+			}
+			if !p.consumeClosingParenthesis() {
+				return nil, p.expectedf(p.i, "')'", "expected ')' but didn't find it")
+			}
+			return langSelector{ranges}, nil
+		}
+
+	case "dir":
+		if !p.consumeParenthesis() {
+			return nil, p.expectedf(p.i, "'('", "expected '(' but didn't find it")
+		}
+		dir, err := p.parseIdentifier()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consumeClosingParenthesis() {
+			return nil, p.expectedf(p.i, "')'", "expected ')' but didn't find it")
+		}
+		return dirSelector{toLowerASCII(dir)}, nil
 
 	case "matches", "matchesown":
 		if !p.consumeParenthesis() {
-			return nil, expectedParenthesis
+			return nil, p.expectedf(p.i, "'('", "expected '(' but didn't find it")
 		}
 		rx, err := p.parseRegex()
 		if err != nil {
 			return nil, err
 		}
 		if p.i >= len(p.s) {
-			return nil, errors.New("unexpected EOF in pseudo selector")
+			return nil, p.errorf(p.i, "unexpected EOF in pseudo selector")
 		}
 		if !p.consumeClosingParenthesis() {
-			return nil, expectedClosingParenthesis
+			return nil, p.expectedf(p.i, "')'", "expected ')' but didn't find it")
 		}
 
 		switch name {
 		case "matches":
-			return textRegexSelector(rx), nil
+			return textRegexSelector{rx: rx}, nil
 		case "matchesown":
-			return ownTextRegexSelector(rx), nil
+			return textRegexSelector{rx: rx, own: true}, nil
 		}
 
 	case "nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type":
 		if !p.consumeParenthesis() {
-			return nil, expectedParenthesis
+			return nil, p.expectedf(p.i, "'('", "expected '(' but didn't find it")
 		}
 		a, b, err := p.parseNth()
 		if err != nil {
 			return nil, err
 		}
+		var of Sel
+		if (name == "nth-child" || name == "nth-last-child") && p.consumeOf() {
+			// As in Selectors Level 4, only the siblings that match the
+			// selector list after "of" are counted.
+			of, err = p.parseSelectorGroup()
+			if err != nil {
+				return nil, err
+			}
+		}
 		if !p.consumeClosingParenthesis() {
-			return nil, expectedClosingParenthesis
+			p.skipWhitespace()
+			return nil, p.errorf(p.i, "unexpected %s in :%s() argument", p.nextToken(), name)
+		}
+		return nthChildSelector{
+			a:      a,
+			b:      b,
+			last:   name == "nth-last-child" || name == "nth-last-of-type",
+			ofType: name == "nth-of-type" || name == "nth-last-of-type",
+			of:     of,
+		}, nil
+
+	case "nth-col", "nth-last-col":
+		if !p.consumeParenthesis() {
+			return nil, p.expectedf(p.i, "'('", "expected '(' but didn't find it")
+		}
+		a, b, err := p.parseNth()
+		if err != nil {
+			return nil, err
 		}
-		return nthChildSelector(a, b,
-				name == "nth-last-child" || name == "nth-last-of-type",
-				name == "nth-of-type" || name == "nth-last-of-type"),
-			nil
+		if !p.consumeClosingParenthesis() {
+			p.skipWhitespace()
+			return nil, p.errorf(p.i, "unexpected %s in :%s() argument", p.nextToken(), name)
+		}
+		return nthColSelector{a: a, b: b, last: name == "nth-last-col"}, nil
 
 	case "first-child":
-		return nthChildSelector(0, 1, false, false), nil
+		return nthChildSelector{a: 0, b: 1}, nil
 	case "last-child":
-		return nthChildSelector(0, 1, true, false), nil
+		return nthChildSelector{a: 0, b: 1, last: true}, nil
 	case "first-of-type":
-		return nthChildSelector(0, 1, false, true), nil
+		return nthChildSelector{a: 0, b: 1, ofType: true}, nil
 	case "last-of-type":
-		return nthChildSelector(0, 1, true, true), nil
+		return nthChildSelector{a: 0, b: 1, last: true, ofType: true}, nil
 	case "only-child":
-		return onlyChildSelector(false), nil
+		return onlyChildSelector{}, nil
 	case "only-of-type":
-		return onlyChildSelector(true), nil
+		return onlyChildSelector{ofType: true}, nil
 	case "input":
-		return inputSelector, nil
+		return inputSelector{}, nil
+	case "checked", "disabled", "enabled", "required", "optional", "read-write", "read-only":
+		return formStateSelector{name}, nil
 	case "empty":
-		return emptyElementSelector, nil
+		return emptyElementSelector{p.opts.EmptyIgnoresWhitespace}, nil
+	case "root":
+		return rootSelector{}, nil
+	case "scope":
+		return scopeSelector{p.scope}, nil
 	}
 
-	return nil, fmt.Errorf("unknown pseudoclass :%s", name)
+	return nil, p.errorf(start, "unknown pseudoclass :%s", name)
+}
+
+// dynamicPseudoclasses lists the pseudo-classes that depend on the state of
+// a user agent, which a static document doesn't have.
+var dynamicPseudoclasses = map[string]bool{
+	"hover":         true,
+	"active":        true,
+	"focus":         true,
+	"focus-within":  true,
+	"focus-visible": true,
 }
 
 // parseInteger parses a  decimal integer.
@@ -554,23 +974,39 @@ func (p *parser) parseInteger() (int, error) {
 		i++
 	}
 	if i == start {
-		return 0, errors.New("expected integer, but didn't find it.")
+		return 0, p.expectedf(start, "integer", "expected integer, found %s instead", p.nextToken())
 	}
-	p.i = i
 
 	val, err := strconv.Atoi(p.s[start:i])
 	if err != nil {
-		return 0, err
+		return 0, p.errorf(start, "%s", err)
 	}
+	p.i = i
 
 	return val, nil
 }
 
+// consumeOf consumes the keyword "of", with the whitespace around it, in an
+// argument like "2n+1 of .item". It returns true if the keyword was there.
+func (p *parser) consumeOf() bool {
+	i := p.i
+	p.skipWhitespace()
+	if p.i > 0 && strings.IndexByte(" \t\r\n\f", p.s[p.i-1]) != -1 &&
+		p.i+2 < len(p.s) && toLowerASCII(p.s[p.i:p.i+2]) == "of" {
+		p.i += 2
+		if p.skipWhitespace() {
+			return true
+		}
+	}
+	p.i = i
+	return false
+}
+
 // parseNth parses the argument for :nth-child (normally of the form an+b).
 func (p *parser) parseNth() (a, b int, err error) {
 	// initial state
 	if p.i >= len(p.s) {
-		goto eof
+		goto invalid
 	}
 	switch p.s[p.i] {
 	case '-':
@@ -586,6 +1022,7 @@ func (p *parser) parseNth() (a, b int, err error) {
 		p.i++
 		goto readN
 	case 'o', 'O', 'e', 'E':
+		start := p.i
 		id, err := p.parseName()
 		if err != nil {
 			return 0, 0, err
@@ -597,14 +1034,14 @@ func (p *parser) parseNth() (a, b int, err error) {
 		if id == "even" {
 			return 2, 0, nil
 		}
-		return 0, 0, fmt.Errorf("expected 'odd' or 'even', but found '%s' instead", id)
+		return 0, 0, p.expectedf(start, "'odd' or 'even'", "expected 'odd' or 'even', but found '%s' instead", id)
 	default:
 		goto invalid
 	}
 
 positiveA:
 	if p.i >= len(p.s) {
-		goto eof
+		goto invalid
 	}
 	switch p.s[p.i] {
 	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
@@ -623,7 +1060,7 @@ positiveA:
 
 negativeA:
 	if p.i >= len(p.s) {
-		goto eof
+		goto invalid
 	}
 	switch p.s[p.i] {
 	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
@@ -643,7 +1080,8 @@ negativeA:
 
 readA:
 	if p.i >= len(p.s) {
-		goto eof
+		// The number we read as a is actually b.
+		return 0, a, nil
 	}
 	switch p.s[p.i] {
 	case 'n', 'N':
@@ -657,7 +1095,7 @@ readA:
 readN:
 	p.skipWhitespace()
 	if p.i >= len(p.s) {
-		goto eof
+		return a, 0, nil
 	}
 	switch p.s[p.i] {
 	case '+':
@@ -680,26 +1118,44 @@ readN:
 		return a, 0, nil
 	}
 
-eof:
-	return 0, 0, errors.New("unexpected EOF while attempting to parse expression of form an+b")
-
 invalid:
-	return 0, 0, errors.New("unexpected character while attempting to parse expression of form an+b")
+	return 0, 0, p.expectedf(p.i, "an+b expression", "expected an+b expression, found %s instead", p.nextToken())
+}
+
+// nextToken describes the source text at p.i for an error message: the
+// quoted text up to the next whitespace, parenthesis or comma, or "EOF".
+func (p *parser) nextToken() string {
+	if p.i >= len(p.s) {
+		return "EOF"
+	}
+	return strconv.Quote(tokenAt(p.s, p.i))
+}
+
+// tokenAt returns the token in s at offset i: the text up to the next
+// whitespace, parenthesis or comma, or a single one of those characters.
+func tokenAt(s string, i int) string {
+	if i >= len(s) {
+		return ""
+	}
+	end := i + 1
+	if !strings.ContainsRune(" \t\r\n\f(),", rune(s[i])) {
+		for end < len(s) && !strings.ContainsRune(" \t\r\n\f(),", rune(s[end])) {
+			end++
+		}
+	}
+	return s[i:end]
 }
 
 // parseSimpleSelectorSequence parses a selector sequence that applies to
 // a single element.
-func (p *parser) parseSimpleSelectorSequence() (Selector, error) {
-	var result Selector
+func (p *parser) parseSimpleSelectorSequence() (Sel, error) {
+	var result compoundSelector
 
 	if p.i >= len(p.s) {
-		return nil, errors.New("expected selector, found EOF instead")
+		return nil, p.expectedf(p.i, "selector", "expected selector, found EOF instead")
 	}
 
 	switch p.s[p.i] {
-	case '*':
-		// It's the universal selector. Just skip over it, since it doesn't affect the meaning.
-		p.i++
 	case '#', '.', '[', ':':
 		// There's no type selector. Wait to process the other till the main loop.
 	default:
@@ -707,12 +1163,16 @@ func (p *parser) parseSimpleSelectorSequence() (Selector, error) {
 		if err != nil {
 			return nil, err
 		}
-		result = r
+		// The universal selector doesn't affect the meaning, unless it has
+		// a namespace.
+		if r != nil {
+			result = append(result, r)
+		}
 	}
 
 loop:
 	for p.i < len(p.s) {
-		var ns Selector
+		var ns Sel
 		var err error
 		switch p.s[p.i] {
 		case '#':
@@ -722,6 +1182,15 @@ loop:
 		case '[':
 			ns, err = p.parseAttributeSelector()
 		case ':':
+			if p.allowPseudoElement {
+				p.pseudoElement, err = p.parsePseudoElement()
+				if err != nil {
+					return nil, err
+				}
+				if p.pseudoElement != "" {
+					break loop
+				}
+			}
 			ns, err = p.parsePseudoclassSelector()
 		default:
 			break loop
@@ -729,31 +1198,108 @@ loop:
 		if err != nil {
 			return nil, err
 		}
-		if result == nil {
-			result = ns
-		} else {
-			result = intersectionSelector(result, ns)
+		result = append(result, ns)
+	}
+
+	return result, nil
+}
+
+// parseForgivingList parses the argument of :is() or :where(), up to and
+// including the closing parenthesis. The argument is a forgiving selector
+// list: a member that fails to parse is dropped with a warning, instead of
+// making the whole selector invalid, and empty members are ignored.
+func (p *parser) parseForgivingList(name string) (Sel, error) {
+	base := p.i
+	spans, end := scanSelectorList(p.s[base:], true)
+	if base+end == len(p.s) {
+		p.i = len(p.s)
+		return nil, p.expectedf(p.i, "')'", "expected ')' to close :%s(), found EOF instead", name)
+	}
+
+	var members unionSelector
+	for _, span := range spans {
+		start, stop := base+span[0], base+span[1]
+		sub := &parser{s: p.s[:stop], i: start, inNegation: p.inNegation, scope: p.scope, opts: p.opts}
+		sub.skipWhitespace()
+		if sub.i == stop {
+			continue
+		}
+		m, err := sub.parseSelector()
+		if err == nil && sub.i < stop {
+			err = sub.errorf(sub.i, "unexpected %s", sub.nextToken())
+		}
+		p.features |= sub.features
+		if err != nil {
+			msg := err.Error()
+			if se, ok := err.(*SyntaxError); ok {
+				msg = se.Msg
+			}
+			p.i = stop
+			p.warn(start, "invalid selector in :%s() ignored: %s", name, msg)
+			continue
 		}
+		p.warnings = append(p.warnings, sub.warnings...)
+		members = append(members, m)
 	}
+	p.i = base + end + 1
 
-	if result == nil {
-		result = func(n *html.Node) bool {
-			return true
+	if len(members) == 1 {
+		return members[0], nil
+	}
+	return members, nil
+}
+
+// parseRelativeSelector parses a selector that may start with a combinator,
+// as in the argument of :has(). Without one, the descendant combinator is
+// implied.
+func (p *parser) parseRelativeSelector() (Sel, error) {
+	p.skipWhitespace()
+	combinator := byte(' ')
+	if p.i < len(p.s) {
+		switch c := p.s[p.i]; c {
+		case '>':
+			p.features |= FeatureCombinators
+			combinator = c
+			p.i++
+		case '+', '~':
+			p.features |= FeatureSiblings
+			combinator = c
+			p.i++
 		}
 	}
 
-	return result, nil
+	sel, err := p.parseSelector()
+	if err != nil {
+		return nil, err
+	}
+	return relativeSelector{combinator: combinator, sel: sel}, nil
 }
 
 // parseSelector parses a selector that may include combinators.
-func (p *parser) parseSelector() (result Selector, err error) {
+func (p *parser) parseSelector() (result Sel, err error) {
 	p.skipWhitespace()
 	result, err = p.parseSimpleSelectorSequence()
 	if err != nil {
 		return
 	}
-
 	for {
+		if p.pseudoElement != "" && p.opts.PseudoElements {
+			// Each member of the list may end with a pseudo-element,
+			// which doesn't affect what it matches.
+			p.skipWhitespace()
+			if p.i < len(p.s) && p.s[p.i] != ',' {
+				return nil, p.errorf(p.i, "unexpected %s after pseudo-element ::%s", p.nextToken(), p.pseudoElement)
+			}
+			p.pseudoElement = ""
+			return result, nil
+		}
+		if p.pseudoElement != "" {
+			if err := p.checkPseudoElementLast(); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+
 		var combinator byte
 		if p.skipWhitespace() {
 			combinator = ' '
@@ -764,9 +1310,25 @@ func (p *parser) parseSelector() (result Selector, err error) {
 
 		switch p.s[p.i] {
 		case '+', '>', '~':
+			start := p.i
 			combinator = p.s[p.i]
 			p.i++
 			p.skipWhitespace()
+			if p.opts.QuirksCombinators && p.i < len(p.s) && p.s[p.i] == combinator {
+				for p.i < len(p.s) && p.s[p.i] == combinator {
+					p.i++
+					p.skipWhitespace()
+				}
+				p.warn(start, "repeated combinator %q treated as a single one", combinator)
+			}
+		case '|':
+			// The column combinator, ||. A single '|' starts a type
+			// selector with a namespace prefix, like |p.
+			if p.i+1 < len(p.s) && p.s[p.i+1] == '|' {
+				combinator = '|'
+				p.i += 2
+				p.skipWhitespace()
+			}
 		case ',', ')':
 			// These characters can't begin a selector, but they can legally occur after one.
 			return
@@ -782,38 +1344,69 @@ func (p *parser) parseSelector() (result Selector, err error) {
 		}
 
 		switch combinator {
-		case ' ':
-			result = descendantSelector(result, c)
-		case '>':
-			result = childSelector(result, c)
-		case '+':
-			result = siblingSelector(result, c, true)
-		case '~':
-			result = siblingSelector(result, c, false)
+		case ' ', '>':
+			p.features |= FeatureCombinators
+		case '+', '~':
+			p.features |= FeatureSiblings
+		case '|':
+			p.features |= FeatureStructural
 		}
-	}
 
-	panic("unreachable")
+		result = combinedSelector{first: result, combinator: combinator, second: c}
+	}
 }
 
 // parseSelectorGroup parses a group of selectors, separated by commas.
-func (p *parser) parseSelectorGroup() (result Selector, err error) {
-	result, err = p.parseSelector()
+func (p *parser) parseSelectorGroup() (result Sel, err error) {
+	return p.parseGroup(p.parseSelector)
+}
+
+// parseGroup is like parseSelectorGroup, but it parses the members with
+// parse.
+func (p *parser) parseGroup(parse func() (Sel, error)) (Sel, error) {
+	group, err := p.parseList(parse)
 	if err != nil {
-		return
+		return nil, err
+	}
+
+	if len(group) == 1 {
+		return group[0], nil
+	}
+	return unionSelector(group), nil
+}
+
+// parseSelectorList parses a group of selectors, separated by commas,
+// and returns them separately.
+func (p *parser) parseSelectorList() (result []Sel, err error) {
+	return p.parseList(p.parseSelector)
+}
+
+// parseList is like parseSelectorList, but it parses the members with parse.
+func (p *parser) parseList(parse func() (Sel, error)) (result []Sel, err error) {
+	c, err := parse()
+	if err != nil {
+		return nil, err
 	}
+	result = []Sel{c}
 
 	for p.i < len(p.s) {
 		if p.s[p.i] != ',' {
 			return result, nil
 		}
 		p.i++
-		c, err := p.parseSelector()
+		p.skipWhitespace()
+		if p.i < len(p.s) && p.s[p.i] == ',' {
+			return nil, p.errorf(p.i, "empty selector in selector group")
+		}
+		if p.i >= len(p.s) || p.s[p.i] == ')' {
+			return nil, p.expectedf(p.i, "selector", "expected selector after ','")
+		}
+		c, err := parse()
 		if err != nil {
 			return nil, err
 		}
-		result = unionSelector(result, c)
+		result = append(result, c)
 	}
 
-	return
+	return result, nil
 }
@@ -1,7 +1,12 @@
 package cascadia
 
 import (
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
+
+	"golang.org/x/net/html"
 )
 
 var identifierTests = map[string]string{
@@ -10,6 +15,30 @@ var identifierTests = map[string]string{
 	"-x":        "-x",
 	`r\e9 sumé`: "résumé",
 	`a\"b`:      `a"b`,
+	`foo\:bar`:  "foo:bar",
+	`col\.12`:   "col.12",
+	`\31 23`:    "123",
+	`\000031x`:  "1x",
+	`\0 x`:      "\ufffdx",
+	`\110000 x`: "\ufffdx",
+	`a\20 b`:    "a b",
+	`\`:         "",
+	`md\:flex`:  "md:flex",
+	`w-1\/2`:    "w-1/2",
+	`\26 B`:     "&B",
+	`\26B`:      "\u026b",
+	`\26\42`:    "&B",
+	`a\`:        "",
+
+	`\--state`: "--state",
+	`--state`:  "--state",
+	`--`:       "--",
+	`-`:        "",
+	`-9`:       "",
+	`\D800 x`:  "\ufffdx",
+	`\1F600 x`: "\U0001F600x",
+	`\é`:       "é",
+	`a\ b`:     "a b",
 }
 
 func TestParseIdentifier(t *testing.T) {
@@ -51,6 +80,11 @@ var stringTests = map[string]string{
 	"'x\\\r\nx'":  "xx",
 	`"r\e9 sumé"`: "résumé",
 	`"a\"b"`:      `a"b`,
+	`'it\'s'`:     "it's",
+	`"a\22 b"`:    `a"b`,
+	`"a b"`:       "a b",
+	`"a\`:         "",
+	`'\26 B'`:     "&B",
 }
 
 func TestParseString(t *testing.T) {
@@ -84,3 +118,415 @@ func TestParseString(t *testing.T) {
 		}
 	}
 }
+
+// invalidSelectorTests maps selectors that should fail to compile to a
+// substring of the expected error message.
+var invalidSelectorTests = map[string]string{
+	"[href#=(a(b)]":  "EOF in regular expression",
+	"[href#=(a+++)]": "invalid nested repetition operator",
+	`[href#="a(b"]`:  "missing closing )",
+	`[href#="a" i]`:  "expected ']'",
+	"div,":           "expected selector after ','",
+	"div, ":          "expected selector after ','",
+	"div,,p":         "empty selector in selector group",
+	"div, ,p":        "empty selector in selector group",
+	":has(p, )":      "expected selector after ','",
+	":has(p,,a)":     "empty selector in selector group",
+	":has(>)":        "expected identifier",
+	":is(a, b":       "expected ')' to close :is(), found EOF instead",
+	":where":         "expected '(' but didn't find it",
+	":has(> > a)":    "expected identifier",
+
+	`p:matches(x{2,1})`: "invalid repeat count",
+	`p:matchesOwn(a**)`: "invalid nested repetition operator",
+
+	":not(:not(div))":  ":not() cannot be nested",
+	":not(div >)":      "expected identifier",
+	":not(div p":       "expected ')' to close :not(), found EOF instead",
+	":not(div, )":      "expected selector after ','",
+	":not(div,,p)":     "empty selector in selector group",
+	":not()":           ":not() requires an argument",
+	"div:not( )":       ":not() requires an argument",
+	":not(:not(.a) b)": ":not() cannot be nested",
+	"li:not(.active":   "expected ')' to close :not(), found EOF instead",
+}
+
+func TestInvalidSelectors(t *testing.T) {
+	for sel, want := range invalidSelectorTests {
+		_, err := Compile(sel)
+		if err == nil {
+			t.Errorf("compiling %q: got no error, want %q", sel, want)
+			continue
+		}
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("compiling %q: got error (%s), want %q", sel, err, want)
+		}
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	tests := []struct {
+		sel    string
+		msg    string
+		offset int
+	}{
+		{"div[foo=]", "expected attribute value", 8},
+		{"div[foo", "unexpected EOF in attribute selector", 7},
+		{"p[a~b]", `expected equality operator, found "~b" instead`, 3},
+		{"div )", "1 bytes left over", 4},
+		{"div,,p", "empty selector in selector group", 4},
+		{"a >", "expected selector, found EOF instead", 3},
+		{":foo", "unknown pseudoclass :foo", 0},
+		{"p :not(:not(div))", ":not() cannot be nested", 7},
+		{`p:contains("abc`, "EOF in string", 15},
+		{"[href#=(a+++)]", "invalid nested repetition operator", 7},
+		{"svg|rect, foo|rect", `undeclared namespace prefix "foo"`, 10},
+		{"a:nth-child(2n+)", `expected integer, found ")" instead`, 15},
+		{"li:nth-child(odds)", "expected 'odd' or 'even', but found 'odds' instead", 13},
+		{"li:nth-child(foo)", `expected an+b expression, found "foo" instead`, 13},
+		{"li:nth-child(99999999999999999999)", "value out of range", 13},
+		{"a:has(b", "expected ')' but didn't find it", 7},
+	}
+	for _, test := range tests {
+		_, err := Compile(test.sel)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("%s: got error %v, want a *SyntaxError", test.sel, err)
+			continue
+		}
+		if se.Input != test.sel || !strings.Contains(se.Msg, test.msg) || se.Offset != test.offset {
+			t.Errorf("%s: got %q at offset %d, want %q at offset %d", test.sel, se.Msg, se.Offset, test.msg, test.offset)
+		}
+	}
+
+	_, err := Compile("div[foo=]")
+	if want := `parsing "div[foo=]": expected attribute value at offset 8`; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+}
+
+func TestSyntaxErrorDetails(t *testing.T) {
+	tests := []struct {
+		sel             string
+		offset          int
+		token, expected string
+	}{
+		{"div )", 4, ")", "end of selector"},
+		{"div p]x", 5, "]x", "end of selector"},
+		{"a >", 3, "", "selector"},
+		{"div[foo=]", 8, "]", "attribute value"},
+		{"p:has(a", 7, "", "')'"},
+		{":not(a b", 8, "", "')'"},
+		{"a:nth-child(2n+)", 15, ")", "integer"},
+		{"div.", 4, "", "identifier"},
+		{"div.1x", 4, "1x", "identifier"},
+		{":foo", 0, ":foo", ""},
+		{"div[foo", 7, "", ""},
+	}
+	for _, test := range tests {
+		_, err := Compile(test.sel)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("%s: got error %v, want a *SyntaxError", test.sel, err)
+			continue
+		}
+		if se.Offset != test.offset || se.Token != test.token || se.Expected != test.expected {
+			t.Errorf("%s: got offset %d, token %q, expected %q; want %d, %q, %q", test.sel, se.Offset, se.Token, se.Expected, test.offset, test.token, test.expected)
+		}
+	}
+}
+
+func TestMaxIdentifierLength(t *testing.T) {
+	opts := Options{MaxIdentifierLength: 8}
+	for _, sel := range []string{
+		"abcdefgh",
+		"#abcdefgh.abcdefgh",
+		"[abcdefgh='abcdefgh']",
+		`[a#=(abcdef)]`,
+		`:contains("ab\63 defgh")`,
+	} {
+		if _, err := CompileWithOptions(sel, opts); err != nil {
+			t.Errorf("%s: unexpected error: %s", sel, err)
+		}
+	}
+
+	for _, sel := range []string{
+		"abcdefghi",
+		"#abcdefghi",
+		".abcdefghi",
+		"[abcdefghi]",
+		"[a=abcdefghi]",
+		"[a='abcdefghi']",
+		`[a#=(abcdefg)]`,
+		`:contains("abcdefghi")`,
+		`.ab\63 defghi`,
+		"p " + strings.Repeat("x", 1<<20),
+	} {
+		_, err := CompileWithOptions(sel, opts)
+		if err == nil || !strings.Contains(err.Error(), "exceeds the limit of 8") {
+			t.Errorf("%.40s: got error %v, want length limit error", sel, err)
+		}
+		if _, err := Compile(sel); err != nil {
+			t.Errorf("%.40s: Compile without a limit: %s", sel, err)
+		}
+	}
+}
+
+func TestQuirksCombinators(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div><p id="a"></p><b id="b"></b><p id="c"><i></i></p></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sel, equiv string
+	}{
+		{"div >> p", "div > p"},
+		{"div>>p", "div > p"},
+		{"#a + + b", "#a + b"},
+		{"#a ~~~ p", "#a ~ p"},
+		{"div >> p > > i", "div > p > i"},
+	}
+	for _, test := range tests {
+		if _, err := Compile(test.sel); err == nil {
+			t.Errorf("%s: Compile accepted a doubled combinator", test.sel)
+		}
+
+		var warnings []Diagnostic
+		opts := Options{
+			QuirksCombinators: true,
+			Warn:              func(d Diagnostic) { warnings = append(warnings, d) },
+		}
+		s, err := CompileWithOptions(test.sel, opts)
+		if err != nil {
+			t.Errorf("%s: %s", test.sel, err)
+			continue
+		}
+		if got, want := s.MatchAll(doc), MustCompile(test.equiv).MatchAll(doc); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %d matches, want %d like %s", test.sel, len(got), len(want), test.equiv)
+		}
+		if len(warnings) == 0 {
+			t.Errorf("%s: no warning", test.sel)
+		}
+		for _, w := range warnings {
+			if w.Severity != SeverityWarning || !strings.Contains(w.Message, "repeated combinator") {
+				t.Errorf("%s: unexpected warning %+v", test.sel, w)
+			}
+		}
+	}
+
+	for _, sel := range []string{"a > + b", "a + ~ b", "a >"} {
+		if _, err := CompileWithOptions(sel, Options{QuirksCombinators: true}); err == nil {
+			t.Errorf("%s: expected an error", sel)
+		}
+	}
+}
+
+func TestEmptyIgnoresWhitespace(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader("<p id=a></p><p id=b> \n\t</p><p id=c><!-- x --> </p><p id=d> x </p><p id=e> <b></b> </p>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		opts Options
+		want []string
+	}{
+		{Options{}, []string{"a"}},
+		{Options{EmptyIgnoresWhitespace: true}, []string{"a", "b", "c"}},
+	} {
+		s, err := CompileWithOptions("p:empty", test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, n := range s.MatchAll(doc) {
+			got = append(got, attributeValue(n, "id"))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("EmptyIgnoresWhitespace=%v: got %q, want %q", test.opts.EmptyIgnoresWhitespace, got, test.want)
+		}
+	}
+}
+
+func TestCaseSensitiveContains(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p id=a>Say "Hello"</p><p id=b>say hello</p><p id=c>Say <b>HELLO</b></p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		opts Options
+		sel  string
+		want []string
+	}{
+		{Options{}, `p:contains('SAY "hello"')`, []string{"a"}},
+		{Options{}, `p:contains("say hello")`, []string{"b", "c"}},
+		{Options{}, `p:containsOwn("SAY")`, []string{"a", "b", "c"}},
+		{Options{CaseSensitiveContains: true}, `p:contains("say hello")`, []string{"b"}},
+		{Options{CaseSensitiveContains: true}, `p:contains("Say HELLO")`, []string{"c"}},
+		{Options{CaseSensitiveContains: true}, `p:containsOwn("Say")`, []string{"a", "c"}},
+	} {
+		s, err := CompileWithOptions(test.sel, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, n := range s.MatchAll(doc) {
+			got = append(got, attributeValue(n, "id"))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s with CaseSensitiveContains=%v: got %q, want %q", test.sel, test.opts.CaseSensitiveContains, got, test.want)
+		}
+	}
+}
+
+func TestContainsCollapsesWhitespace(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader("<table><tr><td id=a>Subtotal</td><td id=b>10</td></tr>" +
+		"<tr><td id=c>Total\n  due</td><td id=d>12</td></tr><tr><td id=e>Total\t <b>due</b></td></tr></table>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		opts Options
+		sel  string
+		want []string
+	}{
+		{Options{}, `td:contains("Total due")`, nil},
+		{Options{}, `td:containsOwn("total\a   due")`, []string{"c"}},
+		{Options{ContainsCollapsesWhitespace: true}, `td:contains("Total due"), td:contains("Subtotal10")`, []string{"c", "e"}},
+		{Options{ContainsCollapsesWhitespace: true}, `td:containsOwn("Total   due")`, []string{"c"}},
+		{Options{ContainsCollapsesWhitespace: true, CaseSensitiveContains: true}, `:containsOwn("total\a due")`, nil},
+	} {
+		s, err := CompileWithOptions(test.sel, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, n := range s.MatchAll(doc) {
+			got = append(got, attributeValue(n, "id"))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s with ContainsCollapsesWhitespace=%v: got %q, want %q", test.sel, test.opts.ContainsCollapsesWhitespace, got, test.want)
+		}
+	}
+}
+
+func TestStrict(t *testing.T) {
+	for sel, want := range map[string]string{
+		`p:contains("x")`:           ":contains is not standard CSS",
+		`div :not(p, :haschild(b))`: ":haschild is not standard CSS",
+		`a[href#=(\.pdf$)]`:         "the #= operator is not standard CSS",
+		`:input`:                    ":input is not standard CSS",
+	} {
+		if _, err := CompileWithOptions(sel, Options{Strict: true}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", sel, err, want)
+		}
+		if _, err := CompileWithOptions(sel, Options{}); err != nil {
+			t.Errorf("%s without Strict: %s", sel, err)
+		}
+	}
+	for _, sel := range []string{`p:not(.a) > a[href^=x]:nth-child(2n of .b)`, `:is(h1, h2):has(+ p)`, `td:lang(en)`} {
+		if _, err := CompileWithOptions(sel, Options{Strict: true}); err != nil {
+			t.Errorf("%s: %s", sel, err)
+		}
+	}
+}
+
+func TestQuirksMode(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p id="Main" class="Note x"></p><p id="main" class="note"></p><p id="other"></p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		sel          string
+		quirks, want int
+	}{
+		{"#MAIN", 2, 0},
+		{".NOTE", 2, 0},
+		{"p.note#main", 2, 1},
+		{"#main, #Main, .x, .y, .z", 2, 2},
+		{"[id=MAIN]", 0, 0},
+	} {
+		for _, quirks := range []bool{false, true} {
+			s, err := CompileWithOptions(test.sel, Options{QuirksMode: quirks})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := test.want
+			if quirks {
+				want = test.quirks
+			}
+			if got := len(s.MatchAll(doc)); got != want {
+				t.Errorf("%s with QuirksMode=%v: got %d matches, want %d", test.sel, quirks, got, want)
+			}
+		}
+	}
+}
+
+func TestPseudoElementsOption(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p class="a">x</p><a href="/">y</a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := CompileWithOptions(`p.a::first-line, a:before ,li::marker`, Options{PseudoElements: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(s.MatchAll(doc)); got != 2 {
+		t.Errorf("got %d matches, want 2", got)
+	}
+
+	for _, sel := range []string{`p::before`, `p::before > a`, `p::before::after`} {
+		if _, err := CompileWithOptions(sel, Options{PseudoElements: sel != `p::before`}); err == nil {
+			t.Errorf("%s: got no error", sel)
+		}
+	}
+}
+
+func TestForgivingListWarnings(t *testing.T) {
+	sel := `p:is(.a, [=x], a:hover, ) b`
+	var warnings []Diagnostic
+	opts := Options{
+		DynamicPseudoclasses: true,
+		Warn:                 func(d Diagnostic) { warnings = append(warnings, d) },
+	}
+	if _, err := CompileWithOptions(sel, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		text, message string
+	}{
+		{" [=x]", "invalid selector in :is() ignored: expected identifier"},
+		{":hover", "never matches"},
+	}
+	if len(warnings) != len(want) {
+		t.Fatalf("got %d warnings, want %d: %v", len(warnings), len(want), warnings)
+	}
+	for i, w := range warnings {
+		if got := sel[w.Start:w.End]; got != want[i].text || !strings.Contains(w.Message, want[i].message) {
+			t.Errorf("warning %d: got %q for %q, want %q for %q", i, w.Message, got, want[i].message, want[i].text)
+		}
+	}
+}
+
+func TestDynamicPseudoclasses(t *testing.T) {
+	sel := `a:HOVER:focus-within`
+	if _, err := Compile(sel); err == nil || !strings.Contains(err.Error(), "unknown pseudoclass :hover") {
+		t.Errorf("Compile: got error %v, want unknown pseudoclass", err)
+	}
+
+	p := &parser{s: sel, opts: Options{DynamicPseudoclasses: true}}
+	m, err := p.parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.String(), `a:hover:focus-within`; got != want {
+		t.Errorf("String: got %q, want %q", got, want)
+	}
+	if len(p.warnings) != 2 {
+		t.Errorf("got %d warnings, want 2: %v", len(p.warnings), p.warnings)
+	}
+}
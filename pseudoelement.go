@@ -0,0 +1,99 @@
+package cascadia
+
+// A PseudoElementSel is a selector parsed by ParseWithPseudoElement. It
+// matches the originating elements of the pseudo-element, if any: for
+// "p::first-line", the p elements.
+type PseudoElementSel struct {
+	Sel
+	pseudoElement string
+}
+
+// PseudoElement returns the name of the pseudo-element at the end of the
+// selector, in lowercase and without the colons, such as "before", or the
+// empty string if there is none.
+func (s PseudoElementSel) PseudoElement() string {
+	return s.pseudoElement
+}
+
+// String returns the selector as CSS text, including the pseudo-element.
+func (s PseudoElementSel) String() string {
+	if s.pseudoElement == "" {
+		return s.Sel.String()
+	}
+	return s.Sel.String() + "::" + s.pseudoElement
+}
+
+// Specificity returns the specificity of the selector. As in CSS, the
+// pseudo-element counts like a type selector.
+func (s PseudoElementSel) Specificity() Specificity {
+	if s.pseudoElement == "" {
+		return s.Sel.Specificity()
+	}
+	return s.Sel.Specificity().Add(Specificity{0, 0, 1})
+}
+
+// ParseWithPseudoElement is like Parse, but it accepts a selector that ends
+// with a pseudo-element, such as "p::first-line" or "a.external::after",
+// as found in stylesheets. The four pseudo-elements from CSS 2 may also be
+// written with a single colon: "p:before".
+//
+// A pseudo-element may only come at the very end, and only one is
+// allowed, so sel can't be a selector list; parse the members of a list
+// separately.
+func ParseWithPseudoElement(sel string) (PseudoElementSel, error) {
+	p := &parser{s: sel, allowPseudoElement: true}
+	m, err := p.parse()
+	if err != nil {
+		return PseudoElementSel{}, err
+	}
+	if _, ok := m.(unionSelector); ok {
+		return PseudoElementSel{}, p.errorf(0, "selector lists are not allowed")
+	}
+	return PseudoElementSel{Sel: m, pseudoElement: p.pseudoElement}, nil
+}
+
+// legacyPseudoElements lists the pseudo-elements that may be written with
+// a single colon.
+var legacyPseudoElements = map[string]bool{
+	"before":       true,
+	"after":        true,
+	"first-line":   true,
+	"first-letter": true,
+}
+
+// parsePseudoElement parses a pseudo-element at p.i, and returns its name
+// in lowercase. If there is a pseudo-class there instead, it returns the
+// empty string without consuming anything.
+func (p *parser) parsePseudoElement() (string, error) {
+	start := p.i
+	legacy := p.i+1 >= len(p.s) || p.s[p.i+1] != ':'
+	if legacy {
+		p.i++
+	} else {
+		p.i += 2
+	}
+	name, err := p.parseIdentifier()
+	if err != nil {
+		if legacy {
+			p.i = start
+			return "", nil
+		}
+		return "", err
+	}
+	name = toLowerASCII(name)
+	if legacy && !legacyPseudoElements[name] {
+		p.i = start
+		return "", nil
+	}
+	return name, nil
+}
+
+// checkPseudoElementLast returns an error if anything but whitespace follows
+// the pseudo-element that has just been parsed.
+func (p *parser) checkPseudoElementLast() error {
+	p.skipWhitespace()
+	if p.i < len(p.s) {
+		return p.errorf(p.i, "unexpected %s after pseudo-element ::%s", p.nextToken(), p.pseudoElement)
+	}
+	return nil
+}
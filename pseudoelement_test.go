@@ -0,0 +1,67 @@
+package cascadia
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestParseWithPseudoElement(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p id="1"></p><div><p id="2" class="x"></p></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sel, pseudo, str string
+		spec             Specificity
+		matches          int
+	}{
+		{"p::before", "before", "p::before", Specificity{0, 0, 2}, 2},
+		{"div > p.x::First-Line", "first-line", "div > p.x::first-line", Specificity{0, 1, 3}, 1},
+		{"p:after ", "after", "p::after", Specificity{0, 0, 2}, 2},
+		{"p:first-child::marker", "marker", "p:first-child::marker", Specificity{0, 1, 2}, 2},
+		{"::selection", "selection", "*::selection", Specificity{0, 0, 1}, 7},
+		{"p:not(.x)", "", "p:not(.x)", Specificity{0, 1, 1}, 1},
+	}
+	for _, test := range tests {
+		sel, err := ParseWithPseudoElement(test.sel)
+		if err != nil {
+			t.Errorf("%s: %s", test.sel, err)
+			continue
+		}
+		if got := sel.PseudoElement(); got != test.pseudo {
+			t.Errorf("%s: got pseudo-element %q, want %q", test.sel, got, test.pseudo)
+		}
+		if got := sel.String(); got != test.str {
+			t.Errorf("%s: got String %q, want %q", test.sel, got, test.str)
+		}
+		if got := sel.Specificity(); got != test.spec {
+			t.Errorf("%s: got specificity %v, want %v", test.sel, got, test.spec)
+		}
+		if got := len(Selector(sel.Match).MatchAll(doc)); got != test.matches {
+			t.Errorf("%s: got %d matches, want %d", test.sel, got, test.matches)
+		}
+	}
+
+	for sel, want := range map[string]string{
+		"p::before span":      `unexpected "span" after pseudo-element ::before`,
+		"p::before::after":    `unexpected "::after" after pseudo-element ::before`,
+		"p::before.x":         `unexpected ".x" after pseudo-element ::before`,
+		"a::before, b":        `unexpected "," after pseudo-element ::before`,
+		"a, b::before":        "selector lists are not allowed",
+		"p:not(a::before)":    "expected identifier",
+		"p:has(b::after)":     "expected identifier",
+		"p::":                 "expected identifier",
+		"p:empty::before:foo": `unexpected ":foo"`,
+	} {
+		if _, err := ParseWithPseudoElement(sel); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", sel, err, want)
+		}
+	}
+
+	if _, err := Parse("p::before"); err == nil {
+		t.Error("Parse accepted a pseudo-element")
+	}
+}
@@ -0,0 +1,66 @@
+package cascadia
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// A ResolvedURL is an element matched by MatchAllResolvedAttr, with the
+// absolute form of the URL in one of its attributes.
+type ResolvedURL struct {
+	Node *html.Node
+	URL  *url.URL
+}
+
+// MatchAllResolvedAttr returns the elements that match the selector, from
+// root and its descendants, each with the URL in its attribute named key
+// resolved against the document's base URL, as in a[href] links.
+//
+// As in a browser, the base URL is the href of the first <base> element
+// with an href attribute under root, resolved against base; if there is no
+// such element, it is base itself. base may be nil, in which case URLs
+// that can't be resolved stay relative.
+//
+// Elements that lack the attribute, or whose attribute isn't a valid URL,
+// are skipped.
+func (s Selector) MatchAllResolvedAttr(root *html.Node, base *url.URL, key string) []ResolvedURL {
+	key = toLowerASCII(key)
+	base = documentBase(root, base)
+
+	var result []ResolvedURL
+	for _, n := range s.MatchAll(root) {
+		if !(attrSelector{key: key}).Match(n) {
+			continue
+		}
+		u, err := url.Parse(strings.TrimSpace(attributeValue(n, key)))
+		if err != nil {
+			continue
+		}
+		if base != nil {
+			u = base.ResolveReference(u)
+		}
+		result = append(result, ResolvedURL{Node: n, URL: u})
+	}
+	return result
+}
+
+// documentBase returns the base URL of the document rooted at root, given
+// the fallback URL base.
+func documentBase(root *html.Node, base *url.URL) *url.URL {
+	for n := root; n != nil; n = nextInSubtree(n, root) {
+		if n.Type != html.ElementNode || n.Data != "base" || !(attrSelector{key: "href"}).Match(n) {
+			continue
+		}
+		u, err := url.Parse(strings.TrimSpace(attributeValue(n, "href")))
+		if err != nil {
+			return base
+		}
+		if base != nil {
+			u = base.ResolveReference(u)
+		}
+		return u
+	}
+	return base
+}
@@ -0,0 +1,41 @@
+package cascadia
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestMatchAllResolvedAttr(t *testing.T) {
+	page := `<a href="/about">About</a><a>No link</a><a href=" b/c?x=1 ">B</a><a href="https://other.example/">Other</a><a href="http://[::1">Bad</a>`
+	base, _ := url.Parse("https://example.com/dir/page.html")
+
+	tests := []struct {
+		doc  string
+		base *url.URL
+		want []string
+	}{
+		{page, base, []string{"https://example.com/about", "https://example.com/dir/b/c?x=1", "https://other.example/"}},
+		{page, nil, []string{"/about", "b/c?x=1", "https://other.example/"}},
+		{`<head><base href="/root/"><base href="/ignored/"></head>` + page, base, []string{"https://example.com/about", "https://example.com/root/b/c?x=1", "https://other.example/"}},
+		{`<head><base target="_blank"><base href="https://cdn.example/x/"></head>` + page, nil, []string{"https://cdn.example/about", "https://cdn.example/x/b/c?x=1", "https://other.example/"}},
+	}
+	for i, test := range tests {
+		doc, err := html.Parse(strings.NewReader(test.doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range MustCompile("a").MatchAllResolvedAttr(doc, test.base, "HREF") {
+			if r.Node.Data != "a" {
+				t.Errorf("test %d: matched %s", i, nodeString(r.Node))
+			}
+			got = append(got, r.URL.String())
+		}
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("test %d: got %q, want %q", i, got, test.want)
+		}
+	}
+}
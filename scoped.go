@@ -0,0 +1,102 @@
+package cascadia
+
+import (
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// A ScopedSelector is a selector list that is matched relative to a scope
+// element, as with Element.querySelectorAll in a browser. :scope refers to
+// the scope element, and a member of the list that starts with a
+// combinator, like "> li" or "~ p", is relative to it, as if it started with
+// :scope. Other members are matched as usual, so "div p" matches p elements
+// with a div ancestor even if the div is outside the scope.
+//
+// A ScopedSelector may be used by several goroutines, but they take turns
+// matching it.
+type ScopedSelector struct {
+	mu    sync.Mutex
+	sel   Sel
+	scope *scopeRef
+}
+
+// CompileScoped compiles a selector list for matching relative to a scope
+// element.
+func CompileScoped(sel string) (*ScopedSelector, error) {
+	scope := new(scopeRef)
+	p := &parser{s: sel, scope: scope}
+	compiled, err := p.parseGroup(p.parseScopedSelector)
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.s) {
+		return nil, p.expectedf(p.i, "end of selector", "%d bytes left over", len(p.s)-p.i)
+	}
+	return &ScopedSelector{sel: compiled, scope: scope}, nil
+}
+
+// parseScopedSelector parses a member of a scoped selector list, which may
+// start with a combinator.
+func (p *parser) parseScopedSelector() (Sel, error) {
+	p.skipWhitespace()
+	if p.i < len(p.s) {
+		switch p.s[p.i] {
+		case '>', '+', '~':
+			rel, err := p.parseRelativeSelector()
+			if err != nil {
+				return nil, err
+			}
+			return scopedRelativeSelector{rel.(relativeSelector), p.scope}, nil
+		}
+	}
+	return p.parseSelector()
+}
+
+// scopedRelativeSelector matches the elements that match a relative
+// selector, like "> li", with the scope element as its anchor.
+type scopedRelativeSelector struct {
+	relativeSelector
+	scope *scopeRef
+}
+
+func (s scopedRelativeSelector) Match(n *html.Node) bool {
+	return n.Type == html.ElementNode && s.scope.node != nil && matchRelative(s.sel, n, s.scope.node, s.combinator)
+}
+
+// String returns the selector list in normalized form.
+func (s *ScopedSelector) String() string {
+	return s.sel.String()
+}
+
+// MatchAll returns the elements that match the selector, from root and its
+// descendants, with scope as the scope element. They are in document order.
+func (s *ScopedSelector) MatchAll(scope, root *html.Node) []*html.Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scope.node = scope
+	defer func() { s.scope.node = nil }()
+	return Selector(s.sel.Match).MatchAll(root)
+}
+
+// QueryAll returns the descendants of scope that match the selector, with
+// scope as the scope element, like scope.querySelectorAll in a browser.
+// Elements outside scope, such as the ones that "~ p" matches, are left
+// out; use MatchAll to find them.
+func (s *ScopedSelector) QueryAll(scope *html.Node) []*html.Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scope.node = scope
+	defer func() { s.scope.node = nil }()
+	return Selector(s.sel.Match).MatchAllDescendants(scope)
+}
+
+// Match returns whether n matches the selector, with scope as the scope
+// element.
+func (s *ScopedSelector) Match(scope, n *html.Node) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scope.node = scope
+	defer func() { s.scope.node = nil }()
+	return s.sel.Match(n)
+}
@@ -0,0 +1,76 @@
+package cascadia
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestScopedSelector(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div id="d">
+		<ul id="u1"><li id="1"><ul id="u2"><li id="2"></li></ul></li><li id="3" class="x"></li></ul>
+		<p id="p1"></p><p id="p2"></p>
+	</div><p id="p3"></p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u1 := MustCompile("#u1").MatchFirst(doc)
+	u2 := MustCompile("#u2").MatchFirst(doc)
+
+	ids := func(nodes []*html.Node) string {
+		var ids []string
+		for _, n := range nodes {
+			ids = append(ids, attributeValue(n, "id"))
+		}
+		return strings.Join(ids, " ")
+	}
+
+	for _, test := range []struct {
+		sel      string
+		scope    *html.Node
+		matchAll string
+		queryAll string
+	}{
+		{`> li`, u1, "1 3", "1 3"},
+		{`> li`, u2, "2", "2"},
+		{`li`, u2, "1 2 3", "2"},
+		{`:scope li`, u2, "2", "2"},
+		{`~ p`, u1, "p1 p2", ""},
+		{`+ p, > .x`, u1, "3 p1", "3"},
+		{`> li > ul > li`, u1, "2", "2"},
+		{`div :scope > li`, u1, "1 3", "1 3"},
+		{`:scope`, u1, "u1", ""},
+		{`:not(:scope) > li`, u1, "2", "2"},
+	} {
+		s, err := CompileScoped(test.sel)
+		if err != nil {
+			t.Errorf("%s: %s", test.sel, err)
+			continue
+		}
+		if got := ids(s.MatchAll(test.scope, doc)); got != test.matchAll {
+			t.Errorf("%s in %s: MatchAll got %q, want %q", test.sel, attributeValue(test.scope, "id"), got, test.matchAll)
+		}
+		if got := ids(s.QueryAll(test.scope)); got != test.queryAll {
+			t.Errorf("%s in %s: QueryAll got %q, want %q", test.sel, attributeValue(test.scope, "id"), got, test.queryAll)
+		}
+	}
+
+	s, err := CompileScoped(" > li ,~p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.String(), "> li, ~ p"; got != want {
+		t.Errorf("String: got %q, want %q", got, want)
+	}
+	li := MustCompile("#1").MatchFirst(doc)
+	if !s.Match(u1, li) || s.Match(u2, li) {
+		t.Error("Match: #1 should match > li only with #u1 as the scope")
+	}
+
+	for _, sel := range []string{"", "> ", "li >", "> li,", "> > li"} {
+		if _, err := CompileScoped(sel); err == nil {
+			t.Errorf("%q: expected an error", sel)
+		}
+	}
+}
@@ -3,8 +3,11 @@ package cascadia
 import (
 	"bytes"
 	"fmt"
+	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"golang.org/x/net/html"
 )
@@ -14,8 +17,61 @@ import (
 // A Selector is a function which tells whether a node matches or not.
 type Selector func(*html.Node) bool
 
+// A Sel is a parsed selector, as returned by Parse, or a part of one. Unlike
+// a Selector, it keeps the structure of the selector, so it can be written
+// back out: String returns the selector in a canonical form, which parses
+// to an equivalent Sel. Inspect, Walk and Rewrite give access to its
+// structure.
+type Sel interface {
+	// Match returns whether n matches the selector.
+	Match(n *html.Node) bool
+
+	// String returns the selector as CSS text.
+	String() string
+
+	// Specificity returns the specificity of the selector. For a selector
+	// list, it is that of the most specific member.
+	Specificity() Specificity
+}
+
+// Parse parses a selector (or a comma-separated selector list) and returns
+// its parsed form. Compile is equivalent to calling Parse and then using
+// the Match method of the result.
+func Parse(sel string) (Sel, error) {
+	p := &parser{s: sel}
+	return p.parse()
+}
+
+// ParseGroup parses a comma-separated selector list and returns the parsed
+// members of the list in order. They are the same as the Children of the
+// list returned by Parse, as reported by Inspect.
+func ParseGroup(sel string) ([]Sel, error) {
+	return parseGroupMembers(sel)
+}
+
+// Never is a Selector that matches nothing. Compile returns it for
+// selectors that can't match any node, such as [a^=""].
+var Never Selector = never
+
+// All is a Selector that matches every node, like "*".
+var All Selector = all
+
+func never(*html.Node) bool { return false }
+
+func all(*html.Node) bool { return true }
+
+// NeverMatches returns whether s is Never, and so can't match anything.
+// It only detects Never itself, such as a selector that Compile found
+// can't match; other selectors that happen to match nothing aren't
+// detected.
+func (s Selector) NeverMatches() bool {
+	return s != nil && reflect.ValueOf(s).Pointer() == neverPointer
+}
+
+var neverPointer = reflect.ValueOf(never).Pointer()
+
 // hasChildMatch returns whether n has any child that matches a.
-func hasChildMatch(n *html.Node, a Selector) bool {
+func hasChildMatch(n *html.Node, a func(*html.Node) bool) bool {
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
 		if a(c) {
 			return true
@@ -27,9 +83,9 @@ func hasChildMatch(n *html.Node, a Selector) bool {
 // hasDescendantMatch performs a depth-first search of n's descendants,
 // testing whether any of them match a. It returns true as soon as a match is
 // found, or false if no match is found.
-func hasDescendantMatch(n *html.Node, a Selector) bool {
-	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		if a(c) || (c.Type == html.ElementNode && hasDescendantMatch(c, a)) {
+func hasDescendantMatch(n *html.Node, a func(*html.Node) bool) bool {
+	for c := n.FirstChild; c != nil; c = nextInSubtree(c, n) {
+		if a(c) {
 			return true
 		}
 	}
@@ -38,25 +94,237 @@ func hasDescendantMatch(n *html.Node, a Selector) bool {
 
 // Compile parses a selector and returns, if successful, a Selector object
 // that can be used to match against html.Node objects.
+//
+// In addition to standard CSS, Compile accepts some non-standard extensions.
+// One of them is [attr#=pattern], which matches elements where the value of
+// attr matches the regular expression pattern. The pattern may be quoted,
+// like a string, or written bare, in which case it extends up to the first
+// unmatched ')' or ']', so it is usually enclosed in parentheses:
+// a[href#=(^https?://example\.com/)]. The pattern is compiled along with
+// the selector, and an invalid pattern makes Compile return an error.
+//
+// A Selector doesn't remember the text it was compiled from. To log or
+// display a selector in a normalized form, use Parse instead, and call the
+// String method of its result; its Match method matches like the Selector
+// that Compile would return.
 func Compile(sel string) (Selector, error) {
 	p := &parser{s: sel}
+	return p.compile()
+}
+
+// Options control how CompileWithOptions parses a selector.
+// The zero value gives the same behavior as Compile.
+type Options struct {
+	// MaxIdentifierLength, if positive, is the maximum length in bytes of
+	// each name or string in the selector: tag names, ids, class names,
+	// attribute names and values, and the arguments of pseudo-classes. It
+	// protects programs that compile untrusted selectors from
+	// pathologically long ones.
+	MaxIdentifierLength int
+
+	// Namespaces maps namespace prefixes, as used in selectors like
+	// svg|circle and [xlink|href], to namespaces, as they appear in the
+	// Namespace fields of html.Node and html.Attribute. The prefixes svg,
+	// math, xlink, xml and xmlns are available by default, mapped to
+	// themselves.
+	Namespaces map[string]string
+
+	// QuirksCombinators accepts a combinator written more than once in a
+	// row, as in "div >> p" or "a + + b", which some buggy generators
+	// produce, and treats it as a single combinator. Each such combinator
+	// is reported as a warning. Different combinators in a row, as in
+	// "a > + b", are still rejected.
+	QuirksCombinators bool
+
+	// EmptyIgnoresWhitespace makes :empty also match elements whose only
+	// text is whitespace, as the Selectors Level 4 draft proposes. By
+	// default, any text, even whitespace, makes an element non-empty.
+	EmptyIgnoresWhitespace bool
+
+	// CaseSensitiveContains makes :contains() and :containsOwn() compare
+	// text case-sensitively, as jQuery does. By default they ignore case.
+	CaseSensitiveContains bool
+
+	// ContainsCollapsesWhitespace makes :contains() and :containsOwn()
+	// collapse each run of whitespace, in both the text and the argument,
+	// to a single space, so that "Total due" matches however the words are
+	// wrapped or indented. By default whitespace is compared as it is.
+	ContainsCollapsesWhitespace bool
+
+	// Context, if not nil, gives the document context for :visited,
+	// :target and :target-within, and the visited links for :link.
+	Context *DocumentContext
+
+	// Strict rejects the extensions to CSS, such as :contains() and
+	// [attr#=pattern], so that only standard selectors are accepted, as
+	// when validating a stylesheet.
+	Strict bool
+
+	// QuirksMode compares ids and class names ASCII case-insensitively,
+	// as browsers do for documents in quirks mode.
+	QuirksMode bool
+
+	// PseudoElements accepts a pseudo-element, such as ::before, at the
+	// end of each member of the selector list, as in a stylesheet. The
+	// selector matches the pseudo-element's originating element; use
+	// ParseWithPseudoElement to find out which pseudo-element it was.
+	PseudoElements bool
+
+	// DynamicPseudoclasses accepts the pseudo-classes that depend on user
+	// interaction, such as :hover and :focus, so that selectors written
+	// for a stylesheet can be compiled. They never match, since a parsed
+	// document has no interaction state, and each one is reported as a
+	// warning. By default they are rejected as unknown pseudo-classes.
+	DynamicPseudoclasses bool
+
+	// Warn, if not nil, is called with each warning found while parsing:
+	// constructs that are accepted but are suspect, like a doubled
+	// combinator or [attr^=""], which never matches.
+	Warn func(Diagnostic)
+}
+
+// CompileWithOptions is like Compile, but with options to control parsing.
+func CompileWithOptions(sel string, opts Options) (Selector, error) {
+	p := &parser{s: sel, opts: opts}
+	return p.compile()
+}
+
+// compile parses the parser's whole source text as a selector group.
+func (p *parser) compile() (Selector, error) {
+	compiled, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return compileSel(compiled), nil
+}
+
+// parse is like compile, but it returns the parsed selector.
+func (p *parser) parse() (Sel, error) {
+	if p.opts.PseudoElements {
+		p.allowPseudoElement = true
+	}
 	compiled, err := p.parseSelectorGroup()
 	if err != nil {
 		return nil, err
 	}
 
-	if p.i < len(sel) {
-		return nil, fmt.Errorf("parsing %q: %d bytes left over", sel, len(sel)-p.i)
+	if p.i < len(p.s) {
+		return nil, p.expectedf(p.i, "end of selector", "%d bytes left over", len(p.s)-p.i)
 	}
 
 	return compiled, nil
 }
 
+// A SelectorGroup is a list of selectors, as produced by a comma-separated
+// selector such as "h1, h2, h3". It matches a node if any of its members
+// match.
+type SelectorGroup []Selector
+
+// CompileGroup parses a comma-separated list of selectors and returns, if
+// successful, the compiled members of the list in order.
+func CompileGroup(sel string) (SelectorGroup, error) {
+	members, err := parseGroupMembers(sel)
+	if err != nil {
+		return nil, err
+	}
+
+	group := make(SelectorGroup, len(members))
+	for i, m := range members {
+		group[i] = compileSel(m)
+	}
+	return group, nil
+}
+
+// parseGroupMembers parses a comma-separated list of selectors and returns
+// its members separately.
+func parseGroupMembers(sel string) ([]Sel, error) {
+	p := &parser{s: sel}
+	members, err := p.parseSelectorList()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.i < len(sel) {
+		return nil, p.expectedf(p.i, "end of selector", "%d bytes left over", len(sel)-p.i)
+	}
+	return members, nil
+}
+
+// NeverMatches returns whether none of the members of g can match anything,
+// as when g is empty or all its members are Never.
+func (g SelectorGroup) NeverMatches() bool {
+	for _, s := range g {
+		if !s.NeverMatches() {
+			return false
+		}
+	}
+	return true
+}
+
+// Match returns true if any member of g matches n.
+func (g SelectorGroup) Match(n *html.Node) bool {
+	for _, s := range g {
+		if s(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchAll returns a slice of the nodes that match any member of g, from n
+// and its children. Each node is included only once, in document order.
+func (g SelectorGroup) MatchAll(n *html.Node) []*html.Node {
+	return Selector(g.Match).MatchAll(n)
+}
+
+// A Routed is a node claimed by a member of a SelectorGroup.
+type Routed struct {
+	Node  *html.Node
+	Index int // the index of the first member of the group that matched Node
+}
+
+// Route walks root and its descendants in document order, and assigns each
+// node to the first member of g that matches it, treating earlier members as
+// higher-priority rules. The descendants of a claimed node are not examined.
+func (g SelectorGroup) Route(root *html.Node) []Routed {
+	return g.route(root, false, nil)
+}
+
+// RouteNested is like Route, but it continues into the descendants of
+// claimed nodes, so that nested nodes can be claimed too.
+func (g SelectorGroup) RouteNested(root *html.Node) []Routed {
+	return g.route(root, true, nil)
+}
+
+func (g SelectorGroup) route(root *html.Node, nested bool, storage []Routed) []Routed {
+	n := root
+	for n != nil {
+		claimed := false
+		for i, s := range g {
+			if s(n) {
+				storage = append(storage, Routed{n, i})
+				claimed = true
+				break
+			}
+		}
+
+		if claimed && !nested {
+			n = nextAfterSubtree(n, root)
+		} else {
+			n = nextInSubtree(n, root)
+		}
+	}
+	return storage
+}
+
 // MustCompile is like Compile, but panics instead of returning an error.
+// It simplifies safe initialization of global variables holding compiled
+// selectors.
 func MustCompile(sel string) Selector {
 	compiled, err := Compile(sel)
 	if err != nil {
-		panic(err)
+		panic(`cascadia: Compile(` + strconv.Quote(sel) + `): ` + err.Error())
 	}
 	return compiled
 }
@@ -64,44 +332,269 @@ func MustCompile(sel string) Selector {
 // MatchAll returns a slice of the nodes that match the selector,
 // from n and its children.
 func (s Selector) MatchAll(n *html.Node) []*html.Node {
+	if s.NeverMatches() {
+		return nil
+	}
 	return s.matchAllInto(n, nil)
 }
 
-func (s Selector) matchAllInto(n *html.Node, storage []*html.Node) []*html.Node {
-	if s(n) {
-		storage = append(storage, n)
+// MatchAllInto is like MatchAll, but it appends the matches to dst and
+// returns the extended slice. Passing the result of an earlier call, sliced
+// to zero length, reuses its storage instead of allocating a new slice.
+func (s Selector) MatchAllInto(n *html.Node, dst []*html.Node) []*html.Node {
+	if s.NeverMatches() {
+		return dst
+	}
+	return s.matchAllInto(n, dst)
+}
+
+// MatchN is like MatchAll, but it returns at most max nodes: the first max
+// matches in document order. The traversal stops as soon as it has found
+// them, so the rest of the tree isn't visited. If max is zero or negative,
+// MatchN returns nil.
+func (s Selector) MatchN(n *html.Node, max int) []*html.Node {
+	if max <= 0 || s.NeverMatches() {
+		return nil
 	}
+	var result []*html.Node
+	for c := n; c != nil; c = nextInSubtree(c, n) {
+		if s(c) {
+			result = append(result, c)
+			if len(result) == max {
+				break
+			}
+		}
+	}
+	return result
+}
+
+// MatchAllDescendants is like MatchAll, but it doesn't test n itself, only
+// its descendants, like jQuery's find method.
+func (s Selector) MatchAllDescendants(n *html.Node) []*html.Node {
+	if s.NeverMatches() {
+		return nil
+	}
+	var result []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		result = s.matchAllInto(c, result)
+	}
+	return result
+}
+
+// DeepestMatches returns the nodes that match the selector, from root and its
+// descendants, that have no matching descendants: the innermost match on
+// each branch of the tree. They are in document order.
+func (s Selector) DeepestMatches(root *html.Node) []*html.Node {
+	matches := s.MatchAll(root)
+
+	// In document order, a node's descendants come right after it, so a
+	// match has a matching descendant if and only if the next match is
+	// one. The deepest matches are filtered in place.
+	result := matches[:0]
+	for i, m := range matches {
+		if i+1 < len(matches) && isAncestor(m, matches[i+1]) {
+			continue
+		}
+		result = append(result, m)
+	}
+	return result
+}
 
-	for child := n.FirstChild; child != nil; child = child.NextSibling {
-		storage = s.matchAllInto(child, storage)
+// isAncestor returns whether a is a proper ancestor of n.
+func isAncestor(a, n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p == a {
+			return true
+		}
 	}
+	return false
+}
 
+// matchAllInto appends the nodes that match s, from root and its
+// descendants, to storage. It walks the tree through the nodes' links
+// instead of recursing, so deeply nested trees don't need a deep stack.
+func (s Selector) matchAllInto(root *html.Node, storage []*html.Node) []*html.Node {
+	for n := root; n != nil; n = nextInSubtree(n, root) {
+		if s(n) {
+			storage = append(storage, n)
+		}
+	}
 	return storage
 }
 
+// EachMatch calls fn for each node that matches the selector, from n and its
+// descendants, in the same order as MatchAll. If fn returns false, EachMatch
+// stops without looking at the rest of the tree. Unlike MatchAll, it doesn't
+// allocate a slice for the results.
+//
+// fn may call EachMatch or other Selector methods, on any part of the tree,
+// but it must not modify the tree; to remove matches while iterating, use
+// LiveIter.
+func (s Selector) EachMatch(n *html.Node, fn func(*html.Node) bool) {
+	if s.NeverMatches() {
+		return
+	}
+	for c := n; c != nil; c = nextInSubtree(c, n) {
+		if s(c) && !fn(c) {
+			return
+		}
+	}
+}
+
+// nextInSubtree returns the node after n in document order, or nil if n is
+// the last node in the subtree rooted at root.
+func nextInSubtree(n, root *html.Node) *html.Node {
+	if n.FirstChild != nil {
+		return n.FirstChild
+	}
+	return nextAfterSubtree(n, root)
+}
+
+// nextAfterSubtree is like nextInSubtree, but it skips n's descendants.
+func nextAfterSubtree(n, root *html.Node) *html.Node {
+	for ; n != root; n = n.Parent {
+		if n.NextSibling != nil {
+			return n.NextSibling
+		}
+	}
+	return nil
+}
+
+// MatchAllMaxDepth is like MatchAll, but it only looks at the nodes at most
+// maxDepth levels below n: n's children are one level below it, its
+// grandchildren two, and so on. Deeper nodes are neither matched nor
+// visited, which bounds the work done on pathologically deep documents.
+// Pseudo-classes like :has() and :contains() still look at all of the
+// descendants of the nodes they test.
+func (s Selector) MatchAllMaxDepth(n *html.Node, maxDepth int) []*html.Node {
+	if s.NeverMatches() {
+		return nil
+	}
+	var result []*html.Node
+	for c, depth := n, 0; c != nil; {
+		if s(c) {
+			result = append(result, c)
+		}
+		if c.FirstChild != nil && depth < maxDepth {
+			c = c.FirstChild
+			depth++
+			continue
+		}
+		for c != n && c.NextSibling == nil {
+			c = c.Parent
+			depth--
+		}
+		if c == n {
+			break
+		}
+		c = c.NextSibling
+	}
+	return result
+}
+
+// MatchAllBreadthFirst is like MatchAll, but it returns the matches in
+// breadth-first order: n first, then the matches among its children, then
+// among its grandchildren, and so on, each level in document order. MatchAll
+// uses document order (a depth-first, pre-order walk), in which a deeply
+// nested match can come before a shallower one that follows it in the
+// source; breadth-first order is useful when shallower matches should be
+// preferred.
+func (s Selector) MatchAllBreadthFirst(n *html.Node) []*html.Node {
+	var result []*html.Node
+	queue := []*html.Node{n}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if s(n) {
+			result = append(result, n)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			queue = append(queue, child)
+		}
+	}
+	return result
+}
+
+// A TaggedMatch is a node matched by a selector, along with a tag supplied
+// by the caller to identify where the selector came from, such as the
+// stylesheet rule or media query it belongs to.
+type TaggedMatch struct {
+	Node *html.Node
+	Tag  string
+}
+
+// MatchAllTagged is like MatchAll, but it labels each match with tag. This
+// is convenient when matching the selectors of many stylesheet rules and
+// combining the results. Any media query the rule is under is not evaluated
+// (selectors match against the document, not against a rendering of it),
+// so a caller that wants to keep track of it can use it in the tag.
+func (s Selector) MatchAllTagged(n *html.Node, tag string) []TaggedMatch {
+	var result []TaggedMatch
+	for _, m := range s.MatchAll(n) {
+		result = append(result, TaggedMatch{Node: m, Tag: tag})
+	}
+	return result
+}
+
+// MatchAllChan walks n and its children in a separate goroutine, sending
+// the nodes that match the selector on the returned channel in the same order
+// as MatchAll. The channel is closed when the walk is finished.
+//
+// The walk runs while the matches are being received, so the tree must not
+// be modified until the channel is closed. To modify the tree while iterating
+// over the matches, use Iter or LiveIter instead.
+//
+// The caller must receive from the channel until it is closed; otherwise the
+// goroutine doing the walk will block forever.
+func (s Selector) MatchAllChan(n *html.Node) <-chan *html.Node {
+	c := make(chan *html.Node)
+	go func() {
+		for m := n; m != nil; m = nextInSubtree(m, n) {
+			if s(m) {
+				c <- m
+			}
+		}
+		close(c)
+	}()
+	return c
+}
+
 // Match returns true if the node matches the selector.
 func (s Selector) Match(n *html.Node) bool {
 	return s(n)
 }
 
 // MatchFirst returns the first node that matches s, from n and its children.
+// Nodes are visited in the same order as MatchAll, but the traversal stops
+// at the first match. It returns nil if no node matches.
 func (s Selector) MatchFirst(n *html.Node) *html.Node {
-	if s.Match(n) {
-		return n
+	if s.NeverMatches() {
+		return nil
 	}
+	return s.matchFirst(n)
+}
 
-	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		m := s.MatchFirst(c)
-		if m != nil {
-			return m
+func (s Selector) matchFirst(root *html.Node) *html.Node {
+	for n := root; n != nil; n = nextInSubtree(n, root) {
+		if s(n) {
+			return n
 		}
 	}
 	return nil
 }
 
-// Filter returns the nodes in nodes that match the selector.
-func (s Selector) Filter(nodes []*html.Node) (result []*html.Node) {
+// Filter returns the nodes in nodes that match the selector, in their
+// original order. Only the nodes themselves are tested, not their
+// descendants. Nodes that aren't elements are dropped, and so are repeated
+// occurrences of the same node.
+func (s Selector) Filter(nodes []*html.Node) []*html.Node {
+	result := []*html.Node{}
+	seen := make(map[*html.Node]bool)
 	for _, n := range nodes {
+		if n.Type != html.ElementNode || seen[n] {
+			continue
+		}
+		seen[n] = true
 		if s(n) {
 			result = append(result, n)
 		}
@@ -109,14 +602,33 @@ func (s Selector) Filter(nodes []*html.Node) (result []*html.Node) {
 	return result
 }
 
-// typeSelector returns a Selector that matches elements with a given tag name.
-func typeSelector(tag string) Selector {
-	tag = toLowerASCII(tag)
+// OwningElement returns the nearest element, starting with n itself and
+// then going up through its ancestors, that matches the selector, or nil if
+// there is none. Nodes that aren't elements are skipped, so when n is a text
+// or comment node, the search starts with its parent.
+func (s Selector) OwningElement(n *html.Node) *html.Node {
+	for ; n != nil; n = n.Parent {
+		if n.Type == html.ElementNode && s(n) {
+			return n
+		}
+	}
+	return nil
+}
+
+// ScopedTo returns a Selector that matches the nodes that match s and are
+// descendants of ancestor. ancestor itself doesn't match.
+func (s Selector) ScopedTo(ancestor *html.Node) Selector {
 	return func(n *html.Node) bool {
-		return n.Type == html.ElementNode && n.Data == tag
+		return s(n) && isAncestor(ancestor, n)
 	}
 }
 
+// MatchClosest is the same as OwningElement. It is named after the DOM's
+// Element.closest method, which it mirrors.
+func (s Selector) MatchClosest(n *html.Node) *html.Node {
+	return s.OwningElement(n)
+}
+
 // toLowerASCII returns s with all ASCII capital letters lowercased.
 func toLowerASCII(s string) string {
 	var b []byte
@@ -137,372 +649,1215 @@ func toLowerASCII(s string) string {
 	return string(b)
 }
 
+// matchAttribute returns whether n is an element with an attribute named key
+// whose value satisfies f.
+func matchAttribute(n *html.Node, key string, f func(string) bool) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	for _, a := range n.Attr {
+		if a.Key == key && f(a.Val) {
+			return true
+		}
+	}
+	return false
+}
+
 // attributeSelector returns a Selector that matches elements
 // where the attribute named key satisifes the function f.
 func attributeSelector(key string, f func(string) bool) Selector {
 	key = toLowerASCII(key)
+	return func(n *html.Node) bool {
+		return matchAttribute(n, key, f)
+	}
+}
+
+// anyToken returns whether f returns true for any of the
+// whitespace-separated tokens in s.
+func anyToken(s string, f func(string) bool) bool {
+	for s != "" {
+		i := strings.IndexAny(s, " \t\r\n\f")
+		if i == -1 {
+			return f(s)
+		}
+		if i > 0 && f(s[:i]) {
+			return true
+		}
+		s = s[i+1:]
+	}
+	return false
+}
+
+// AttributeRegexpSelector returns a Selector that matches elements where
+// the attribute named key matches the regular expression rx. It is the
+// equivalent of the non-standard [key#=pattern] selector.
+func AttributeRegexpSelector(key string, rx *regexp.Regexp) Selector {
+	return attributeSelector(key, rx.MatchString)
+}
+
+// AttributeOrderSelector returns a Selector that matches elements that have
+// all of the attributes named by keys, in the same relative order as keys.
+// Other attributes may come before, between or after them. With no keys, it
+// matches any element.
+//
+// The order is that of n.Attr. The html package's parser keeps attributes
+// in the order they appear in the source, so for a parsed document this is
+// the order in the markup; for nodes built or modified in code, it is
+// whatever order the program used.
+func AttributeOrderSelector(keys ...string) Selector {
+	lower := make([]string, len(keys))
+	for i, k := range keys {
+		lower[i] = toLowerASCII(k)
+	}
 	return func(n *html.Node) bool {
 		if n.Type != html.ElementNode {
 			return false
 		}
+		i := 0
 		for _, a := range n.Attr {
-			if a.Key == key && f(a.Val) {
-				return true
+			if i < len(lower) && a.Key == lower[i] {
+				i++
 			}
 		}
-		return false
+		return i == len(lower)
 	}
 }
 
-// attributeExistsSelector returns a Selector that matches elements that have
-// an attribute named key.
-func attributeExistsSelector(key string) Selector {
-	return attributeSelector(key, func(string) bool { return true })
+// MissingAttrSelector returns a Selector that matches elements with the tag
+// name tag that lack the attribute attr, or have it with a value that is
+// empty or only whitespace, such as an a element without a usable href. If
+// tag is empty, elements with any tag name match.
+//
+// It is like tag:not([attr]:not([attr=""])), except that a value of only
+// whitespace also counts as empty. Note that for some attributes an empty
+// value is meaningful: alt="" marks an image as decorative.
+func MissingAttrSelector(tag, attr string) Selector {
+	tag, attr = toLowerASCII(tag), toLowerASCII(attr)
+	return func(n *html.Node) bool {
+		if n.Type != html.ElementNode || tag != "" && n.Data != tag {
+			return false
+		}
+		return !matchAttribute(n, attr, func(val string) bool {
+			return strings.Trim(val, " \t\r\n\f") != ""
+		})
+	}
 }
 
-// attributeEqualsSelector returns a Selector that matches elements where
-// the attribute named key has the value val.
-func attributeEqualsSelector(key, val string) Selector {
-	return attributeSelector(key,
-		func(s string) bool {
-			return s == val
-		})
+// TextPredicateSelector returns a Selector that matches elements whose text,
+// the text of all their descendants as with :contains(), satisfies f. The
+// text is passed to f with leading and trailing whitespace removed; other
+// whitespace is left as it is.
+func TextPredicateSelector(f func(string) bool) Selector {
+	return func(n *html.Node) bool {
+		return n.Type == html.ElementNode && f(strings.TrimSpace(nodeText(n)))
+	}
 }
 
-// attributeIncludesSelector returns a Selector that matches elements where
-// the attribute named key is a whitespace-separated list that includes val.
-func attributeIncludesSelector(key, val string) Selector {
-	return attributeSelector(key,
-		func(s string) bool {
-			for s != "" {
-				i := strings.IndexAny(s, " \t\r\n\f")
-				if i == -1 {
-					return s == val
-				}
-				if s[:i] == val {
-					return true
-				}
-				s = s[i+1:]
+// AllDigitsText returns a Selector that matches elements whose text
+// consists of decimal digits, such as table cells holding counts.
+// Whitespace is ignored, but there must be at least one digit.
+func AllDigitsText() Selector {
+	return TextPredicateSelector(func(text string) bool {
+		digits := 0
+		for _, r := range text {
+			switch {
+			case unicode.IsDigit(r):
+				digits++
+			case !unicode.IsSpace(r):
+				return false
 			}
-			return false
-		})
+		}
+		return digits > 0
+	})
 }
 
-// attributeDashmatchSelector returns a Selector that matches elements where
-// the attribute named key equals val or starts with val plus a hyphen.
-func attributeDashmatchSelector(key, val string) Selector {
-	return attributeSelector(key,
-		func(s string) bool {
-			if s == val {
-				return true
-			}
-			if len(s) <= len(val) {
+// AllUpperText returns a Selector that matches elements whose text has no
+// lowercase letters and at least one uppercase one, such as headings written
+// in all caps. Whitespace, digits and punctuation are ignored.
+func AllUpperText() Selector {
+	return TextPredicateSelector(func(text string) bool {
+		upper := 0
+		for _, r := range text {
+			switch {
+			case unicode.IsLower(r):
 				return false
+			case unicode.IsUpper(r):
+				upper++
 			}
-			if s[:len(val)] == val && s[len(val)] == '-' {
-				return true
-			}
+		}
+		return upper > 0
+	})
+}
+
+// TextDiffersFromPrevSibling returns a Selector that matches elements whose
+// text differs from the text of their previous element sibling, such as the
+// cells in a column where the value changes. The texts are compared as with
+// TextPredicateSelector, with leading and trailing whitespace removed. An
+// element without a previous element sibling doesn't match.
+func TextDiffersFromPrevSibling() Selector {
+	return func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
 			return false
-		})
+		}
+		prev := n.PrevSibling
+		for prev != nil && prev.Type != html.ElementNode {
+			prev = prev.PrevSibling
+		}
+		if prev == nil {
+			return false
+		}
+		return strings.TrimSpace(nodeText(n)) != strings.TrimSpace(nodeText(prev))
+	}
 }
 
-// attributePrefixSelector returns a Selector that matches elements where
-// the attribute named key starts with val.
-func attributePrefixSelector(key, val string) Selector {
+// AttributeURLSchemeSelector returns a Selector that matches elements where
+// the attribute named key is a URL with the given scheme, such as
+// "javascript" or "data". As in a browser, leading and trailing whitespace
+// and any tabs or newlines in the value are ignored, and the scheme is
+// compared case-insensitively.
+func AttributeURLSchemeSelector(key, scheme string) Selector {
+	scheme = toLowerASCII(strings.TrimSuffix(scheme, ":"))
 	return attributeSelector(key,
 		func(s string) bool {
-			return strings.HasPrefix(s, val)
+			return toLowerASCII(urlScheme(s)) == scheme
 		})
 }
 
-// attributeSuffixSelector returns a Selector that matches elements where
-// the attribute named key ends with val.
-func attributeSuffixSelector(key, val string) Selector {
-	return attributeSelector(key,
-		func(s string) bool {
-			return strings.HasSuffix(s, val)
-		})
+// urlScheme returns the scheme of the URL s, or the empty string if it
+// doesn't have one.
+func urlScheme(s string) string {
+	s = strings.Trim(s, " \t\r\n\f")
+	s = strings.NewReplacer("\t", "", "\r", "", "\n", "").Replace(s)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' || c == '+' || c == '-' || c == '.':
+			if i == 0 {
+				return ""
+			}
+		case c == ':':
+			return s[:i]
+		default:
+			return ""
+		}
+	}
+	return ""
 }
 
-// attributeSubstringSelector returns a Selector that matches nodes where
-// the attribute named key contains val.
-func attributeSubstringSelector(key, val string) Selector {
-	return attributeSelector(key,
-		func(s string) bool {
-			return strings.Contains(s, val)
-		})
+// tagSelector matches elements with a given tag name.
+type tagSelector struct {
+	tag string // lowercase
 }
 
-// attributeRegexSelector returns a Selector that matches nodes where
-// the attribute named key matches the regular expression rx
-func attributeRegexSelector(key string, rx *regexp.Regexp) Selector {
-	return attributeSelector(key,
-		func(s string) bool {
-			return rx.MatchString(s)
-		})
+func (s tagSelector) Match(n *html.Node) bool {
+	return n.Type == html.ElementNode && n.Data == s.tag
 }
 
-// intersectionSelector returns a selector that matches nodes that match
-// both a and b.
-func intersectionSelector(a, b Selector) Selector {
-	return func(n *html.Node) bool {
-		return a(n) && b(n)
-	}
+// A namespace is a namespace used in a selector.
+type namespace struct {
+	prefix string // as written in the selector; "" for no namespace
+	name   string // as in html.Node.Namespace
 }
 
-// unionSelector returns a selector that matches elements that match
-// either a or b.
-func unionSelector(a, b Selector) Selector {
-	return func(n *html.Node) bool {
-		return a(n) || b(n)
-	}
+// namespaceTagSelector matches elements in a namespace by tag name
+// (ns|tag, |tag), or any element in the namespace if tag is "" (ns|*).
+// The tag name is compared ASCII case-insensitively, since the html package
+// keeps the case of some SVG tag names, like foreignObject.
+type namespaceTagSelector struct {
+	namespace *namespace
+	tag       string // lowercase
 }
 
-// negatedSelector returns a selector that matches elements that do not match a.
-func negatedSelector(a Selector) Selector {
-	return func(n *html.Node) bool {
-		if n.Type != html.ElementNode {
-			return false
-		}
-		return !a(n)
-	}
+func (s namespaceTagSelector) Match(n *html.Node) bool {
+	return n.Type == html.ElementNode && n.Namespace == s.namespace.name &&
+		(s.tag == "" || toLowerASCII(n.Data) == s.tag)
 }
 
-// writeNodeText writes the text contained in n and its descendants to b.
-func writeNodeText(n *html.Node, b *bytes.Buffer) {
-	switch n.Type {
-	case html.TextNode:
-		b.WriteString(n.Data)
-	case html.ElementNode:
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			writeNodeText(c, b)
-		}
-	}
+// dynamicSelector is a pseudo-class that depends on user interaction, such
+// as :hover. It never matches, since a parsed document has no interaction
+// state.
+type dynamicSelector struct {
+	name string
 }
 
-// nodeText returns the text contained in n and its descendants.
-func nodeText(n *html.Node) string {
-	var b bytes.Buffer
-	writeNodeText(n, &b)
-	return b.String()
+func (dynamicSelector) Match(n *html.Node) bool {
+	return false
 }
 
-// nodeOwnText returns the contents of the text nodes that are direct
-// children of n.
-func nodeOwnText(n *html.Node) string {
-	var b bytes.Buffer
-	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		if c.Type == html.TextNode {
-			b.WriteString(c.Data)
-		}
-	}
-	return b.String()
+// idSelector matches elements by id attribute.
+type idSelector struct {
+	id string // lowercase if ignoreCase is true
+
+	// ignoreCase is true if the id is compared ASCII case-insensitively,
+	// as in quirks mode.
+	ignoreCase bool
 }
 
-// textSubstrSelector returns a selector that matches nodes that
-// contain the given text.
-func textSubstrSelector(val string) Selector {
-	return func(n *html.Node) bool {
-		text := strings.ToLower(nodeText(n))
-		return strings.Contains(text, val)
+func (s idSelector) Match(n *html.Node) bool {
+	return matchAttribute(n, "id", func(val string) bool {
+		if s.ignoreCase {
+			val = toLowerASCII(val)
+		}
+		return val == s.id
+	})
+}
+
+// classSelector matches elements by class attribute.
+type classSelector struct {
+	class string // lowercase if ignoreCase is true
+
+	// ignoreCase is true if the class is compared ASCII
+	// case-insensitively, as in quirks mode.
+	ignoreCase bool
+}
+
+func (s classSelector) Match(n *html.Node) bool {
+	return matchAttribute(n, "class", func(val string) bool {
+		if s.ignoreCase {
+			val = toLowerASCII(val)
+		}
+		return anyToken(val, func(t string) bool {
+			return t == s.class
+		})
+	})
+}
+
+// attrSelector matches elements by attribute value.
+type attrSelector struct {
+	key string // lowercase
+
+	// namespace is the attribute's namespace, or nil to ignore the
+	// namespace, as when none is given in the selector.
+	namespace *namespace
+
+	// operation is the attribute operator ("=", "~=", etc.),
+	// or "" to test only that the attribute exists.
+	operation string
+
+	val    string         // lowercase if ignoreCase is true
+	regexp *regexp.Regexp // for operation "#="
+
+	// ignoreCase is true if the value is compared ASCII case-insensitively,
+	// as requested by the "i" flag in [attr=value i].
+	ignoreCase bool
+}
+
+func (s attrSelector) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	for _, a := range n.Attr {
+		if a.Key != s.key || s.namespace != nil && a.Namespace != s.namespace.name {
+			continue
+		}
+		// Testing for existence doesn't need to look at the value.
+		if s.operation == "" || s.matchValue(a.Val) {
+			return true
+		}
 	}
+	return false
 }
 
-// ownTextSubstrSelector returns a selector that matches nodes that
-// directly contain the given text
-func ownTextSubstrSelector(val string) Selector {
-	return func(n *html.Node) bool {
-		text := strings.ToLower(nodeOwnText(n))
-		return strings.Contains(text, val)
+// matchValue returns whether an attribute value satisfies s.
+func (s attrSelector) matchValue(val string) bool {
+	if s.ignoreCase {
+		val = toLowerASCII(val)
 	}
+
+	switch s.operation {
+	case "":
+		return true
+	case "=":
+		return val == s.val
+	case "~=":
+		// val is a whitespace-separated list that includes s.val.
+		return anyToken(val, func(t string) bool {
+			return t == s.val
+		})
+	case "|=":
+		// val equals s.val or starts with s.val plus a hyphen.
+		if val == s.val {
+			return true
+		}
+		return len(val) > len(s.val) && val[:len(s.val)] == s.val && val[len(s.val)] == '-'
+	case "^=":
+		// As in CSS, an empty value represents nothing.
+		return s.val != "" && strings.HasPrefix(val, s.val)
+	case "$=":
+		return s.val != "" && strings.HasSuffix(val, s.val)
+	case "*=":
+		return s.val != "" && strings.Contains(val, s.val)
+	case "#=":
+		return s.regexp.MatchString(val)
+	}
+
+	panic(fmt.Sprintf("unsupported attribute operation %q", s.operation))
 }
 
-// textRegexSelector returns a selector that matches nodes whose text matches
-// the specified regular expression
-func textRegexSelector(rx *regexp.Regexp) Selector {
-	return func(n *html.Node) bool {
-		return rx.MatchString(nodeText(n))
+// classAffixSelector matches elements with a class name that starts with val
+// (:class-prefix), or if suffix is true, ends with val (:class-suffix).
+type classAffixSelector struct {
+	val    string
+	suffix bool
+}
+
+func (s classAffixSelector) Match(n *html.Node) bool {
+	return matchAttribute(n, "class", func(val string) bool {
+		return anyToken(val, func(t string) bool {
+			if s.suffix {
+				return strings.HasSuffix(t, s.val)
+			}
+			return strings.HasPrefix(t, s.val)
+		})
+	})
+}
+
+// compoundSelector matches nodes that match all of its selectors.
+// If it is empty, it matches any node.
+type compoundSelector []Sel
+
+func (s compoundSelector) Match(n *html.Node) bool {
+	for _, sel := range s {
+		if !sel.Match(n) {
+			return false
+		}
 	}
+	return true
 }
 
-// ownTextRegexSelector returns a selector that matches nodes whose text
-// directly matches the specified regular expression
-func ownTextRegexSelector(rx *regexp.Regexp) Selector {
-	return func(n *html.Node) bool {
-		return rx.MatchString(nodeOwnText(n))
+// unionSelector matches nodes that match any of its selectors.
+type unionSelector []Sel
+
+func (s unionSelector) Match(n *html.Node) bool {
+	for _, sel := range s {
+		if sel.Match(n) {
+			return true
+		}
 	}
+	return false
 }
 
-// hasChildSelector returns a selector that matches elements
-// with a child that matches a.
-func hasChildSelector(a Selector) Selector {
-	return func(n *html.Node) bool {
-		if n.Type != html.ElementNode {
-			return false
+// negatedSelector matches elements that do not match sel.
+type negatedSelector struct {
+	sel Sel
+}
+
+func (s negatedSelector) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	return !s.sel.Match(n)
+}
+
+// writeNodeText writes the text contained in n and its descendants to b.
+func writeNodeText(n *html.Node, b *bytes.Buffer) {
+	if n.Type != html.TextNode && n.Type != html.ElementNode {
+		return
+	}
+	for c := n; c != nil; c = nextInSubtree(c, n) {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
 		}
-		return hasChildMatch(n, a)
 	}
 }
 
-// hasDescendantSelector returns a selector that matches elements
-// with any descendant that matches a.
-func hasDescendantSelector(a Selector) Selector {
-	return func(n *html.Node) bool {
-		if n.Type != html.ElementNode {
-			return false
+// nodeText returns the text contained in n and its descendants.
+func nodeText(n *html.Node) string {
+	var b bytes.Buffer
+	writeNodeText(n, &b)
+	return b.String()
+}
+
+// nodeOwnText returns the contents of the text nodes that are direct
+// children of n.
+func nodeOwnText(n *html.Node) string {
+	var b bytes.Buffer
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
 		}
-		return hasDescendantMatch(n, a)
 	}
+	return b.String()
 }
 
-// nthChildSelector returns a selector that implements :nth-child(an+b).
-// If last is true, implements :nth-last-child instead.
-// If ofType is true, implements :nth-of-type instead.
-func nthChildSelector(a, b int, last, ofType bool) Selector {
-	return func(n *html.Node) bool {
-		if n.Type != html.ElementNode {
-			return false
+// isSpace returns whether c is ASCII whitespace, as HTML defines it.
+func isSpace(c byte) bool {
+	return strings.IndexByte(" \t\r\n\f", c) != -1
+}
+
+// collapseSpace returns s with each run of whitespace replaced by a single
+// space, so that text compares the same however it is wrapped or indented.
+func collapseSpace(s string) string {
+	i := 0
+	for i < len(s) && (!isSpace(s[i]) || s[i] == ' ' && (i+1 == len(s) || !isSpace(s[i+1]))) {
+		i++
+	}
+	if i == len(s) {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	b.WriteString(s[:i])
+	space := false
+	for ; i < len(s); i++ {
+		if isSpace(s[i]) {
+			if !space {
+				b.WriteByte(' ')
+				space = true
+			}
+			continue
 		}
+		b.WriteByte(s[i])
+		space = false
+	}
+	return b.String()
+}
 
-		parent := n.Parent
-		if parent == nil {
-			return false
+// textSubstrSelector matches nodes that contain the given text (:contains),
+// or if own is true, that directly contain it (:containsOwn, also spelled
+// :contains-own). The comparison is case-insensitive, so val must already be
+// lowercase, unless ignoreCase is false (Options.CaseSensitiveContains).
+//
+// If collapse is true (Options.ContainsCollapsesWhitespace), runs of
+// whitespace in the text are collapsed to a single space before it is
+// compared, and val must already be collapsed.
+type textSubstrSelector struct {
+	val        string
+	own        bool
+	ignoreCase bool
+	collapse   bool
+}
+
+func (s textSubstrSelector) Match(n *html.Node) bool {
+	var text string
+	if s.own {
+		text = nodeOwnText(n)
+	} else {
+		text = nodeText(n)
+	}
+	if s.collapse {
+		text = collapseSpace(text)
+	}
+	if s.ignoreCase {
+		text = strings.ToLower(text)
+	}
+	return strings.Contains(text, s.val)
+}
+
+// textRegexSelector matches nodes whose text matches the specified regular
+// expression (:matches), or if own is true, whose own text matches it
+// (:matchesOwn).
+type textRegexSelector struct {
+	rx  *regexp.Regexp
+	own bool
+}
+
+func (s textRegexSelector) Match(n *html.Node) bool {
+	if s.own {
+		return s.rx.MatchString(nodeOwnText(n))
+	}
+	return s.rx.MatchString(nodeText(n))
+}
+
+// hasSelector implements :has(), whose argument sel is a relativeSelector
+// or a union of them, or if child is true, :haschild(), which matches
+// elements with a child that matches sel.
+type hasSelector struct {
+	sel   Sel
+	child bool
+}
+
+func (s hasSelector) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if s.child {
+		return hasChildMatch(n, s.sel.Match)
+	}
+	return s.sel.Match(n)
+}
+
+// matchesAnySelector implements :is() and :where(), which match elements
+// that match sel. They differ only in specificity.
+type matchesAnySelector struct {
+	sel   Sel
+	where bool
+}
+
+func (s matchesAnySelector) Match(n *html.Node) bool {
+	return n.Type == html.ElementNode && s.sel.Match(n)
+}
+
+// relativeSelector is a selector that starts with a combinator, like the
+// arguments of :has(): "> img" or "+ p", or "a b" with an implied
+// descendant combinator. It matches the elements that are anchors for it:
+// elements with another element related to them by the combinator, that
+// matches sel with the leftmost compound selector of sel matching the
+// related element.
+type relativeSelector struct {
+	combinator byte
+	sel        Sel
+}
+
+func (s relativeSelector) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+
+	if _, ok := s.sel.(combinedSelector); !ok {
+		// With a single compound selector, only the elements related by
+		// the combinator need to be tested.
+		switch s.combinator {
+		case ' ':
+			return hasDescendantMatch(n, s.sel.Match)
+		case '>':
+			return hasChildMatch(n, s.sel.Match)
+		}
+		for c := n.NextSibling; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if s.sel.Match(c) {
+				return true
+			}
+			if s.combinator == '+' {
+				break
+			}
+		}
+		return false
+	}
+
+	// The rightmost element is in n's subtree, or for the sibling
+	// combinators, in the subtree of one of its later siblings.
+	if s.combinator == ' ' || s.combinator == '>' {
+		for c := n.FirstChild; c != nil; c = nextInSubtree(c, n) {
+			if matchRelative(s.sel, c, n, s.combinator) {
+				return true
+			}
+		}
+		return false
+	}
+	for sib := n.NextSibling; sib != nil; sib = sib.NextSibling {
+		if sib.Type != html.ElementNode {
+			continue
+		}
+		for c := sib; c != nil; c = nextInSubtree(c, sib) {
+			if matchRelative(s.sel, c, n, s.combinator) {
+				return true
+			}
 		}
+		if s.combinator == '+' {
+			break
+		}
+	}
+	return false
+}
 
-		i := -1
-		count := 0
-		for c := parent.FirstChild; c != nil; c = c.NextSibling {
-			if (c.Type != html.ElementNode) || (ofType && c.Data != n.Data) {
+// matchRelative returns whether n matches m, with the leftmost compound
+// selector of m matching an element related to anchor by combinator.
+func matchRelative(m Sel, n, anchor *html.Node, combinator byte) bool {
+	c, ok := m.(combinedSelector)
+	if !ok {
+		return m.Match(n) && related(anchor, combinator, n)
+	}
+	if !c.second.Match(n) {
+		return false
+	}
+
+	switch c.combinator {
+	case ' ':
+		for p := n.Parent; p != nil; p = p.Parent {
+			if matchRelative(c.first, p, anchor, combinator) {
+				return true
+			}
+		}
+	case '>':
+		return n.Parent != nil && matchRelative(c.first, n.Parent, anchor, combinator)
+	case '+', '~':
+		for p := n.PrevSibling; p != nil; p = p.PrevSibling {
+			if p.Type != html.ElementNode {
 				continue
 			}
-			count++
-			if c == n {
-				i = count
-				if !last {
-					break
-				}
+			if matchRelative(c.first, p, anchor, combinator) {
+				return true
+			}
+			if c.combinator == '+' {
+				break
 			}
 		}
+	case '|':
+		return columnMatch(func(col *html.Node) bool {
+			return matchRelative(c.first, col, anchor, combinator)
+		}, n)
+	}
+	return false
+}
 
-		if i == -1 {
-			// This shouldn't happen, since n should always be one of its parent's children.
+// related returns whether n is related to anchor by combinator: a
+// descendant, a child, the next element sibling or a later sibling.
+func related(anchor *html.Node, combinator byte, n *html.Node) bool {
+	switch combinator {
+	case ' ':
+		return isAncestor(anchor, n)
+	case '>':
+		return n.Parent == anchor
+	case '+':
+		p := n.PrevSibling
+		for p != nil && p.Type != html.ElementNode {
+			p = p.PrevSibling
+		}
+		return p == anchor
+	case '~':
+		for p := n.PrevSibling; p != nil; p = p.PrevSibling {
+			if p == anchor {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nthChildSelector implements :nth-child(an+b).
+// If last is true, implements :nth-last-child instead.
+// If ofType is true, implements :nth-of-type instead.
+type nthChildSelector struct {
+	a, b         int
+	last, ofType bool
+
+	// of, if not nil, limits the elements counted to those that match it,
+	// as in :nth-child(2n of .item).
+	of Sel
+}
+
+func (s nthChildSelector) Match(n *html.Node) bool {
+	if s.of != nil {
+		if n.Type != html.ElementNode || n.Parent == nil || !s.of.Match(n) {
+			return false
+		}
+		return anbMatches(s.a, s.b, nthIndexMatching(n, s.last, s.of.Match))
+	}
+
+	if s.a == 0 && s.b == 1 {
+		// :first-child and friends only need to look for one sibling,
+		// rather than counting them.
+		return n.Type == html.ElementNode && n.Parent != nil && !hasSibling(n, s.last, s.ofType)
+	}
+
+	i := nthIndex(n, s.last, s.ofType)
+	if i == 0 {
+		return false
+	}
+	return anbMatches(s.a, s.b, i)
+}
+
+// onlyChildSelector implements :only-child.
+// If ofType is true, it implements :only-of-type instead.
+type onlyChildSelector struct {
+	ofType bool
+}
+
+func (s onlyChildSelector) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+
+	parent := n.Parent
+	if parent == nil {
+		return false
+	}
+
+	count := 0
+	for c := parent.FirstChild; c != nil; c = c.NextSibling {
+		if (c.Type != html.ElementNode) || (s.ofType && c.Data != n.Data) {
+			continue
+		}
+		count++
+		if count > 1 {
 			return false
 		}
+	}
+
+	return count == 1
+}
+
+// inputSelector matches input, select, textarea and button elements.
+type inputSelector struct{}
 
-		if last {
-			i = count - i + 1
+func (inputSelector) Match(n *html.Node) bool {
+	return n.Type == html.ElementNode && (n.Data == "input" || n.Data == "select" || n.Data == "textarea" || n.Data == "button")
+}
+
+// formStateSelector matches form controls by the state given in their
+// attributes: :checked, :disabled, :enabled, :required, :optional,
+// :read-write or :read-only.
+type formStateSelector struct {
+	state string
+}
+
+// formElements lists the elements that can be disabled.
+var formElements = map[string]bool{
+	"input":    true,
+	"button":   true,
+	"select":   true,
+	"textarea": true,
+	"option":   true,
+	"optgroup": true,
+	"fieldset": true,
+}
+
+func (s formStateSelector) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	switch s.state {
+	case "checked":
+		if n.Data != "input" && n.Data != "option" {
+			return false
 		}
+		return attrSelector{key: "checked"}.Match(n) || attrSelector{key: "selected"}.Match(n)
+	case "disabled":
+		return formElements[n.Data] && isDisabled(n)
+	case "enabled":
+		return formElements[n.Data] && !isDisabled(n)
+	case "required":
+		return isRequirable(n) && attrSelector{key: "required"}.Match(n)
+	case "optional":
+		return isRequirable(n) && !attrSelector{key: "required"}.Match(n)
+	case "read-write":
+		return isReadWrite(n)
+	case "read-only":
+		return !isReadWrite(n)
+	}
+	return false
+}
 
-		i -= b
-		if a == 0 {
-			return i == 0
+// isDisabled returns whether the form element n is disabled: whether it has
+// the disabled attribute, or is in a disabled fieldset but not in that
+// fieldset's first legend. An option is also disabled by a disabled optgroup
+// parent, but options and optgroups aren't disabled by fieldsets.
+func isDisabled(n *html.Node) bool {
+	if (attrSelector{key: "disabled"}).Match(n) {
+		return true
+	}
+	switch n.Data {
+	case "option":
+		p := n.Parent
+		return p != nil && p.Type == html.ElementNode && p.Data == "optgroup" && attrSelector{key: "disabled"}.Match(p)
+	case "optgroup":
+		return false
+	}
+
+	for c, p := n, n.Parent; p != nil && p.Type == html.ElementNode; c, p = p, p.Parent {
+		if p.Data == "fieldset" && (attrSelector{key: "disabled"}).Match(p) && c != firstLegend(p) {
+			return true
 		}
+	}
+	return false
+}
 
-		return i%a == 0 && i/a >= 0
+// firstLegend returns the first legend child of the fieldset n, or nil.
+func firstLegend(n *html.Node) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "legend" {
+			return c
+		}
 	}
+	return nil
 }
 
-// onlyChildSelector returns a selector that implements :only-child.
-// If ofType is true, it implements :only-of-type instead.
-func onlyChildSelector(ofType bool) Selector {
-	return func(n *html.Node) bool {
-		if n.Type != html.ElementNode {
+// unrequirableInputTypes lists the input types that the required attribute
+// doesn't apply to.
+var unrequirableInputTypes = map[string]bool{
+	"hidden": true,
+	"range":  true,
+	"color":  true,
+	"submit": true,
+	"image":  true,
+	"reset":  true,
+	"button": true,
+}
+
+// isRequirable returns whether the required attribute applies to the
+// element n, so that it is matched by either :required or :optional.
+func isRequirable(n *html.Node) bool {
+	switch n.Data {
+	case "input":
+		return !unrequirableInputTypes[toLowerASCII(strings.TrimSpace(attributeValue(n, "type")))]
+	case "select", "textarea":
+		return true
+	}
+	return false
+}
+
+// readOnlyInputTypes lists the input types that the readonly attribute
+// doesn't apply to, which are never read-write.
+var readOnlyInputTypes = map[string]bool{
+	"hidden":   true,
+	"range":    true,
+	"color":    true,
+	"checkbox": true,
+	"radio":    true,
+	"file":     true,
+	"submit":   true,
+	"image":    true,
+	"reset":    true,
+	"button":   true,
+}
+
+// isReadWrite returns whether the element n is editable by the user: a text
+// field that is neither readonly nor disabled, or an element in an editing
+// host, an element with contenteditable set to something other than
+// "false". The nearest ancestor with a valid contenteditable value decides
+// whether an element is in one, so contenteditable="false" turns editing off
+// for its subtree.
+func isReadWrite(n *html.Node) bool {
+	switch n.Data {
+	case "input":
+		if readOnlyInputTypes[toLowerASCII(strings.TrimSpace(attributeValue(n, "type")))] {
 			return false
 		}
+		fallthrough
+	case "textarea":
+		return !attrSelector{key: "readonly"}.Match(n) && !isDisabled(n)
+	}
 
-		parent := n.Parent
-		if parent == nil {
+	for ; n != nil && n.Type == html.ElementNode; n = n.Parent {
+		if !(attrSelector{key: "contenteditable"}).Match(n) {
+			continue
+		}
+		switch toLowerASCII(attributeValue(n, "contenteditable")) {
+		case "", "true", "plaintext-only":
+			return true
+		case "false":
 			return false
 		}
+	}
+	return false
+}
 
-		count := 0
-		for c := parent.FirstChild; c != nil; c = c.NextSibling {
-			if (c.Type != html.ElementNode) || (ofType && c.Data != n.Data) {
-				continue
+// langSelector implements :lang(). It matches elements whose content
+// language, given by the lang attribute of the element or its nearest
+// ancestor that has one, matches any of ranges.
+type langSelector struct {
+	ranges []string // lowercase
+}
+
+func (s langSelector) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	lang, ok := "", false
+	for e := n; e != nil && e.Type == html.ElementNode && !ok; e = e.Parent {
+		for _, a := range e.Attr {
+			if a.Key == "lang" && (a.Namespace == "" || a.Namespace == "xml") {
+				lang, ok = toLowerASCII(a.Val), true
+				break
+			}
+		}
+	}
+	if lang == "" {
+		// lang="" means the language is unknown.
+		return false
+	}
+	for _, r := range s.ranges {
+		if matchLanguageRange(r, lang) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchLanguageRange returns whether the language tag lang matches the
+// extended language range r, as in RFC 4647 section 3.3.2: "de-*-CH"
+// matches "de-CH" and "de-Latn-CH", and "en" matches "en-US". Both are
+// lowercase.
+func matchLanguageRange(r, lang string) bool {
+	ranges, tags := strings.Split(r, "-"), strings.Split(lang, "-")
+	if ranges[0] != "*" && ranges[0] != tags[0] {
+		return false
+	}
+	tags = tags[1:]
+	for _, sub := range ranges[1:] {
+		if sub == "*" {
+			continue
+		}
+		for {
+			if len(tags) == 0 {
+				return false
+			}
+			if tags[0] == sub {
+				tags = tags[1:]
+				break
 			}
-			count++
-			if count > 1 {
+			// A singleton, like the x in "en-x-foo", starts an extension,
+			// which the rest of the range can't skip over.
+			if len(tags[0]) == 1 {
 				return false
 			}
+			tags = tags[1:]
 		}
+	}
+	return true
+}
+
+// dirSelector implements :dir(). It matches elements whose directionality
+// is dir ("ltr" or "rtl").
+type dirSelector struct {
+	dir string // lowercase
+}
 
-		return count == 1
+func (s dirSelector) Match(n *html.Node) bool {
+	return n.Type == html.ElementNode && directionality(n) == s.dir
+}
+
+// directionality returns the directionality of the element n, "ltr" or
+// "rtl", following the HTML rules: it comes from the dir attribute of n or
+// its nearest ancestor with a valid one, and is "ltr" if there is none.
+// With dir="auto", which is the default for bdi elements, it depends on the
+// element's text.
+func directionality(n *html.Node) string {
+	for e := n; e != nil && e.Type == html.ElementNode; e = e.Parent {
+		dir, ok := "", false
+		for _, a := range e.Attr {
+			if a.Key == "dir" && a.Namespace == "" {
+				dir, ok = toLowerASCII(a.Val), true
+				break
+			}
+		}
+		switch {
+		case dir == "ltr" || dir == "rtl":
+			return dir
+		case dir == "auto" || !ok && e.Data == "bdi" && e.Namespace == "":
+			return autoDirection(e)
+		}
 	}
+	return "ltr"
 }
 
-// inputSelector is a Selector that matches input, select, textarea and button elements.
-func inputSelector(n *html.Node) bool {
-	return n.Type == html.ElementNode && (n.Data == "input" || n.Data == "select" || n.Data == "textarea" || n.Data == "button")
+// autoDirection returns the directionality of an element with dir="auto":
+// "rtl" if the first character in its text with a strong direction is a
+// right-to-left one, or else "ltr". The text of an input element is its
+// value. Descendants that have their own directionality, and ones whose
+// content isn't text, like script, are skipped.
+func autoDirection(n *html.Node) string {
+	if n.Data == "input" {
+		return textDirection(attributeValue(n, "value"))
+	}
+	for c := n.FirstChild; c != nil; {
+		switch c.Type {
+		case html.TextNode:
+			if dir := textDirection(c.Data); dir != "" {
+				return dir
+			}
+		case html.ElementNode:
+			switch c.Data {
+			case "bdi", "script", "style", "textarea":
+				c = nextAfterSubtree(c, n)
+				continue
+			}
+			if (attrSelector{key: "dir"}).Match(c) {
+				c = nextAfterSubtree(c, n)
+				continue
+			}
+		}
+		c = nextInSubtree(c, n)
+	}
+	return "ltr"
+}
+
+// textDirection returns the direction of the first strongly directional
+// character in s: "rtl" for one in a right-to-left script, "ltr" for any
+// other letter, or "" if s has no letters.
+func textDirection(s string) string {
+	for _, c := range s {
+		if unicode.In(c, rtlScripts...) {
+			return "rtl"
+		}
+		if unicode.IsLetter(c) {
+			return "ltr"
+		}
+	}
+	return ""
+}
+
+// rtlScripts lists the scripts that are written right to left.
+var rtlScripts = []*unicode.RangeTable{
+	unicode.Adlam,
+	unicode.Arabic,
+	unicode.Hanifi_Rohingya,
+	unicode.Hebrew,
+	unicode.Mandaic,
+	unicode.Mende_Kikakui,
+	unicode.Nko,
+	unicode.Samaritan,
+	unicode.Syriac,
+	unicode.Thaana,
 }
 
-// emptyElementSelector is a Selector that matches empty elements.
-func emptyElementSelector(n *html.Node) bool {
+// emptyElementSelector matches empty elements.
+// As in the CSS specification, comments don't count as content, but any text
+// does, even if it is only whitespace, unless ignoreWhitespace is set.
+type emptyElementSelector struct {
+	ignoreWhitespace bool
+}
+
+func (s emptyElementSelector) Match(n *html.Node) bool {
 	if n.Type != html.ElementNode {
 		return false
 	}
 
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
 		switch c.Type {
-		case html.ElementNode, html.TextNode:
+		case html.ElementNode:
 			return false
+		case html.TextNode:
+			if !s.ignoreWhitespace || strings.Trim(c.Data, " \t\r\n\f") != "" {
+				return false
+			}
 		}
 	}
 
 	return true
 }
 
-// descendantSelector returns a Selector that matches an element if
-// it matches d and has an ancestor that matches a.
-func descendantSelector(a, d Selector) Selector {
-	return func(n *html.Node) bool {
-		if !d(n) {
-			return false
-		}
+// A scopeRef holds the element that :scope refers to while a selector is
+// being matched.
+type scopeRef struct {
+	node *html.Node
+}
 
-		for p := n.Parent; p != nil; p = p.Parent {
-			if a(p) {
-				return true
-			}
-		}
+// scopeSelector implements :scope.
+// If scope is nil or holds no element, it matches the root element.
+type scopeSelector struct {
+	scope *scopeRef
+}
 
+func (s scopeSelector) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
 		return false
 	}
+	if s.scope != nil && s.scope.node != nil {
+		return n == s.scope.node
+	}
+	return n.Parent == nil || n.Parent.Type == html.DocumentNode
 }
 
-// childSelector returns a Selector that matches an element if
-// it matches d and its parent matches a.
-func childSelector(a, d Selector) Selector {
-	return func(n *html.Node) bool {
-		return d(n) && n.Parent != nil && a(n.Parent)
+// rootSelector matches the root element of a document:
+// an element whose parent is the document node.
+type rootSelector struct{}
+
+func (rootSelector) Match(n *html.Node) bool {
+	return n.Type == html.ElementNode && n.Parent != nil && n.Parent.Type == html.DocumentNode
+}
+
+// combinedSelector matches an element if it matches second, and first
+// matches a related element. The relationship is determined by combinator:
+// ' ' (descendant), '>' (child), '+' (adjacent sibling), or '~' (general
+// sibling).
+type combinedSelector struct {
+	first      Sel
+	combinator byte
+	second     Sel
+}
+
+func (s combinedSelector) Match(n *html.Node) bool {
+	switch s.combinator {
+	case ' ':
+		return descendantMatch(s.first.Match, s.second.Match, n)
+	case '>':
+		return childMatch(s.first.Match, s.second.Match, n)
+	case '+':
+		return siblingMatch(s.first.Match, s.second.Match, true, n)
+	case '~':
+		return siblingMatch(s.first.Match, s.second.Match, false, n)
+	case '|':
+		return s.second.Match(n) && columnMatch(s.first.Match, n)
 	}
+	panic(fmt.Sprintf("unknown combinator %q", s.combinator))
 }
 
-// siblingSelector returns a Selector that matches an element
-// if it matches s2 and in is preceded by an element that matches s1.
-// If adjacent is true, the sibling must be immediately before the element.
-func siblingSelector(s1, s2 Selector, adjacent bool) Selector {
-	return func(n *html.Node) bool {
-		if !s2(n) {
-			return false
+// descendantMatch returns whether n matches d and has an ancestor that
+// matches a.
+func descendantMatch(a, d func(*html.Node) bool, n *html.Node) bool {
+	if !d(n) {
+		return false
+	}
+
+	for p := n.Parent; p != nil; p = p.Parent {
+		if a(p) {
+			return true
 		}
+	}
+
+	return false
+}
+
+// childMatch returns whether n matches d and its parent matches a.
+func childMatch(a, d func(*html.Node) bool, n *html.Node) bool {
+	return d(n) && n.Parent != nil && a(n.Parent)
+}
 
-		if adjacent {
-			for n = n.PrevSibling; n != nil; n = n.PrevSibling {
-				if n.Type == html.TextNode || n.Type == html.CommentNode {
-					continue
-				}
-				return s1(n)
+// siblingMatch returns whether n matches s2 and is preceded by an element
+// that matches s1. Text, comment and other non-element siblings are skipped.
+// If adjacent is true, the sibling must be immediately before the element.
+func siblingMatch(s1, s2 func(*html.Node) bool, adjacent bool, n *html.Node) bool {
+	if !s2(n) {
+		return false
+	}
+
+	if adjacent {
+		for n = n.PrevSibling; n != nil; n = n.PrevSibling {
+			if n.Type != html.ElementNode {
+				continue
 			}
-			return false
+			return s1(n)
 		}
+		return false
+	}
 
-		// Walk backwards looking for element that matches s1
-		for c := n.PrevSibling; c != nil; c = c.PrevSibling {
-			if s1(c) {
-				return true
-			}
+	// Walk backwards looking for element that matches s1
+	for c := n.PrevSibling; c != nil; c = c.PrevSibling {
+		if c.Type == html.ElementNode && s1(c) {
+			return true
 		}
+	}
 
-		return false
+	return false
+}
+
+// Descendant returns a Selector that matches an element if it matches
+// descendant and has an ancestor that matches ancestor, like the CSS
+// selector "A D".
+func Descendant(ancestor, descendant Selector) Selector {
+	return func(n *html.Node) bool {
+		return descendantMatch(ancestor, descendant, n)
+	}
+}
+
+// Child returns a Selector that matches an element if it matches child and
+// its parent matches parent, like the CSS selector "P > C".
+func Child(parent, child Selector) Selector {
+	return func(n *html.Node) bool {
+		return childMatch(parent, child, n)
+	}
+}
+
+// AdjacentSibling returns a Selector that matches an element if it matches
+// second and the element immediately before it matches first, like the CSS
+// selector "F + S".
+func AdjacentSibling(first, second Selector) Selector {
+	return func(n *html.Node) bool {
+		return siblingMatch(first, second, true, n)
+	}
+}
+
+// GeneralSibling returns a Selector that matches an element if it matches
+// later and is preceded by a sibling element that matches earlier, like the
+// CSS selector "E ~ L".
+func GeneralSibling(earlier, later Selector) Selector {
+	return func(n *html.Node) bool {
+		return siblingMatch(earlier, later, false, n)
 	}
 }
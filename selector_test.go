@@ -1,17 +1,16 @@
 package cascadia
 
 import (
+	"fmt"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 
+	"github.com/andybalholm/cascadia/cascadiatest"
 	"golang.org/x/net/html"
 )
 
-type selectorTest struct {
-	HTML, selector string
-	results        []string
-}
-
 func nodeString(n *html.Node) string {
 	switch n.Type {
 	case html.TextNode:
@@ -26,502 +25,35 @@ func nodeString(n *html.Node) string {
 	return ""
 }
 
-var selectorTests = []selectorTest{
-	{
-		`<body><address>This address...</address></body>`,
-		"address",
-		[]string{
-			"<address>",
-		},
-	},
-	{
-		`<html><head></head><body></body></html>`,
-		"*",
-		[]string{
-			"",
-			"<html>",
-			"<head>",
-			"<body>",
-		},
-	},
-	{
-		`<p id="foo"><p id="bar">`,
-		"#foo",
-		[]string{
-			`<p id="foo">`,
-		},
-	},
-	{
-		`<ul><li id="t1"><p id="t1">`,
-		"li#t1",
-		[]string{
-			`<li id="t1">`,
-		},
-	},
-	{
-		`<ol><li id="t4"><li id="t44">`,
-		"*#t4",
-		[]string{
-			`<li id="t4">`,
-		},
-	},
-	{
-		`<ul><li class="t1"><li class="t2">`,
-		".t1",
-		[]string{
-			`<li class="t1">`,
-		},
-	},
-	{
-		`<p class="t1 t2">`,
-		"p.t1",
-		[]string{
-			`<p class="t1 t2">`,
-		},
-	},
-	{
-		`<div class="test">`,
-		"div.teST",
-		[]string{},
-	},
-	{
-		`<p class="t1 t2">`,
-		".t1.fail",
-		[]string{},
-	},
-	{
-		`<p class="t1 t2">`,
-		"p.t1.t2",
-		[]string{
-			`<p class="t1 t2">`,
-		},
-	},
-	{
-		`<p><p title="title">`,
-		"p[title]",
-		[]string{
-			`<p title="title">`,
-		},
-	},
-	{
-		`<address><address title="foo"><address title="bar">`,
-		`address[title="foo"]`,
-		[]string{
-			`<address title="foo">`,
-		},
-	},
-	{
-		`<p title="tot foo bar">`,
-		`[    	title        ~=       foo    ]`,
-		[]string{
-			`<p title="tot foo bar">`,
-		},
-	},
-	{
-		`<p title="hello world">`,
-		`[title~="hello world"]`,
-		[]string{},
-	},
-	{
-		`<p lang="en"><p lang="en-gb"><p lang="enough"><p lang="fr-en">`,
-		`[lang|="en"]`,
-		[]string{
-			`<p lang="en">`,
-			`<p lang="en-gb">`,
-		},
-	},
-	{
-		`<p title="foobar"><p title="barfoo">`,
-		`[title^="foo"]`,
-		[]string{
-			`<p title="foobar">`,
-		},
-	},
-	{
-		`<p title="foobar"><p title="barfoo">`,
-		`[title$="bar"]`,
-		[]string{
-			`<p title="foobar">`,
-		},
-	},
-	{
-		`<p title="foobarufoo">`,
-		`[title*="bar"]`,
-		[]string{
-			`<p title="foobarufoo">`,
-		},
-	},
-	{
-		`<p class="t1 t2">`,
-		".t1:not(.t2)",
-		[]string{},
-	},
-	{
-		`<div class="t3">`,
-		`div:not(.t1)`,
-		[]string{
-			`<div class="t3">`,
-		},
-	},
-	{
-		`<ol><li id=1><li id=2><li id=3></ol>`,
-		`li:nth-child(odd)`,
-		[]string{
-			`<li id="1">`,
-			`<li id="3">`,
-		},
-	},
-	{
-		`<ol><li id=1><li id=2><li id=3></ol>`,
-		`li:nth-child(even)`,
-		[]string{
-			`<li id="2">`,
-		},
-	},
-	{
-		`<ol><li id=1><li id=2><li id=3></ol>`,
-		`li:nth-child(-n+2)`,
-		[]string{
-			`<li id="1">`,
-			`<li id="2">`,
-		},
-	},
-	{
-		`<ol><li id=1><li id=2><li id=3></ol>`,
-		`li:nth-child(3n+1)`,
-		[]string{
-			`<li id="1">`,
-		},
-	},
-	{
-		`<ol><li id=1><li id=2><li id=3><li id=4></ol>`,
-		`li:nth-last-child(odd)`,
-		[]string{
-			`<li id="2">`,
-			`<li id="4">`,
-		},
-	},
-	{
-		`<ol><li id=1><li id=2><li id=3><li id=4></ol>`,
-		`li:nth-last-child(even)`,
-		[]string{
-			`<li id="1">`,
-			`<li id="3">`,
-		},
-	},
-	{
-		`<ol><li id=1><li id=2><li id=3><li id=4></ol>`,
-		`li:nth-last-child(-n+2)`,
-		[]string{
-			`<li id="3">`,
-			`<li id="4">`,
-		},
-	},
-	{
-		`<ol><li id=1><li id=2><li id=3><li id=4></ol>`,
-		`li:nth-last-child(3n+1)`,
-		[]string{
-			`<li id="1">`,
-			`<li id="4">`,
-		},
-	},
-	{
-		`<p>some text <span id="1">and a span</span><span id="2"> and another</span></p>`,
-		`span:first-child`,
-		[]string{
-			`<span id="1">`,
-		},
-	},
-	{
-		`<span>a span</span> and some text`,
-		`span:last-child`,
-		[]string{
-			`<span>`,
-		},
-	},
-	{
-		`<address></address><p id=1><p id=2>`,
-		`p:nth-of-type(2)`,
-		[]string{
-			`<p id="2">`,
-		},
-	},
-	{
-		`<address></address><p id=1><p id=2></p><a>`,
-		`p:nth-last-of-type(2)`,
-		[]string{
-			`<p id="1">`,
-		},
-	},
-	{
-		`<address></address><p id=1><p id=2></p><a>`,
-		`p:last-of-type`,
-		[]string{
-			`<p id="2">`,
-		},
-	},
-	{
-		`<address></address><p id=1><p id=2></p><a>`,
-		`p:first-of-type`,
-		[]string{
-			`<p id="1">`,
-		},
-	},
-	{
-		`<div><p id="1"></p><a></a></div><div><p id="2"></p></div>`,
-		`p:only-child`,
-		[]string{
-			`<p id="2">`,
-		},
-	},
-	{
-		`<div><p id="1"></p><a></a></div><div><p id="2"></p><p id="3"></p></div>`,
-		`p:only-of-type`,
-		[]string{
-			`<p id="1">`,
-		},
-	},
-	{
-		`<p id="1"><!-- --><p id="2">Hello<p id="3"><span>`,
-		`:empty`,
-		[]string{
-			`<head>`,
-			`<p id="1">`,
-			`<span>`,
-		},
-	},
-	{
-		`<div><p id="1"><table><tr><td><p id="2"></table></div><p id="3">`,
-		`div p`,
-		[]string{
-			`<p id="1">`,
-			`<p id="2">`,
-		},
-	},
-	{
-		`<div><p id="1"><table><tr><td><p id="2"></table></div><p id="3">`,
-		`div table p`,
-		[]string{
-			`<p id="2">`,
-		},
-	},
-	{
-		`<div><p id="1"><div><p id="2"></div><table><tr><td><p id="3"></table></div>`,
-		`div > p`,
-		[]string{
-			`<p id="1">`,
-			`<p id="2">`,
-		},
-	},
-	{
-		`<p id="1"><p id="2"></p><address></address><p id="3">`,
-		`p ~ p`,
-		[]string{
-			`<p id="2">`,
-			`<p id="3">`,
-		},
-	},
-	{
-		`<p id="1"></p>
-		 <!--comment-->
-		 <p id="2"></p><address></address><p id="3">`,
-		`p + p`,
-		[]string{
-			`<p id="2">`,
-		},
-	},
-	{
-		`<ul><li></li><li></li></ul><p>`,
-		`li, p`,
-		[]string{
-			"<li>",
-			"<li>",
-			"<p>",
-		},
-	},
-	{
-		`<p id="1"><p id="2"></p><address></address><p id="3">`,
-		`p +/*This is a comment*/ p`,
-		[]string{
-			`<p id="2">`,
-		},
-	},
-	{
-		`<p>Text block that <span>wraps inner text</span> and continues</p>`,
-		`p:contains("that wraps")`,
-		[]string{
-			`<p>`,
-		},
-	},
-	{
-		`<p>Text block that <span>wraps inner text</span> and continues</p>`,
-		`p:containsOwn("that wraps")`,
-		[]string{},
-	},
-	{
-		`<p>Text block that <span>wraps inner text</span> and continues</p>`,
-		`:containsOwn("inner")`,
-		[]string{
-			`<span>`,
-		},
-	},
-	{
-		`<p>Text block that <span>wraps inner text</span> and continues</p>`,
-		`p:containsOwn("block")`,
-		[]string{
-			`<p>`,
-		},
-	},
-	{
-		`<div id="d1"><p id="p1"><span>text content</span></p></div><div id="d2"/>`,
-		`div:has(#p1)`,
-		[]string{
-			`<div id="d1">`,
-		},
-	},
-	{
-		`<div id="d1"><p id="p1"><span>contents 1</span></p></div>
-		<div id="d2"><p>contents <em>2</em></p></div>`,
-		`div:has(:containsOwn("2"))`,
-		[]string{
-			`<div id="d2">`,
-		},
-	},
-	{
-		`<body><div id="d1"><p id="p1"><span>contents 1</span></p></div>
-		<div id="d2"><p id="p2">contents <em>2</em></p></div></body>`,
-		`body :has(:containsOwn("2"))`,
-		[]string{
-			`<div id="d2">`,
-			`<p id="p2">`,
-		},
-	},
-	{
-		`<body><div id="d1"><p id="p1"><span>contents 1</span></p></div>
-		<div id="d2"><p id="p2">contents <em>2</em></p></div></body>`,
-		`body :haschild(:containsOwn("2"))`,
-		[]string{
-			`<p id="p2">`,
-		},
-	},
-	{
-		`<p id="p1">0123456789</p><p id="p2">abcdef</p><p id="p3">0123ABCD</p>`,
-		`p:matches([\d])`,
-		[]string{
-			`<p id="p1">`,
-			`<p id="p3">`,
-		},
-	},
-	{
-		`<p id="p1">0123456789</p><p id="p2">abcdef</p><p id="p3">0123ABCD</p>`,
-		`p:matches([a-z])`,
-		[]string{
-			`<p id="p2">`,
-		},
-	},
-	{
-		`<p id="p1">0123456789</p><p id="p2">abcdef</p><p id="p3">0123ABCD</p>`,
-		`p:matches([a-zA-Z])`,
-		[]string{
-			`<p id="p2">`,
-			`<p id="p3">`,
-		},
-	},
-	{
-		`<p id="p1">0123456789</p><p id="p2">abcdef</p><p id="p3">0123ABCD</p>`,
-		`p:matches([^\d])`,
-		[]string{
-			`<p id="p2">`,
-			`<p id="p3">`,
-		},
-	},
-	{
-		`<p id="p1">0123456789</p><p id="p2">abcdef</p><p id="p3">0123ABCD</p>`,
-		`p:matches(^(0|a))`,
-		[]string{
-			`<p id="p1">`,
-			`<p id="p2">`,
-			`<p id="p3">`,
-		},
-	},
-	{
-		`<p id="p1">0123456789</p><p id="p2">abcdef</p><p id="p3">0123ABCD</p>`,
-		`p:matches(^\d+$)`,
-		[]string{
-			`<p id="p1">`,
-		},
-	},
-	{
-		`<p id="p1">0123456789</p><p id="p2">abcdef</p><p id="p3">0123ABCD</p>`,
-		`p:not(:matches(^\d+$))`,
-		[]string{
-			`<p id="p2">`,
-			`<p id="p3">`,
-		},
-	},
-	{
-		`<div><p id="p1">01234<em>567</em>89</p><div>`,
-		`div :matchesOwn(^\d+$)`,
-		[]string{
-			`<p id="p1">`,
-			`<em>`,
-		},
-	},
-	{
-		`<ul>
-			<li><a id="a1" href="http://www.google.com/finance"/>
-			<li><a id="a2" href="http://finance.yahoo.com/"/>
-			<li><a id="a2" href="http://finance.untrusted.com/"/>
-			<li><a id="a3" href="https://www.google.com/news"/>
-			<li><a id="a4" href="http://news.yahoo.com"/>
-		</ul>`,
-		`[href#=(fina)]:not([href#=(\/\/[^\/]+untrusted)])`,
-		[]string{
-			`<a id="a1" href="http://www.google.com/finance">`,
-			`<a id="a2" href="http://finance.yahoo.com/">`,
-		},
-	},
-	{
-		`<ul>
-			<li><a id="a1" href="http://www.google.com/finance"/>
-			<li><a id="a2" href="http://finance.yahoo.com/"/>
-			<li><a id="a3" href="https://www.google.com/news"/>
-			<li><a id="a4" href="http://news.yahoo.com"/>
-		</ul>`,
-		`[href#=(^https:\/\/[^\/]*\/?news)]`,
-		[]string{
-			`<a id="a3" href="https://www.google.com/news">`,
-		},
-	},
-	{
-		`<form>
-			<label>Username <input type="text" name="username" /></label>
-			<label>Password <input type="password" name="password" /></label>
-			<label>Country
-				<select name="country">
-					<option value="ca">Canada</option>
-					<option value="us">United States</option>
-				</select>
-			</label>
-			<label>Bio <textarea name="bio"></textarea></label>
-			<button>Sign up</button>
-		</form>`,
-		`:input`,
-		[]string{
-			`<input type="text" name="username">`,
-			`<input type="password" name="password">`,
-			`<select name="country">`,
-			`<textarea name="bio">`,
-			`<button>`,
-		},
-	},
-}
+// selectorTests is the conformance corpus from the cascadiatest package.
+// TestSelectors runs it, and other tests use its fixtures and selectors.
+var selectorTests = cascadiatest.Cases()
 
+// TestSelectors runs the conformance corpus, and checks that MatchFirst
+// agrees with MatchAll on each case.
 func TestSelectors(t *testing.T) {
+	engine := cascadiatest.EngineFunc(func(sel string, root *html.Node) ([]*html.Node, error) {
+		s, err := Compile(sel)
+		if err != nil {
+			return nil, err
+		}
+		matches := s.MatchAll(root)
+		first := s.MatchFirst(root)
+		if len(matches) == 0 && first != nil || len(matches) > 0 && first != matches[0] {
+			t.Errorf("%s: MatchFirst doesn't return the first node from MatchAll", sel)
+		}
+		return matches, nil
+	})
+	for _, f := range cascadiatest.Run(engine, selectorTests) {
+		t.Error(f)
+	}
+}
+
+func TestMatchAllChan(t *testing.T) {
 	for _, test := range selectorTests {
-		s, err := Compile(test.selector)
+		s, err := Compile(test.Selector)
 		if err != nil {
-			t.Errorf("error compiling %q: %s", test.selector, err)
+			t.Errorf("error compiling %q: %s", test.Selector, err)
 			continue
 		}
 
@@ -531,29 +63,875 @@ func TestSelectors(t *testing.T) {
 			continue
 		}
 
-		matches := s.MatchAll(doc)
-		if len(matches) != len(test.results) {
-			t.Errorf("wanted %d elements, got %d instead", len(test.results), len(matches))
+		want := s.MatchAll(doc)
+		i := 0
+		for m := range s.MatchAllChan(doc) {
+			if i >= len(want) {
+				t.Errorf("%s: MatchAllChan: got extra match %s", test.Selector, nodeString(m))
+			} else if m != want[i] {
+				t.Errorf("%s: MatchAllChan: match %d: want %s, got %s", test.Selector, i, nodeString(want[i]), nodeString(m))
+			}
+			i++
+		}
+		if i < len(want) {
+			t.Errorf("%s: MatchAllChan: wanted %d elements, got %d instead", test.Selector, len(want), i)
+		}
+	}
+}
+
+func TestCompileGroup(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<h1 class="foo"></h1><h2></h2><p class="bar"><p class="foo">`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := CompileGroup(`h1, h2 ,.foo`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g) != 3 {
+		t.Fatalf("got %d members, want 3", len(g))
+	}
+	if got := len(g[2].MatchAll(doc)); got != 2 {
+		t.Errorf(".foo: got %d matches, want 2", got)
+	}
+
+	var got []string
+	for _, m := range g.MatchAll(doc) {
+		got = append(got, nodeString(m))
+	}
+	want := []string{`<h1 class="foo">`, `<h2>`, `<p class="foo">`}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("MatchAll: got %v, want %v", got, want)
+	}
+
+	for _, sel := range []string{`h1, , h2`, `h1,`, `h1 h2)`} {
+		if _, err := CompileGroup(sel); err == nil {
+			t.Errorf("CompileGroup(%q): got no error", sel)
+		}
+	}
+}
+
+func TestMatchFirstStopsEarly(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div id="1"><p id="2"><span></span></p><p id="3"></p></div><div id="4"></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := MustCompile("p")
+	var visited []*html.Node
+	s := Selector(func(n *html.Node) bool {
+		visited = append(visited, n)
+		return p(n)
+	})
+
+	m := s.MatchFirst(doc)
+	if got := nodeString(m); got != `<p id="2">` {
+		t.Fatalf("got %s, want <p id=\"2\">", got)
+	}
+	if last := visited[len(visited)-1]; last != m {
+		t.Errorf("visited %s after the match", nodeString(last))
+	}
+}
+
+// TestMatchDoesNotAllocate checks that compiled selectors, which are the
+// Match methods of structs rather than chains of closures, test nodes
+// without allocating.
+func TestMatchDoesNotAllocate(t *testing.T) {
+	var nodes []*html.Node
+	for n := largeDoc; n != nil; n = nextInSubtree(n, largeDoc) {
+		nodes = append(nodes, n)
+	}
+	for _, sel := range []string{
+		`div.row`,
+		`#main, h2, .price span`,
+		`body div.row > p a[href]`,
+		`div.row p:not(.x) > em`,
+		`p[class~=note i]:nth-child(2n+1)`,
+		`div:has(> p):is(.row, .col)`,
+		`:root, :empty, :first-of-type, :only-child`,
+		`input:checked, :disabled, :required`,
+	} {
+		s := MustCompile(sel)
+		allocs := testing.AllocsPerRun(5, func() {
+			for _, n := range nodes {
+				s.Match(n)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("%s: %v allocations per walk", sel, allocs)
+		}
+	}
+}
+
+// TestMatchAllAllocs checks that MatchAll only allocates its result slice,
+// which grows by doubling, rather than a slice for each subtree.
+func TestMatchAllAllocs(t *testing.T) {
+	var matches []*html.Node
+	allocs := testing.AllocsPerRun(10, func() {
+		matches = rowSelector.MatchAll(largeDoc)
+	})
+	if len(matches) != 5000 {
+		t.Fatalf("got %d matches, want 5000", len(matches))
+	}
+	if allocs > 32 {
+		t.Errorf("MatchAll made %v allocations for %d matches", allocs, len(matches))
+	}
+}
+
+func TestDeepTree(t *testing.T) {
+	const depth = 100000
+	root := &html.Node{Type: html.ElementNode, Data: "div"}
+	n := root
+	for i := 1; i < depth; i++ {
+		c := &html.Node{Type: html.ElementNode, Data: "div"}
+		n.AppendChild(c)
+		n = c
+	}
+	n.AppendChild(&html.Node{Type: html.ElementNode, Data: "p"})
+	n.AppendChild(&html.Node{Type: html.ElementNode, Data: "p"})
+
+	if got := len(MustCompile("div").MatchAll(root)); got != depth {
+		t.Errorf("got %d div elements, want %d", got, depth)
+	}
+	last := MustCompile("p:nth-last-child(1)").MatchFirst(root)
+	if last == nil || last != n.LastChild {
+		t.Errorf("p:nth-last-child(1) matched %v, want the last p", last)
+	}
+}
+
+func TestEachMatch(t *testing.T) {
+	for _, test := range selectorTests {
+		s := MustCompile(test.Selector)
+		doc, err := html.Parse(strings.NewReader(test.HTML))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []*html.Node
+		s.EachMatch(doc, func(n *html.Node) bool {
+			got = append(got, n)
+			return true
+		})
+		if want := s.MatchAll(doc); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: EachMatch found %d nodes, MatchAll %d", test.Selector, len(got), len(want))
+		}
+	}
+
+	doc, err := html.Parse(strings.NewReader(`<ul><li>a</li><li>b</li></ul><ul><li>c</li></ul><ul><li>d</li></ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ul, li := MustCompile("ul"), MustCompile("li")
+
+	// Stop after the first two lists, counting their items from within fn.
+	var lists, items int
+	ul.EachMatch(doc, func(n *html.Node) bool {
+		lists++
+		li.EachMatch(n, func(*html.Node) bool {
+			items++
+			return true
+		})
+		return lists < 2
+	})
+	if lists != 2 || items != 3 {
+		t.Errorf("got %d lists and %d items, want 2 and 3", lists, items)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<ul><li class="a"><p class="a"></p></li><li></li><li class="a"></li></ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis := MustCompile("li").MatchAll(doc)
+	nodes := []*html.Node{lis[2], lis[1], lis[0]}
+	got := MustCompile(".a").Filter(nodes)
+	if len(got) != 2 || got[0] != lis[2] || got[1] != lis[0] {
+		t.Errorf("got %d nodes, want the two li.a elements in input order", len(got))
+	}
+	if nodes[0] != lis[2] || nodes[1] != lis[1] || nodes[2] != lis[0] {
+		t.Error("Filter modified its input")
+	}
+
+	text := &html.Node{Type: html.TextNode, Data: "a"}
+	got = MustCompile(`.a, :contains("a")`).Filter([]*html.Node{lis[0], text, lis[2], lis[0]})
+	if len(got) != 2 || got[0] != lis[0] || got[1] != lis[2] {
+		t.Errorf("got %d nodes, want the two li.a elements once each", len(got))
+	}
+
+	if got := MustCompile("li").Filter(nil); got == nil || len(got) != 0 {
+		t.Errorf("Filter(nil): got %#v, want an empty slice", got)
+	}
+}
+
+func TestAttributeURLSchemeSelector(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`
+		<a id="1" href="javascript:alert(1)"></a>
+		<a id="2" href="  JavaScript:void(0)"></a>
+		<a id="3" href="java&#9;script:alert(1)"></a>
+		<a id="4" href="/javascript:x"></a>
+		<a id="5" href="https://example.com/?javascript:"></a>
+		<a id="6" href="data:text/html,hi"></a>
+		<a id="7" title="javascript:"></a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for scheme, want := range map[string]string{
+		"javascript":  "1 2 3",
+		"JAVASCRIPT:": "1 2 3",
+		"data":        "6",
+		"https":       "5",
+	} {
+		var got []string
+		for _, n := range AttributeURLSchemeSelector("href", scheme).MatchAll(doc) {
+			got = append(got, attributeValue(n, "id"))
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("%s: got %v, want %s", scheme, got, want)
+		}
+	}
+}
+
+func TestRoute(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div class="ad"><p class="text">ad</p></div><div><p class="text">1</p><p>2</p></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := CompileGroup(".ad, .text, p")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		nested bool
+		want   string
+	}{
+		{false, `0:<div class="ad"> 1:<p class="text"> 2:<p>`},
+		{true, `0:<div class="ad"> 1:<p class="text"> 1:<p class="text"> 2:<p>`},
+	} {
+		var routed []Routed
+		if test.nested {
+			routed = g.RouteNested(doc)
+		} else {
+			routed = g.Route(doc)
+		}
+		var got []string
+		for _, r := range routed {
+			got = append(got, fmt.Sprintf("%d:%s", r.Index, nodeString(r.Node)))
+		}
+		if strings.Join(got, " ") != test.want {
+			t.Errorf("nested=%v: got %v, want %s", test.nested, got, test.want)
+		}
+	}
+}
+
+func TestCombinatorConstructors(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div><h2></h2><p id="1"></p><section><p id="2"></p></section><p id="3"></p></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	div, h2, p := MustCompile("div"), MustCompile("h2"), MustCompile("p")
+	for sel, s := range map[string]Selector{
+		"div p":   Descendant(div, p),
+		"div > p": Child(div, p),
+		"h2 + p":  AdjacentSibling(h2, p),
+		"h2 ~ p":  GeneralSibling(h2, p),
+	} {
+		want := MustCompile(sel).MatchAll(doc)
+		got := s.MatchAll(doc)
+		if len(got) != len(want) {
+			t.Errorf("%s: got %d matches, want %d", sel, len(got), len(want))
 			continue
 		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("%s: match %d: got %s, want %s", sel, i, nodeString(got[i]), nodeString(want[i]))
+			}
+		}
+	}
+}
+
+func TestAttributeRegexpSelector(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<a id="a1" href="https://example.com/"></a><a id="a2" href="ftp://example.com/"></a><a id="a3"></a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := AttributeRegexpSelector("HREF", regexp.MustCompile(`^https?:`))
+	matches := s.MatchAll(doc)
+	if len(matches) != 1 || attributeValue(matches[0], "id") != "a1" {
+		t.Errorf("got %d matches, want only a1", len(matches))
+	}
+}
+
+func TestAttributeOrderSelector(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`
+		<a id="1" href="x" class="y"></a>
+		<a class="y" id="2" href="x"></a>
+		<a href="x" id="3"></a>
+		<a id="4" title="t" HREF="x" data-x="z" class="y"></a>
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		for i, m := range matches {
-			got := nodeString(m)
-			if got != test.results[i] {
-				t.Errorf("wanted %s, got %s instead", test.results[i], got)
+	tests := []struct {
+		keys []string
+		want string
+	}{
+		{[]string{"id", "href"}, "1 2 4"},
+		{[]string{"id", "href", "class"}, "1 4"},
+		{[]string{"href", "id"}, "3"},
+		{[]string{"ID", "Class"}, "1 4"},
+		{[]string{"class", "href"}, "2"},
+		{[]string{"title", "data-x"}, "4"},
+		{nil, "1 2 3 4"},
+	}
+	for _, test := range tests {
+		var ids []string
+		for _, n := range AttributeOrderSelector(test.keys...).MatchAll(doc) {
+			if id := attributeValue(n, "id"); id != "" {
+				ids = append(ids, id)
 			}
 		}
+		if got := strings.Join(ids, " "); got != test.want {
+			t.Errorf("%q: got %s, want %s", test.keys, got, test.want)
+		}
+	}
+}
+
+func TestMissingAttrSelector(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`
+		<img id="1" src="a.png">
+		<img id="2" src="b.png" alt="">
+		<img id="3" src="c.png" alt=" ">
+		<img id="4" src="d.png" alt="A dog">
+		<a id="5">x</a>
+		<a id="6" href="">x</a>
+		<a id="7" href="/">x</a>
+		<area id="8">
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		firstMatch := s.MatchFirst(doc)
-		if len(test.results) == 0 {
-			if firstMatch != nil {
-				t.Errorf("MatchFirst: want nil, got %s", nodeString(firstMatch))
+	tests := []struct {
+		tag, attr, want string
+	}{
+		{"img", "alt", "1 2 3"},
+		{"IMG", "ALT", "1 2 3"},
+		{"a", "href", "5 6"},
+		{"", "href", "1 2 3 4 5 6 8"},
+		{"img", "src", ""},
+	}
+	for _, test := range tests {
+		var ids []string
+		for _, n := range MissingAttrSelector(test.tag, test.attr).MatchAll(doc) {
+			if id := attributeValue(n, "id"); id != "" {
+				ids = append(ids, id)
 			}
-		} else {
-			got := nodeString(firstMatch)
-			if got != test.results[0] {
-				t.Errorf("MatchFirst: want %s, got %s", test.results[0], got)
+		}
+		if got := strings.Join(ids, " "); got != test.want {
+			t.Errorf("MissingAttrSelector(%q, %q): got %s, want %s", test.tag, test.attr, got, test.want)
+		}
+	}
+}
+
+func TestTextPredicateSelectors(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<table><tr>
+		<td id="1"> 42 </td>
+		<td id="2">1 234</td>
+		<td id="3">4.5</td>
+		<td id="4"><b>7</b>8</td>
+		<td id="5">  </td>
+		<td id="6">ABC, INC.</td>
+		<td id="7">Abc</td>
+		<td id="8">NO 1</td>
+		<td id="9">ÉTÉ</td>
+	</tr></table>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		sel  Selector
+		want string
+	}{
+		{"AllDigitsText", AllDigitsText(), "1 2 4"},
+		{"AllUpperText", AllUpperText(), "6 8 9"},
+		{"empty text", TextPredicateSelector(func(s string) bool { return s == "" }), "5"},
+		{"trimmed text", TextPredicateSelector(func(s string) bool { return s == "42" }), "1"},
+	}
+	for _, test := range tests {
+		var ids []string
+		for _, n := range test.sel.MatchAll(doc) {
+			if n.Data == "td" {
+				ids = append(ids, attributeValue(n, "id"))
 			}
 		}
+		if got := strings.Join(ids, " "); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTextDiffersFromPrevSibling(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<ul>
+		<li id="1">a</li>
+		<li id="2"> a </li>
+		<!-- b -->
+		<li id="3">b</li>
+		<li id="4"><i>b</i></li>
+		<li id="5">a</li>
+	</ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, n := range TextDiffersFromPrevSibling().MatchAll(doc) {
+		if n.Data == "li" {
+			ids = append(ids, attributeValue(n, "id"))
+		}
+	}
+	if got := strings.Join(ids, " "); got != "3 5" {
+		t.Errorf("got %s, want 3 5", got)
+	}
+}
+
+// TestCompileGroupMatchesCompile checks that a SelectorGroup matches the same
+// nodes as the Selector compiled from the same text, each node once and in
+// document order, even where several members match it.
+func TestCompileGroupMatchesCompile(t *testing.T) {
+	for _, test := range selectorTests {
+		g, err := CompileGroup(test.Selector)
+		if err != nil {
+			t.Errorf("error compiling %q: %s", test.Selector, err)
+			continue
+		}
+		doc, err := html.Parse(strings.NewReader(test.HTML))
+		if err != nil {
+			t.Errorf("error parsing %q: %s", test.HTML, err)
+			continue
+		}
+
+		want := MustCompile(test.Selector).MatchAll(doc)
+		if got := g.MatchAll(doc); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %d nodes, want %d", test.Selector, len(got), len(want))
+		}
+	}
+}
+
+func TestMustCompilePanic(t *testing.T) {
+	defer func() {
+		r := recover()
+		msg, _ := r.(string)
+		if want := `cascadia: Compile("a[href"): `; !strings.HasPrefix(msg, want) {
+			t.Errorf("got panic %v, want message starting with %q", r, want)
+		}
+		if !strings.Contains(msg, "unexpected EOF in attribute selector") {
+			t.Errorf("panic message %q doesn't include the underlying error", msg)
+		}
+	}()
+	MustCompile("a[href")
+}
+
+func TestMatchAllBreadthFirst(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div id="1"><div id="2"><div id="3"></div></div><div id="4"></div></div><div id="5"><div id="6"></div></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, n := range MustCompile("div").MatchAllBreadthFirst(doc) {
+		ids = append(ids, attributeValue(n, "id"))
+	}
+	if got, want := strings.Join(ids, " "), "1 5 2 4 6 3"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, test := range selectorTests {
+		s := MustCompile(test.Selector)
+		doc, err := html.Parse(strings.NewReader(test.HTML))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(s.MatchAllBreadthFirst(doc)), len(s.MatchAll(doc)); got != want {
+			t.Errorf("%s: got %d matches, want %d", test.Selector, got, want)
+		}
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div id="d"><title id="t1"></title>
+		<svg id="s"><title id="t2"></title><circle id="c"></circle><a id="a1" xlink:href="#c" href="#x"></a><foreignObject id="f"><div id="d2"></div></foreignObject></svg>
+		<math id="m"><mi id="mi"></mi></math><a id="a2" href="#y"></a></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{Namespaces: map[string]string{"s": "svg", "h": ""}}
+	for sel, want := range map[string]string{
+		`title`:               "t1 t2",
+		`*|title`:             "t1 t2",
+		`svg|title`:           "t2",
+		`s|title`:             "t2",
+		`|title`:              "t1",
+		`h|title`:             "t1",
+		`svg|*`:               "s t2 c a1 f",
+		`math|*`:              "m mi",
+		`|*[id^=d]`:           "d d2",
+		`*|*#c`:               "c",
+		`svg|foreignobject`:   "f",
+		`[href]`:              "a1 a2",
+		`[*|href]`:            "a1 a2",
+		`[xlink|href]`:        "a1",
+		`[|href]`:             "a1 a2",
+		`[xlink|href="#c"]`:   "a1",
+		`[xlink|href|="#c"]`:  "a1",
+		`[|href="#c"]`:        "",
+		`a:not([xlink|href])`: "a2",
+	} {
+		s, err := CompileWithOptions(sel, opts)
+		if err != nil {
+			t.Errorf("%s: %s", sel, err)
+			continue
+		}
+		var ids []string
+		for _, n := range s.MatchAll(doc) {
+			ids = append(ids, attributeValue(n, "id"))
+		}
+		if got := strings.Join(ids, " "); got != want {
+			t.Errorf("%s: got %q, want %q", sel, got, want)
+		}
+	}
+
+	for _, sel := range []string{"foo|div", "[foo|href]", "s|title"} {
+		if _, err := Compile(sel); err == nil || !strings.Contains(err.Error(), "undeclared namespace prefix") {
+			t.Errorf("%s: got error %v, want undeclared namespace prefix", sel, err)
+		}
+	}
+}
+
+func TestOwningElement(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div id="outer"><div id="inner"><p id="p">Hello <!-- note --><b>world</b></p></div></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := MustCompile("#p").MatchFirst(doc)
+	hello, comment, b := p.FirstChild, p.FirstChild.NextSibling, p.LastChild
+
+	for _, test := range []struct {
+		sel   string
+		start *html.Node
+		want  string
+	}{
+		{"div", hello, "inner"},
+		{"p", hello, "p"},
+		{"p", comment, "p"},
+		{"#outer", b.FirstChild, "outer"},
+		{"b", b, ""},
+		{"p", b, "p"},
+		{`:contains("Hello")`, hello, "p"},
+		{"span", hello, "none"},
+	} {
+		got := MustCompile(test.sel).OwningElement(test.start)
+		id := "none"
+		if got != nil {
+			id = attributeValue(got, "id")
+		}
+		if id != test.want {
+			t.Errorf("%s from %s: got %q, want %q", test.sel, nodeString(test.start), id, test.want)
+		}
+	}
+
+	if got := MustCompile("p").OwningElement(nil); got != nil {
+		t.Errorf("from nil: got %s, want nil", nodeString(got))
+	}
+}
+
+func TestMatchClosest(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div class="item" id="far"><div class="item" id="near"><a id="a" class="item">link</a></div></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := MustCompile("#a").MatchFirst(doc)
+	text := a.FirstChild
+
+	item := MustCompile(".item")
+	if got := item.MatchClosest(a); got != a {
+		t.Errorf("from the a element: got %s, want the a element itself", nodeString(got))
+	}
+	if got := item.MatchClosest(text); got != a {
+		t.Errorf("from the text node: got %s, want the a element", nodeString(got))
+	}
+	if got := MustCompile("div.item").MatchClosest(text); attributeValue(got, "id") != "near" {
+		t.Errorf("div.item: got %s, want #near", nodeString(got))
+	}
+
+	// Detach the inner div; the search stops at it.
+	near := a.Parent
+	near.Parent.RemoveChild(near)
+	if got := MustCompile("#far").MatchClosest(text); got != nil {
+		t.Errorf("#far from a detached subtree: got %s, want nil", nodeString(got))
+	}
+	if got := MustCompile("div").MatchClosest(text); got != near {
+		t.Errorf("div from a detached subtree: got %s, want #near", nodeString(got))
+	}
+}
+
+func TestScopedTo(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<ul id="a"><li id="1"><ul id="b"><li id="2"></li></ul></li></ul><ul id="c"><li id="3"></li></ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := MustCompile("#a").MatchFirst(doc)
+	b := MustCompile("#b").MatchFirst(doc)
+
+	for _, test := range []struct {
+		sel      string
+		ancestor *html.Node
+		want     string
+	}{
+		{"li", a, "1 2"},
+		{"li", b, "2"},
+		{"ul", a, "b"},
+		{"ul", b, ""},
+		{"li", doc, "1 2 3"},
+	} {
+		var ids []string
+		for _, n := range MustCompile(test.sel).ScopedTo(test.ancestor).MatchAll(doc) {
+			ids = append(ids, attributeValue(n, "id"))
+		}
+		if got := strings.Join(ids, " "); got != test.want {
+			t.Errorf("%s scoped to %s: got %q, want %q", test.sel, nodeString(test.ancestor), got, test.want)
+		}
+	}
+}
+
+func TestMatchAllInto(t *testing.T) {
+	sel := MustCompile("div.matched")
+	want := sel.MatchAll(dom)
+
+	prefix := &html.Node{}
+	got := sel.MatchAllInto(dom, []*html.Node{prefix})
+	if len(got) != len(want)+1 || got[0] != prefix || !reflect.DeepEqual(got[1:], want) {
+		t.Errorf("got %d nodes, want the prefix and %d matches", len(got), len(want))
+	}
+
+	buf := make([]*html.Node, 0, len(want))
+	allocs := testing.AllocsPerRun(10, func() {
+		buf = sel.MatchAllInto(dom, buf[:0])
+	})
+	if allocs != 0 || !reflect.DeepEqual(buf, want) {
+		t.Errorf("reusing the slice: got %d matches and %v allocations, want %d and none", len(buf), allocs, len(want))
+	}
+
+	if got := Selector(never).MatchAllInto(dom, buf[:1]); len(got) != 1 {
+		t.Errorf("Never: got %d nodes, want dst unchanged", len(got))
+	}
+}
+
+func TestDeepestMatches(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`
+		<div id="1"><div id="2"><div id="3"></div></div><p><div id="4"></div></p></div>
+		<div id="5"><span><div id="6"><b></b></div></span></div>
+		<div id="7"></div>
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, n := range MustCompile("div").DeepestMatches(doc) {
+		ids = append(ids, attributeValue(n, "id"))
+	}
+	if got := strings.Join(ids, " "); got != "3 4 6 7" {
+		t.Errorf("got %s, want 3 4 6 7", got)
+	}
+	if got := MustCompile("table").DeepestMatches(doc); len(got) != 0 {
+		t.Errorf("with no matches: got %d nodes, want none", len(got))
+	}
+}
+
+func TestMatchAllMaxDepth(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div id="1"><div id="2"><div id="3"></div></div><p></p><div id="4"></div></div><div id="5"></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := MustCompile("body").MatchFirst(doc)
+
+	for depth, want := range []string{"", "1 5", "1 2 4 5", "1 2 3 4 5", "1 2 3 4 5"} {
+		var ids []string
+		for _, n := range MustCompile("div").MatchAllMaxDepth(body, depth) {
+			ids = append(ids, attributeValue(n, "id"))
+		}
+		if got := strings.Join(ids, " "); got != want {
+			t.Errorf("depth %d: got %q, want %q", depth, got, want)
+		}
+	}
+	if got := MustCompile("body").MatchAllMaxDepth(body, 0); len(got) != 1 || got[0] != body {
+		t.Errorf("depth 0: got %v, want body itself", got)
+	}
+}
+
+func TestMatchN(t *testing.T) {
+	sel := MustCompile("div")
+	all := sel.MatchAll(dom)
+	for _, limit := range []int{-1, 0, 1, 3, len(all), len(all) + 5} {
+		var want []*html.Node
+		switch {
+		case limit > len(all):
+			want = all
+		case limit > 0:
+			want = all[:limit]
+		}
+		if got := sel.MatchN(dom, limit); !reflect.DeepEqual(got, want) {
+			t.Errorf("max %d: got %d nodes, want the first %d matches", limit, len(got), len(want))
+		}
+	}
+}
+
+// TestDeepDocument checks that matching doesn't recurse once per level of a
+// very deeply nested document.
+func TestDeepDocument(t *testing.T) {
+	const depth = 100000
+	doc := &html.Node{Type: html.DocumentNode}
+	top := &html.Node{Type: html.ElementNode, Data: "div"}
+	doc.AppendChild(top)
+	n := top
+	for i := 1; i < depth; i++ {
+		c := &html.Node{Type: html.ElementNode, Data: "div"}
+		n.AppendChild(c)
+		n = c
+	}
+	p := &html.Node{Type: html.ElementNode, Data: "p"}
+	p.AppendChild(&html.Node{Type: html.TextNode, Data: "deep"})
+	n.AppendChild(p)
+
+	if got := len(MustCompile("div").MatchAll(doc)); got != depth {
+		t.Errorf("MatchAll: got %d matches, want %d", got, depth)
+	}
+	if got := MustCompile(`div:has(p):contains("deep")`).MatchFirst(doc); got != top {
+		t.Errorf("MatchFirst: got %v, want the outermost div", got)
+	}
+	routed := SelectorGroup{MustCompile("p"), MustCompile("div")}.RouteNested(doc)
+	if len(routed) != depth+1 || routed[depth].Node != p || routed[depth].Index != 0 {
+		t.Errorf("RouteNested: got %d nodes, want %d ending with the p", len(routed), depth+1)
+	}
+	if got := len(MustCompile("div").MatchAllMaxDepth(doc, 10)); got != 10 {
+		t.Errorf("MatchAllMaxDepth: got %d matches, want 10", got)
+	}
+}
+
+func TestMatchAllDescendants(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div id="1"><div id="2"><div id="3"></div></div><p></p><div id="4"></div></div>`))
+	if err != nil {
+		t.Fatal(err)
 	}
+	outer := MustCompile("#1").MatchFirst(doc)
+
+	var ids []string
+	for _, n := range MustCompile("div").MatchAllDescendants(outer) {
+		ids = append(ids, attributeValue(n, "id"))
+	}
+	if got := strings.Join(ids, " "); got != "2 3 4" {
+		t.Errorf("got %s, want 2 3 4", got)
+	}
+	if got := MustCompile("div").MatchAllDescendants(outer.LastChild); got != nil {
+		t.Errorf("in an empty element: got %d matches, want none", len(got))
+	}
+}
+
+func TestRootDetached(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p id="1"><b></b></p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := MustCompile(":root")
+	if got := root.MatchAll(doc); len(got) != 1 || got[0].Data != "html" {
+		t.Errorf("got %d matches, want only <html>", len(got))
+	}
+
+	// An element without a parent isn't the root of a document.
+	p := MustCompile("p").MatchFirst(doc)
+	p.Parent.RemoveChild(p)
+	if root.Match(p) {
+		t.Error(":root matched a detached element")
+	}
+	if got := MustCompile(":root > b, :root b").MatchAll(p); len(got) != 0 {
+		t.Errorf("got %d matches in a detached subtree, want 0", len(got))
+	}
+}
+
+func TestMatchAllTagged(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p class="a"></p><p></p><div class="a"></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var matches []TaggedMatch
+	for _, rule := range []struct{ sel, media string }{
+		{"p", "screen"},
+		{".a", "print and (min-width: 10cm)"},
+	} {
+		matches = append(matches, MustCompile(rule.sel).MatchAllTagged(doc, rule.media)...)
+	}
+
+	var got []string
+	for _, m := range matches {
+		got = append(got, fmt.Sprintf("%s@%s", nodeString(m.Node), m.Tag))
+	}
+	want := []string{
+		`<p class="a">@screen`,
+		`<p>@screen`,
+		`<p class="a">@print and (min-width: 10cm)`,
+		`<div class="a">@print and (min-width: 10cm)`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestHasStopsEarly(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div><p id="1"></p><p id="2"></p><p id="3"></p></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	div := MustCompile("div").MatchFirst(doc)
+
+	calls := 0
+	p := MustCompile("p")
+	has := hasSelector{sel: relativeSelector{combinator: ' ', sel: countingSel{p, &calls}}}
+	if !has.Match(div) {
+		t.Fatal("div:has(p) didn't match")
+	}
+	if calls != 1 {
+		t.Errorf("tested %d descendants, want 1", calls)
+	}
+}
+
+// countingSel is a Sel that counts how many times it is tested.
+type countingSel struct {
+	s     Selector
+	calls *int
+}
+
+func (c countingSel) Match(n *html.Node) bool {
+	*c.calls++
+	return c.s(n)
+}
+
+func (c countingSel) String() string {
+	return "counting"
+}
+
+func (c countingSel) Specificity() Specificity {
+	return Specificity{}
 }
@@ -0,0 +1,27 @@
+//go:build go1.23
+
+package cascadia
+
+import (
+	"iter"
+
+	"golang.org/x/net/html"
+)
+
+// All returns an iterator over the nodes that match the selector, from n
+// and its descendants, in the same order as MatchAll. Like EachMatch, it
+// finds each match as the loop asks for it, without collecting them in a
+// slice, and the tree must not be modified during the loop.
+func (s Selector) All(n *html.Node) iter.Seq[*html.Node] {
+	return func(yield func(*html.Node) bool) {
+		s.EachMatch(n, yield)
+	}
+}
+
+// All is like Selector.All. The query ends when the loop does, so its
+// Duration includes the time spent in the body of the loop.
+func (s *ObservedSelector) All(n *html.Node) iter.Seq[*html.Node] {
+	return func(yield func(*html.Node) bool) {
+		s.eachMatch("All", n, yield)
+	}
+}
@@ -0,0 +1,54 @@
+//go:build go1.23
+
+package cascadia
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAll(t *testing.T) {
+	sel := MustCompile("div, p")
+	var got []string
+	for n := range sel.All(dom) {
+		got = append(got, n.Data)
+	}
+	want := make([]string, 0)
+	for _, n := range sel.MatchAll(dom) {
+		want = append(want, n.Data)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	count := 0
+	for range MustCompile("div").All(dom) {
+		count++
+		if count == 3 {
+			break
+		}
+	}
+	if count != 3 {
+		t.Errorf("after break: got %d iterations, want 3", count)
+	}
+
+	for range Selector(never).All(dom) {
+		t.Error("Never produced a match")
+	}
+}
+
+func TestObservedSelectorAll(t *testing.T) {
+	dom := MustParseHTML(`<div><p></p><p></p><p></p></div>`)
+	var log eventLog
+	sel, err := CompileObserved("p", Options{}, &log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range sel.All(dom) {
+		break
+	}
+	want := eventLog{"start All p", "end All 1/6"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("got events %q, want %q", log, want)
+	}
+}
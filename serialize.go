@@ -0,0 +1,371 @@
+package cascadia
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// writing parsed selectors back out in canonical form
+
+// escapeIdentifier returns s escaped so that it can be parsed back as a CSS
+// identifier.
+func escapeIdentifier(s string) string {
+	var b strings.Builder
+	for i, c := range s {
+		switch {
+		case c == 0:
+			b.WriteRune('\uFFFD')
+		case c < 0x20 || c == 0x7f,
+			i == 0 && '0' <= c && c <= '9',
+			i == 1 && '0' <= c && c <= '9' && s[0] == '-':
+			fmt.Fprintf(&b, "\\%x ", c)
+		case i == 0 && c == '-' && len(s) == 1:
+			b.WriteString(`\-`)
+		case c >= 0x80 || c == '-' || c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+			b.WriteRune(c)
+		default:
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// quoteString returns s as a double-quoted CSS string.
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\%x ", c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func (s tagSelector) String() string {
+	return escapeIdentifier(s.tag)
+}
+
+func (s namespaceTagSelector) String() string {
+	tag := "*"
+	if s.tag != "" {
+		tag = escapeIdentifier(s.tag)
+	}
+	return s.namespace.String() + tag
+}
+
+// String returns the namespace prefix followed by '|'.
+func (ns *namespace) String() string {
+	if ns == nil {
+		return ""
+	}
+	return escapeIdentifier(ns.prefix) + "|"
+}
+
+func (s dynamicSelector) String() string {
+	return ":" + s.name
+}
+
+func (s idSelector) String() string {
+	return "#" + escapeIdentifier(s.id)
+}
+
+func (s classSelector) String() string {
+	return "." + escapeIdentifier(s.class)
+}
+
+func (s attrSelector) String() string {
+	switch s.operation {
+	case "":
+		return "[" + s.namespace.String() + escapeIdentifier(s.key) + "]"
+	case "#=":
+		pattern := s.regexp.String()
+		if !bareRegex(pattern) {
+			pattern = quoteString(pattern)
+		}
+		return "[" + s.namespace.String() + escapeIdentifier(s.key) + "#=" + pattern + "]"
+	}
+
+	flag := ""
+	if s.ignoreCase {
+		flag = " i"
+	}
+	return "[" + s.namespace.String() + escapeIdentifier(s.key) + s.operation + quoteString(s.val) + flag + "]"
+}
+
+func (s classAffixSelector) String() string {
+	if s.suffix {
+		return ":class-suffix(" + quoteString(s.val) + ")"
+	}
+	return ":class-prefix(" + quoteString(s.val) + ")"
+}
+
+func (s compoundSelector) String() string {
+	if len(s) == 0 {
+		return "*"
+	}
+
+	var b strings.Builder
+	for _, sel := range s {
+		b.WriteString(sel.String())
+	}
+	return b.String()
+}
+
+func (s unionSelector) String() string {
+	parts := make([]string, len(s))
+	for i, sel := range s {
+		parts[i] = sel.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (s negatedSelector) String() string {
+	return ":not(" + s.sel.String() + ")"
+}
+
+func (s textSubstrSelector) String() string {
+	name := ":contains("
+	if s.own {
+		name = ":containsOwn("
+	}
+	return name + quoteString(s.val) + ")"
+}
+
+func (s textRegexSelector) String() string {
+	if s.own {
+		return ":matchesOwn(" + s.rx.String() + ")"
+	}
+	return ":matches(" + s.rx.String() + ")"
+}
+
+func (s hasSelector) String() string {
+	if s.child {
+		return ":haschild(" + s.sel.String() + ")"
+	}
+	return ":has(" + s.sel.String() + ")"
+}
+
+func (s matchesAnySelector) String() string {
+	if s.where {
+		return ":where(" + s.sel.String() + ")"
+	}
+	return ":is(" + s.sel.String() + ")"
+}
+
+func (s relativeSelector) String() string {
+	if s.combinator == ' ' {
+		return s.sel.String()
+	}
+	return string(s.combinator) + " " + s.sel.String()
+}
+
+func (s nthColSelector) String() string {
+	if s.last {
+		return ":nth-last-col(" + anbString(s.a, s.b) + ")"
+	}
+	return ":nth-col(" + anbString(s.a, s.b) + ")"
+}
+
+func (s nthChildSelector) String() string {
+	name := "child"
+	if s.ofType {
+		name = "of-type"
+	}
+	if s.of != nil {
+		if s.last {
+			name = "last-" + name
+		}
+		return ":nth-" + name + "(" + anbString(s.a, s.b) + " of " + s.of.String() + ")"
+	}
+	if s.a == 0 && s.b == 1 {
+		if s.last {
+			return ":last-" + name
+		}
+		return ":first-" + name
+	}
+	if s.last {
+		name = "last-" + name
+	}
+	return ":nth-" + name + "(" + anbString(s.a, s.b) + ")"
+}
+
+// anbString formats an an+b expression in canonical form.
+func anbString(a, b int) string {
+	var s string
+	switch a {
+	case 0:
+		return strconv.Itoa(b)
+	case 1:
+		s = "n"
+	case -1:
+		s = "-n"
+	default:
+		s = strconv.Itoa(a) + "n"
+	}
+
+	switch {
+	case b > 0:
+		s += "+" + strconv.Itoa(b)
+	case b < 0:
+		s += strconv.Itoa(b)
+	}
+	return s
+}
+
+func (s onlyChildSelector) String() string {
+	if s.ofType {
+		return ":only-of-type"
+	}
+	return ":only-child"
+}
+
+func (inputSelector) String() string {
+	return ":input"
+}
+
+func (s formStateSelector) String() string {
+	return ":" + s.state
+}
+
+func (s linkSelector) String() string {
+	return ":" + s.name
+}
+
+func (s langSelector) String() string {
+	ranges := make([]string, len(s.ranges))
+	for i, r := range s.ranges {
+		ranges[i] = escapeIdentifier(r)
+	}
+	return ":lang(" + strings.Join(ranges, ", ") + ")"
+}
+
+func (s dirSelector) String() string {
+	return ":dir(" + escapeIdentifier(s.dir) + ")"
+}
+
+func (emptyElementSelector) String() string {
+	return ":empty"
+}
+
+func (scopeSelector) String() string {
+	return ":scope"
+}
+
+func (rootSelector) String() string {
+	return ":root"
+}
+
+func (s combinedSelector) String() string {
+	combinator := " " + string(s.combinator) + " "
+	switch s.combinator {
+	case ' ':
+		combinator = " "
+	case '|':
+		combinator = " || "
+	}
+	return s.first.String() + combinator + s.second.String()
+}
+
+// fingerprintVersion identifies the encoding used by Fingerprint.
+// It must be incremented whenever the canonical form of any selector, or
+// what a selector matches, changes.
+//
+// Version 2 added the options to the encoding, and followed the addition
+// of the column combinator, :nth-col(), :lang() and :dir().
+const fingerprintVersion = 2
+
+// Fingerprint returns a hash of the canonical form of sel. Selectors that
+// differ only in formatting, such as whitespace, quoting, or the case of tag
+// and attribute names, have the same fingerprint. Fingerprints are stable
+// across processes and are intended for caching and deduplication; they are
+// not cryptographic hashes. They change when a new version of this package
+// changes the canonical form or the meaning of selectors.
+func Fingerprint(sel string) (uint64, error) {
+	return FingerprintWithOptions(sel, Options{})
+}
+
+// FingerprintWithOptions is like Fingerprint, but it parses sel with opts,
+// and the options that change what a selector matches are part of the
+// hash: Namespaces, QuirksMode, EmptyIgnoresWhitespace,
+// CaseSensitiveContains, ContainsCollapsesWhitespace, and whether there is
+// a Context with or without a Visited function. The other fields of a
+// Context, such as Fragment, can change after the selector is compiled, so
+// they aren't hashed: the same selector and options always have the same
+// fingerprint. The options that only decide which selectors are accepted,
+// such as Strict, don't affect the fingerprint, since a selector that they
+// accept matches the same elements either way. With the zero Options, the
+// fingerprint is the same as Fingerprint's.
+func FingerprintWithOptions(sel string, opts Options) (uint64, error) {
+	p := &parser{s: sel, opts: opts}
+	compiled, err := p.parse()
+	if err != nil {
+		return 0, err
+	}
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "cascadia fingerprint v%d\x00%s", fingerprintVersion, compiled)
+
+	// Each option is written only if it isn't the default, so adding an
+	// option doesn't change the existing fingerprints.
+	if len(opts.Namespaces) > 0 {
+		prefixes := make([]string, 0, len(opts.Namespaces))
+		for prefix := range opts.Namespaces {
+			prefixes = append(prefixes, prefix)
+		}
+		sort.Strings(prefixes)
+		for _, prefix := range prefixes {
+			fmt.Fprintf(h, "\x00namespace %q %q", prefix, opts.Namespaces[prefix])
+		}
+	}
+	if opts.QuirksMode {
+		fmt.Fprint(h, "\x00quirks")
+	}
+	if opts.EmptyIgnoresWhitespace {
+		fmt.Fprint(h, "\x00empty-ignores-whitespace")
+	}
+	if opts.CaseSensitiveContains {
+		fmt.Fprint(h, "\x00case-sensitive-contains")
+	}
+	if opts.ContainsCollapsesWhitespace {
+		fmt.Fprint(h, "\x00contains-collapses-whitespace")
+	}
+	if ctx := opts.Context; ctx != nil {
+		fmt.Fprintf(h, "\x00context %t", ctx.Visited != nil)
+	}
+	return h.Sum64(), nil
+}
+
+// bareRegex returns whether the regular expression source s can be written
+// unquoted in an attribute selector: parseRegex reads up to the first
+// unmatched ')' or ']', so s must be non-empty and have its brackets
+// balanced.
+func bareRegex(s string) bool {
+	if s == "" || s[0] == '\'' || s[0] == '"' {
+		return false
+	}
+	open := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(', '[':
+			open++
+		case ')', ']':
+			open--
+			if open < 0 {
+				return false
+			}
+		}
+	}
+	return open == 0
+}
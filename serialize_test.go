@@ -0,0 +1,264 @@
+package cascadia
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+var canonicalTests = map[string]string{
+	`DIV.a[ b = 'c' ]`:                 `div.a[b="c"]`,
+	`DIV.Foo[Bar='x']`:                 `div.Foo[bar="x"]`,
+	`UL>LI , Ol  LI+li,p~Span`:         `ul > li, ol li + li, p ~ span`,
+	`*`:                                `*`,
+	`*.a`:                              `.a`,
+	`#\31 23`:                          `#\31 23`,
+	`.foo\:bar`:                        `.foo\:bar`,
+	`[title~="say \"hi\""]`:            `[title~="say \"hi\""]`,
+	`[TYPE=Submit I]`:                  `[type="submit" i]`,
+	`a[href#=(^https?://)]`:            `a[href#=(^https?://)]`,
+	`div:not( .sidebar  * )`:           `div:not(.sidebar *)`,
+	`p:contains-own('a')`:              `p:containsOwn("a")`,
+	`p:not(.a>.b)`:                     `p:not(.a > .b)`,
+	`:not(div>.warning,[hidden])`:      `:not(div > .warning, [hidden])`,
+	`a[href#="^https?://"]`:            `a[href#=^https?://]`,
+	`p[title#='\\)']`:                  `p[title#="\\)"]`,
+	`div   >p+  span ~em a`:            `div > p + span ~ em a`,
+	`h1,h2 ,h3`:                        `h1, h2, h3`,
+	"div\t\n\fp":                       `div p`,
+	"  div\n>\tp\r\n":                  `div > p`,
+	"div>p *":                          `div > p *`,
+	`a:ROOT:Empty`:                     `a:root:empty`,
+	`svg|Circle, |p, *|a, svg|*, *|*`:  `svg|circle, |p, a, svg|*, *`,
+	`[xlink|HREF][*|title][|lang|=en]`: `[xlink|href][title][|lang|="en"]`,
+	`col.x||td, svg|a || |b, *||p`:     `col.x || td, svg|a || |b, * || p`,
+	`td:NTH-COL(2n):nth-last-col(1)`:   `td:nth-col(2n):nth-last-col(1)`,
+	`li:NTH-CHILD(odd):nth-last-of-type( -n + 3 )`: `li:nth-child(2n+1):nth-last-of-type(-n+3)`,
+	`p:nth-child(1):nth-last-child(0n+1)`:          `p:first-child:last-child`,
+	`:not(.a):has(b, c):haschild(d)`:               `:not(.a):has(b, c):haschild(d)`,
+	`div:has(>a.download,+p  b, ~ .x)`:             `div:has(> a.download, + p b, ~ .x)`,
+	`:IS( h1,h2 ) a:where(.x > b)`:                 `:is(h1, h2) a:where(.x > b)`,
+	`:is(p, [=x], , .a)`:                           `:is(p, .a)`,
+	`:contains(Foo):containsOwn("bar")`:            `:contains("foo"):containsOwn("bar")`,
+	`:class-prefix(col-):class-suffix("--x")`:      `:class-prefix("col-"):class-suffix("--x")`,
+	`input:CHECKED, :Disabled, :enabled`:           `input:checked, :disabled, :enabled`,
+
+	`li:nth-child(odd  OF .a,.b):nth-last-child(1 of p)`: `li:nth-child(2n+1 of .a, .b):nth-last-child(1 of p)`,
+}
+
+func TestCanonicalString(t *testing.T) {
+	for source, want := range canonicalTests {
+		p := &parser{s: source}
+		m, err := p.parse()
+		if err != nil {
+			t.Errorf("parsing %q: %s", source, err)
+			continue
+		}
+		if got := m.String(); got != want {
+			t.Errorf("parsing %q: got %q, want %q", source, got, want)
+		}
+
+		p = &parser{s: want}
+		m2, err := p.parse()
+		if err != nil {
+			t.Errorf("reparsing %q: %s", want, err)
+			continue
+		}
+		if got := m2.String(); got != want {
+			t.Errorf("reparsing %q: got %q", want, got)
+		}
+	}
+}
+
+var fingerprintTests = map[string]uint64{
+	`div.a[b="c"]`:           0xc3a1afdd895f59a0,
+	`h1, h2`:                 0xace877b77dc08579,
+	`ul > li:nth-child(odd)`: 0x92ecd54808aa1282,
+}
+
+func TestFingerprint(t *testing.T) {
+	for sel, want := range fingerprintTests {
+		got, err := Fingerprint(sel)
+		if err != nil {
+			t.Errorf("%s: %s", sel, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: got %#x, want %#x", sel, got, want)
+		}
+	}
+
+	for a, b := range map[string]string{
+		`DIV.a[ b = 'c' ]`:      `div.a[b="c"]`,
+		`ul>li:NTH-CHILD(2n+1)`: `ul > li:nth-child(odd)`,
+	} {
+		fa, err := Fingerprint(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fb, err := Fingerprint(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fa != fb {
+			t.Errorf("fingerprints of %q and %q differ", a, b)
+		}
+	}
+
+	for a, b := range map[string]string{
+		`[a=b]`: `[a=b i]`,
+		`a b`:   `a > b`,
+		`.A`:    `.a`,
+	} {
+		fa, _ := Fingerprint(a)
+		fb, _ := Fingerprint(b)
+		if fa == fb {
+			t.Errorf("fingerprints of %q and %q are the same", a, b)
+		}
+	}
+
+	if _, err := Fingerprint(`div[`); err == nil {
+		t.Error("invalid selector: got no error")
+	}
+}
+
+func TestFingerprintWithOptions(t *testing.T) {
+	base, err := url.Parse("https://example.com/a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	visited := func(*url.URL) bool { return false }
+	const sel = `svg|rect#a:empty, :target`
+	options := []Options{
+		{},
+		{Namespaces: map[string]string{"svg": "http://www.w3.org/2000/svg"}},
+		{QuirksMode: true},
+		{EmptyIgnoresWhitespace: true},
+		{Context: &DocumentContext{Fragment: "a"}},
+		{Context: &DocumentContext{Fragment: "a", Visited: visited}},
+		{QuirksMode: true, EmptyIgnoresWhitespace: true},
+		{CaseSensitiveContains: true},
+		{ContainsCollapsesWhitespace: true},
+	}
+	golden := []uint64{
+		0x68f797f7e6cf126a,
+		0x2460b95b490e9682,
+		0xaa7eb26d54bb4d11,
+		0x822d1176f6672e8d,
+		0xc1c767b4e40ec87a,
+		0xf45268f169d7ecf7,
+		0x3d3eb204a6b27280,
+		0xe62283cdf2b9beab,
+		0x8191bf50d6d7ffa8,
+	}
+
+	plain, err := Fingerprint(sel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[uint64]int)
+	for i, opts := range options {
+		got, err := FingerprintWithOptions(sel, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != golden[i] {
+			t.Errorf("options %d: got %#x, want %#x", i, got, golden[i])
+		}
+		if j, ok := seen[got]; ok {
+			t.Errorf("options %d and %d have the same fingerprint", j, i)
+		}
+		seen[got] = i
+	}
+	if got := golden[0]; got != plain {
+		t.Errorf("zero Options: got %#x, want Fingerprint's %#x", got, plain)
+	}
+
+	// Options that don't change what an accepted selector matches don't
+	// change its fingerprint.
+	strict, err := FingerprintWithOptions(sel, Options{Strict: true, MaxIdentifierLength: 10, QuirksCombinators: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strict != plain {
+		t.Errorf("Strict: got %#x, want %#x", strict, plain)
+	}
+
+	// Nor do the fields of a Context that can change after compiling.
+	moved, err := FingerprintWithOptions(sel, Options{Context: &DocumentContext{BaseURL: base, Fragment: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != golden[4] {
+		t.Errorf("Context with another Fragment: got %#x, want %#x", moved, golden[4])
+	}
+}
+
+func TestParse(t *testing.T) {
+	for source, want := range canonicalTests {
+		sel, err := Parse(source)
+		if err != nil {
+			t.Errorf("parsing %q: %s", source, err)
+			continue
+		}
+		if got := sel.String(); got != want {
+			t.Errorf("parsing %q: got %q, want %q", source, got, want)
+		}
+
+		// The canonical form must parse to the same selector.
+		again, err := Parse(want)
+		if err != nil {
+			t.Errorf("parsing canonical form %q: %s", want, err)
+			continue
+		}
+		if got := again.String(); got != want {
+			t.Errorf("canonical form %q doesn't round-trip: got %q", want, got)
+		}
+	}
+
+	if _, err := Parse("div["); err == nil {
+		t.Error(`Parse("div["): got no error`)
+	}
+
+	members, err := ParseGroup("h1 , ul>li, :not(p)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range members {
+		got = append(got, m.String())
+	}
+	if want := "h1|ul > li|:not(p)"; strings.Join(got, "|") != want {
+		t.Errorf("ParseGroup: got %q, want %q", strings.Join(got, "|"), want)
+	}
+}
+
+// TestStringMatchesLikeSource checks that the String form of each selector
+// in selectorTests parses, and matches the same nodes as the source text.
+func TestStringMatchesLikeSource(t *testing.T) {
+	for _, test := range selectorTests {
+		sel, err := Parse(test.Selector)
+		if err != nil {
+			t.Errorf("parsing %q: %s", test.Selector, err)
+			continue
+		}
+		s := sel.String()
+		again, err := Compile(s)
+		if err != nil {
+			t.Errorf("%q: compiling String form %q: %s", test.Selector, s, err)
+			continue
+		}
+
+		doc, err := html.Parse(strings.NewReader(test.HTML))
+		if err != nil {
+			t.Errorf("error parsing %q: %s", test.HTML, err)
+			continue
+		}
+		if got, want := again.MatchAll(doc), MustCompile(test.Selector).MatchAll(doc); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: String form %q matched %d nodes, want %d", test.Selector, s, len(got), len(want))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package cascadia
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// SimilarTo returns a Selector that matches elements that look like ref,
+// such as the other cards in a list where ref is one of the cards.
+//
+// An element is similar to ref if it has the same tag name and the same set
+// of class names. The order of the class names and any duplicates are
+// ignored, so class="card big" is similar to class="big card card", but an
+// element with an extra class or a missing class is not similar. An element
+// without a class attribute is similar to one with an empty class attribute.
+// Other attributes, including id, are ignored.
+//
+// If attrs are given, the elements must also have the same values as ref
+// for those attributes, and must lack the attributes that ref lacks.
+//
+// ref matches its own Selector. If ref is not an element, the Selector
+// never matches.
+func SimilarTo(ref *html.Node, attrs ...string) Selector {
+	if ref == nil || ref.Type != html.ElementNode {
+		return Never
+	}
+
+	tag := ref.Data
+	classes := classSet(attributeValue(ref, "class"))
+
+	type attrValue struct {
+		key     string
+		val     string
+		present bool
+	}
+	want := make([]attrValue, len(attrs))
+	for i, key := range attrs {
+		key = toLowerASCII(key)
+		want[i].key = key
+		for _, a := range ref.Attr {
+			if a.Key == key {
+				want[i].val, want[i].present = a.Val, true
+				break
+			}
+		}
+	}
+
+	return func(n *html.Node) bool {
+		if n.Type != html.ElementNode || n.Data != tag {
+			return false
+		}
+		for _, w := range want {
+			val, present := "", false
+			for _, a := range n.Attr {
+				if a.Key == w.key {
+					val, present = a.Val, true
+					break
+				}
+			}
+			if present != w.present || val != w.val {
+				return false
+			}
+		}
+		return sameClassSet(classes, attributeValue(n, "class"))
+	}
+}
+
+// classSet returns the set of whitespace-separated class names in class.
+func classSet(class string) map[string]bool {
+	set := make(map[string]bool)
+	for _, c := range strings.Fields(class) {
+		set[c] = true
+	}
+	return set
+}
+
+// sameClassSet returns whether class contains exactly the class names in
+// set.
+func sameClassSet(set map[string]bool, class string) bool {
+	found := make(map[string]bool, len(set))
+	missing := anyToken(class, func(c string) bool {
+		if !set[c] {
+			return true
+		}
+		found[c] = true
+		return false
+	})
+	return !missing && len(found) == len(set)
+}
@@ -0,0 +1,50 @@
+package cascadia
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestSimilarTo(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`
+		<div id="ref" class="card big" data-kind="a" title="x"></div>
+		<div id="reordered" class="big  card card" data-kind="a"></div>
+		<div id="extra" class="card big new" data-kind="a"></div>
+		<div id="missing" class="card" data-kind="a"></div>
+		<div id="kind" class="card big" data-kind="b"></div>
+		<section id="tag" class="card big" data-kind="a"></section>
+		<div id="plain"></div>
+		<div id="empty" class=""></div>
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := MustCompile("#ref").MatchFirst(doc)
+	plain := MustCompile("#plain").MatchFirst(doc)
+
+	tests := []struct {
+		ref   *html.Node
+		attrs []string
+		want  []string
+	}{
+		{ref, nil, []string{"ref", "reordered", "kind"}},
+		{ref, []string{"data-kind"}, []string{"ref", "reordered"}},
+		{ref, []string{"DATA-KIND"}, []string{"ref", "reordered"}},
+		{ref, []string{"title"}, []string{"ref"}},
+		{plain, nil, []string{"plain", "empty"}},
+		{plain, []string{"class"}, []string{"plain"}},
+		{doc, nil, nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, n := range SimilarTo(test.ref, test.attrs...).MatchAll(doc) {
+			got = append(got, attributeValue(n, "id"))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SimilarTo(%s, %q): got %q, want %q", attributeValue(test.ref, "id"), test.attrs, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package cascadia
+
+import (
+	"errors"
+)
+
+// A Specificity is the specificity of a selector, as defined by CSS: the
+// number of id selectors, the number of class selectors, attribute
+// selectors and pseudo-classes, and the number of type selectors.
+type Specificity [3]int
+
+// Less returns whether s is less specific than other.
+func (s Specificity) Less(other Specificity) bool {
+	for i := range s {
+		if s[i] != other[i] {
+			return s[i] < other[i]
+		}
+	}
+	return false
+}
+
+// Add returns the sum of s and other.
+func (s Specificity) Add(other Specificity) Specificity {
+	return Specificity{s[0] + other[0], s[1] + other[1], s[2] + other[2]}
+}
+
+// CompileWithSpecificity is like Compile, but it also returns the
+// specificity of the selector. It returns an error if sel is a selector
+// list, since the specificity of a list depends on which member matches;
+// use CompileGroupWithSpecificity for those.
+func CompileWithSpecificity(sel string) (Selector, Specificity, error) {
+	p := &parser{s: sel}
+	m, err := p.parse()
+	if err != nil {
+		return nil, Specificity{}, err
+	}
+	if _, ok := m.(unionSelector); ok {
+		return nil, Specificity{}, errors.New("a selector list has no single specificity")
+	}
+	return compileSel(m), m.Specificity(), nil
+}
+
+// CompileGroupWithSpecificity is like CompileGroup, but it also returns the
+// specificity of each member of the group.
+func CompileGroupWithSpecificity(sel string) (SelectorGroup, []Specificity, error) {
+	members, err := parseGroupMembers(sel)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	group := make(SelectorGroup, len(members))
+	specs := make([]Specificity, len(members))
+	for i, m := range members {
+		group[i] = compileSel(m)
+		specs[i] = m.Specificity()
+	}
+	return group, specs, nil
+}
+
+// The Specificity methods of the Sel types follow Selectors Level 4:
+// :not(), :is() and :has() count as their most specific argument, and
+// :where() counts as nothing. :nth-child(an+b of S) counts as a pseudo-class
+// plus the most specific member of S.
+
+func (idSelector) Specificity() Specificity { return Specificity{1, 0, 0} }
+
+func (tagSelector) Specificity() Specificity { return Specificity{0, 0, 1} }
+
+func (s namespaceTagSelector) Specificity() Specificity {
+	if s.tag == "" {
+		return Specificity{}
+	}
+	return Specificity{0, 0, 1}
+}
+
+func (s compoundSelector) Specificity() Specificity {
+	var result Specificity
+	for _, c := range s {
+		result = result.Add(c.Specificity())
+	}
+	return result
+}
+
+func (s combinedSelector) Specificity() Specificity {
+	return s.first.Specificity().Add(s.second.Specificity())
+}
+
+func (s unionSelector) Specificity() Specificity {
+	var max Specificity
+	for _, c := range s {
+		if spec := c.Specificity(); max.Less(spec) {
+			max = spec
+		}
+	}
+	return max
+}
+
+func (s negatedSelector) Specificity() Specificity { return s.sel.Specificity() }
+
+func (s hasSelector) Specificity() Specificity { return s.sel.Specificity() }
+
+func (s relativeSelector) Specificity() Specificity { return s.sel.Specificity() }
+
+func (s matchesAnySelector) Specificity() Specificity {
+	if s.where {
+		return Specificity{}
+	}
+	return s.sel.Specificity()
+}
+
+func (neverSelector) Specificity() Specificity { return Specificity{} }
+
+func (s nthChildSelector) Specificity() Specificity {
+	if s.of != nil {
+		return Specificity{0, 1, 0}.Add(s.of.Specificity())
+	}
+	return Specificity{0, 1, 0}
+}
+
+// Class and attribute selectors, and the other pseudo-classes.
+
+func (classSelector) Specificity() Specificity        { return Specificity{0, 1, 0} }
+func (attrSelector) Specificity() Specificity         { return Specificity{0, 1, 0} }
+func (classAffixSelector) Specificity() Specificity   { return Specificity{0, 1, 0} }
+func (dynamicSelector) Specificity() Specificity      { return Specificity{0, 1, 0} }
+func (textSubstrSelector) Specificity() Specificity   { return Specificity{0, 1, 0} }
+func (textRegexSelector) Specificity() Specificity    { return Specificity{0, 1, 0} }
+func (onlyChildSelector) Specificity() Specificity    { return Specificity{0, 1, 0} }
+func (nthColSelector) Specificity() Specificity       { return Specificity{0, 1, 0} }
+func (inputSelector) Specificity() Specificity        { return Specificity{0, 1, 0} }
+func (formStateSelector) Specificity() Specificity    { return Specificity{0, 1, 0} }
+func (langSelector) Specificity() Specificity         { return Specificity{0, 1, 0} }
+func (linkSelector) Specificity() Specificity         { return Specificity{0, 1, 0} }
+func (dirSelector) Specificity() Specificity          { return Specificity{0, 1, 0} }
+func (emptyElementSelector) Specificity() Specificity { return Specificity{0, 1, 0} }
+func (scopeSelector) Specificity() Specificity        { return Specificity{0, 1, 0} }
+func (rootSelector) Specificity() Specificity         { return Specificity{0, 1, 0} }
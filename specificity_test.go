@@ -0,0 +1,91 @@
+package cascadia
+
+import (
+	"testing"
+)
+
+var specificityTests = map[string]Specificity{
+	"*":                     {0, 0, 0},
+	"li":                    {0, 0, 1},
+	"ul li":                 {0, 0, 2},
+	"ul ol+li":              {0, 0, 3},
+	"h1 + *[rel=up]":        {0, 1, 1},
+	"ul ol li.red":          {0, 1, 3},
+	"li.red.level":          {0, 2, 1},
+	"#x34y":                 {1, 0, 0},
+	"#s12:not(FOO)":         {1, 0, 1},
+	"div:not(.a #b)":        {1, 1, 1},
+	"a:has(img, span.x)":    {0, 1, 2},
+	"a:has(#i, span.x)":     {1, 0, 1},
+	":nth-child(2n+1)":      {0, 1, 0},
+	":root > body p:empty":  {0, 2, 2},
+	":contains(\"x\")":      {0, 1, 0},
+	"[href#=(^https)] span": {0, 1, 1},
+	":is(h1, #t, .x) a":     {1, 0, 1},
+	":where(h1, #t, .x) a":  {0, 0, 1},
+	"p:is()":                {0, 0, 1},
+
+	":nth-child(2n of #a, p)": {1, 1, 0},
+}
+
+func TestSpecificity(t *testing.T) {
+	for sel, want := range specificityTests {
+		_, got, err := CompileWithSpecificity(sel)
+		if err != nil {
+			t.Errorf("%s: %s", sel, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: got %v, want %v", sel, got, want)
+		}
+
+		m, err := Parse(sel)
+		if err != nil {
+			t.Errorf("%s: %s", sel, err)
+			continue
+		}
+		if got := m.Specificity(); got != want {
+			t.Errorf("%s: Sel.Specificity: got %v, want %v", sel, got, want)
+		}
+	}
+
+	// A list counts as its most specific member.
+	m, err := Parse("a.b, #c, p q r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Specificity(), (Specificity{1, 0, 0}); got != want {
+		t.Errorf("list: got %v, want %v", got, want)
+	}
+}
+
+func TestSpecificityLess(t *testing.T) {
+	_, id, _ := CompileWithSpecificity("#id")
+	_, classes, _ := CompileWithSpecificity(".a.b.c")
+	if !classes.Less(id) || id.Less(classes) {
+		t.Errorf("#id %v should beat .a.b.c %v", id, classes)
+	}
+	if id.Less(id) {
+		t.Error("a specificity should not be less than itself")
+	}
+}
+
+func TestCompileGroupWithSpecificity(t *testing.T) {
+	group, specs, err := CompileGroupWithSpecificity("p, #a.b, ul > li")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(group) != 3 {
+		t.Fatalf("got %d members, want 3", len(group))
+	}
+	want := []Specificity{{0, 0, 1}, {1, 1, 0}, {0, 0, 2}}
+	for i := range want {
+		if specs[i] != want[i] {
+			t.Errorf("member %d: got %v, want %v", i, specs[i], want[i])
+		}
+	}
+
+	if _, _, err := CompileWithSpecificity("p, #a"); err == nil {
+		t.Error("CompileWithSpecificity accepted a selector list")
+	}
+}
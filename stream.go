@@ -0,0 +1,200 @@
+package cascadia
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/net/html"
+)
+
+// A StreamSelector is a selector that is matched against a stream of tokens
+// from an html.Tokenizer, without building the document tree. Only the
+// elements that are open at the current token are kept, so memory use
+// depends on how deeply the document is nested rather than on its size.
+//
+// An element is matched as soon as its start tag is read, so a
+// StreamSelector can only use selectors that look at an element, its
+// attributes and its ancestors. Selectors that need an element's content
+// (:has(), :contains(), :empty, :nth-last-child() and so on) or its earlier
+// siblings (the + and ~ combinators, :first-child, :nth-child() and so on)
+// are rejected by CompileStream, as are namespace prefixes, since tokens
+// don't carry namespaces.
+type StreamSelector struct {
+	sel Sel
+}
+
+// CompileStream compiles a selector group for matching against a token
+// stream. It returns an error if the selector is invalid, or uses a feature
+// that a StreamSelector can't support.
+func CompileStream(sel string) (*StreamSelector, error) {
+	p := &parser{s: sel}
+	compiled, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if bad, why := unstreamable(compiled); bad != nil {
+		return nil, fmt.Errorf("selector %q can't be matched on a token stream: %s %s", sel, bad, why)
+	}
+	return &StreamSelector{compiled}, nil
+}
+
+// unstreamable returns the first part of m that can't be matched when only
+// an element's start tag and ancestors are known, along with the reason, or
+// nil if there is none.
+func unstreamable(m Sel) (bad Sel, why string) {
+	switch m := m.(type) {
+	case compoundSelector:
+		for _, c := range m {
+			if bad, why := unstreamable(c); bad != nil {
+				return bad, why
+			}
+		}
+	case unionSelector:
+		for _, c := range m {
+			if bad, why := unstreamable(c); bad != nil {
+				return bad, why
+			}
+		}
+	case negatedSelector:
+		return unstreamable(m.sel)
+	case matchesAnySelector:
+		return unstreamable(m.sel)
+	case combinedSelector:
+		if m.combinator == '+' || m.combinator == '~' {
+			return m, "needs earlier siblings"
+		}
+		if m.combinator == '|' {
+			return m, "needs the table's layout"
+		}
+		if bad, why := unstreamable(m.first); bad != nil {
+			return bad, why
+		}
+		return unstreamable(m.second)
+	case attrSelector:
+		if m.namespace != nil {
+			return m, "needs attribute namespaces"
+		}
+	case namespaceTagSelector:
+		return m, "needs element namespaces"
+	case nthChildSelector:
+		if m.last {
+			return m, "needs the element's later siblings"
+		}
+		return m, "needs earlier siblings"
+	case nthColSelector:
+		return m, "needs the table's layout"
+	case onlyChildSelector:
+		return m, "needs the element's later siblings"
+	case dirSelector:
+		return m, "needs the text of elements with dir=auto"
+	case hasSelector, textSubstrSelector, textRegexSelector, emptyElementSelector:
+		return m, "needs the element's content"
+	}
+	return nil, ""
+}
+
+// voidElements lists the elements that never have content, and so have no
+// end tag.
+var voidElements = map[string]bool{
+	"area":   true,
+	"base":   true,
+	"br":     true,
+	"col":    true,
+	"embed":  true,
+	"hr":     true,
+	"img":    true,
+	"input":  true,
+	"keygen": true,
+	"link":   true,
+	"meta":   true,
+	"param":  true,
+	"source": true,
+	"track":  true,
+	"wbr":    true,
+}
+
+// Each reads tokens from z until the end of its input, and calls fn for
+// each start tag whose element matches the selector. The element is passed
+// as an html.Node with the tag's name and attributes; its Parent links lead
+// through the elements that are open at that point to a document node, but
+// it has no children or siblings, except that a fieldset's first legend is
+// its FirstChild, as :disabled needs. If fn returns false, Each stops
+// reading.
+//
+// Each returns the tokenizer's error, if it stops for a reason other than
+// reaching the end of the input.
+//
+// The open elements are tracked from the tags as written, without HTML's
+// tree construction rules: an end tag closes the innermost open element with
+// its name, and the elements inside it, but an end tag that was left out,
+// as HTML allows for p and li, leaves its element open. Void elements like
+// br and img never have children, and neither do self-closing tags in svg
+// and math.
+func (s *StreamSelector) Each(z *html.Tokenizer, fn func(*html.Node) bool) error {
+	doc := &html.Node{Type: html.DocumentNode}
+	parent := doc
+	for {
+		switch tt := z.Next(); tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return err
+			}
+			return nil
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			n := &html.Node{
+				Type:      html.ElementNode,
+				DataAtom:  t.DataAtom,
+				Data:      t.Data,
+				Namespace: childNamespace(parent, t.Data),
+				Attr:      t.Attr,
+				Parent:    parent,
+			}
+			if n.Data == "legend" && parent.Data == "fieldset" && parent.Namespace == "" && parent.FirstChild == nil {
+				// A disabled fieldset doesn't disable the controls in its
+				// first legend.
+				parent.FirstChild, parent.LastChild = n, n
+			}
+			if s.sel.Match(n) && !fn(n) {
+				return nil
+			}
+			if voidElements[n.Data] && n.Namespace == "" || tt == html.SelfClosingTagToken && n.Namespace != "" {
+				continue
+			}
+			parent = n
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			for p := parent; p != doc; p = p.Parent {
+				if p.Data == string(name) {
+					parent = p.Parent
+					break
+				}
+			}
+		}
+	}
+}
+
+// childNamespace returns the namespace of an element named name whose
+// parent is parent, following the rules for where svg and math content
+// starts and ends.
+func childNamespace(parent *html.Node, name string) string {
+	switch name {
+	case "svg", "math":
+		return name
+	}
+	switch parent.Namespace {
+	case "svg":
+		switch parent.Data {
+		case "foreignobject", "desc", "title":
+			return ""
+		}
+	case "math":
+		switch parent.Data {
+		case "mi", "mo", "mn", "ms", "mtext":
+			return ""
+		}
+	}
+	return parent.Namespace
+}
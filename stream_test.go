@@ -0,0 +1,113 @@
+package cascadia
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestStreamSelector(t *testing.T) {
+	const doc = `<!DOCTYPE html><html id="0"><body>
+		<div id="1" class="a"><p id="2">x<br id="3"><span id="4" class="a"><img id="5"></span></p></div>
+		<ul id="6"><li id="7"><a id="8" href="/x">x</a></li><li id="9"><a id="10">y</a></li></ul>
+		<svg id="11"><circle id="12"/><foreignObject id="13"><div id="14"/></foreignObject></svg>
+		<div id="15"/><p id="16"></p>
+		<form><fieldset disabled><input id="17"></fieldset><input id="18" checked></form>
+		<fieldset disabled><legend><input id="19"></legend><legend><input id="20"></legend></fieldset>
+	</body></html>`
+
+	for sel, want := range map[string]string{
+		`div`:                 "1 14 15",
+		`.a`:                  "1 4",
+		`div > p, p span`:     "2 4 16",
+		`p > *`:               "3 4",
+		`span img`:            "5",
+		`ul a[href]`:          "8",
+		`li:not(:is(#7)) > a`: "10",
+		`svg > circle`:        "12",
+		`svg *`:               "12 13 14",
+		`div p`:               "2 16",
+		`:root`:               "0",
+		`input:disabled`:      "17 20",
+		`input:enabled`:       "18 19",
+		`:checked`:            "18",
+		`nav`:                 "",
+	} {
+		s, err := CompileStream(sel)
+		if err != nil {
+			t.Errorf("%s: %s", sel, err)
+			continue
+		}
+		var ids []string
+		err = s.Each(html.NewTokenizer(strings.NewReader(doc)), func(n *html.Node) bool {
+			ids = append(ids, attributeValue(n, "id"))
+			return true
+		})
+		if err != nil {
+			t.Errorf("%s: %s", sel, err)
+		}
+		if got := strings.Join(ids, " "); got != want {
+			t.Errorf("%s: got %q, want %q", sel, got, want)
+		}
+	}
+}
+
+func TestStreamSelectorStop(t *testing.T) {
+	s, err := CompileStream("li")
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := html.NewTokenizer(strings.NewReader(`<ul><li>a</li><li>b</li><li>c</li></ul>`))
+	count := 0
+	if err := s.Each(z, func(*html.Node) bool {
+		count++
+		return count < 2
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("got %d calls, want 2", count)
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("read failed") }
+
+func TestStreamSelectorReadError(t *testing.T) {
+	s, err := CompileStream("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Each(html.NewTokenizer(errReader{}), func(*html.Node) bool { return true })
+	if err == nil || err.Error() != "read failed" {
+		t.Errorf("got error %v, want read failed", err)
+	}
+}
+
+func TestUnstreamableSelectors(t *testing.T) {
+	for sel, why := range map[string]string{
+		`h1 + p`:               "h1 + p needs earlier siblings",
+		`div:not(h1 ~ p)`:      "h1 ~ p needs earlier siblings",
+		`li:first-child`:       ":first-child needs earlier siblings",
+		`li:nth-last-child(2)`: ":nth-last-child(2) needs the element's later siblings",
+		`li:only-child`:        ":only-child needs the element's later siblings",
+		`div:has(p)`:           ":has(p) needs the element's content",
+		`p:contains("x")`:      `:contains("x") needs the element's content`,
+		`p, div:empty`:         ":empty needs the element's content",
+		`p:dir(rtl)`:           ":dir(rtl) needs the text of elements with dir=auto",
+		`p:is(a, svg|circle)`:  "svg|circle needs element namespaces",
+		`a[xlink|href]`:        "[xlink|href] needs attribute namespaces",
+	} {
+		_, err := CompileStream(sel)
+		if err == nil || !strings.HasSuffix(err.Error(), ": "+why) {
+			t.Errorf("%s: got error %v, want one ending with %q", sel, err, why)
+		}
+	}
+
+	if _, err := CompileStream("p["); err == nil {
+		t.Error("invalid selector: got no error")
+	}
+}
@@ -0,0 +1,261 @@
+package cascadia
+
+import "strings"
+
+// A Rule is a style rule from a stylesheet, as returned by
+// CompileStylesheet.
+type Rule struct {
+	// Selector is the rule's selector list, as written in the stylesheet
+	// but without leading and trailing whitespace, and Offset is its byte
+	// offset in the stylesheet.
+	Selector string
+	Offset   int
+
+	// Group holds the compiled members of the selector list. It is nil if
+	// the selector list failed to compile, in which case Err holds the
+	// error.
+	Group SelectorGroup
+	Err   error
+
+	// Declarations is the text between the rule's braces, without leading
+	// and trailing whitespace. It is not parsed.
+	Declarations string
+
+	// Conditions lists the preludes of the conditional group rules that
+	// contain the rule, outermost first, such as "@media print".
+	Conditions []string
+}
+
+// CompileStylesheet splits a CSS stylesheet into its style rules, and
+// compiles each rule's selector list. The rules are returned in source
+// order; a rule whose selector list doesn't compile is returned with its Err
+// field set, so that one bad selector doesn't lose the rest of the
+// stylesheet.
+//
+// Rules inside @media, @supports, @document and @layer blocks are included,
+// with the blocks recorded in their Conditions. Other at-rules, such as
+// @import, @font-face and @keyframes, are skipped. Comments are ignored.
+//
+// CompileStylesheet only returns an error if the stylesheet's structure is
+// broken: an unclosed block, string or comment, or an unmatched '}'.
+func CompileStylesheet(css string) ([]Rule, error) {
+	s := &stylesheetScanner{css: css}
+	rules, err := s.rules(nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.i < len(css) {
+		return nil, s.errorf("unmatched '}'")
+	}
+	return rules, nil
+}
+
+// A stylesheetScanner splits a stylesheet into rules.
+type stylesheetScanner struct {
+	css string
+	i   int
+}
+
+func (s *stylesheetScanner) errorf(msg string) error {
+	return &SyntaxError{Input: s.css, Offset: s.i, Msg: msg}
+}
+
+// rules reads rules up to the end of the stylesheet or an unmatched '}',
+// which is not consumed.
+func (s *stylesheetScanner) rules(conditions []string) ([]Rule, error) {
+	var rules []Rule
+	for {
+		start, end, err := s.prelude()
+		if err != nil {
+			return nil, err
+		}
+		prelude := strings.TrimSpace(stripComments(s.css[start:end]))
+		if s.i >= len(s.css) || s.css[s.i] == '}' {
+			if prelude != "" {
+				return nil, s.errorf("expected '{' after " + prelude)
+			}
+			return rules, nil
+		}
+		if s.css[s.i] == ';' {
+			// A statement at-rule, like @import.
+			s.i++
+			continue
+		}
+
+		// s.css[s.i] is '{'.
+		brace := s.i
+		s.i++
+		if strings.HasPrefix(prelude, "@") {
+			switch name := atRuleName(prelude); name {
+			case "media", "supports", "document", "layer":
+				inner, err := s.rules(append(conditions[:len(conditions):len(conditions)], prelude))
+				if err != nil {
+					return nil, err
+				}
+				rules = append(rules, inner...)
+				if s.i >= len(s.css) {
+					s.i = brace
+					return nil, s.errorf("unclosed @" + name + " block")
+				}
+				s.i++
+				continue
+			}
+			if _, err := s.block(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		body, err := s.block()
+		if err != nil {
+			return nil, err
+		}
+		sel := strings.TrimSpace(s.css[start:end])
+		r := Rule{
+			Selector:     sel,
+			Offset:       start,
+			Declarations: strings.TrimSpace(body),
+			Conditions:   conditions,
+		}
+		r.Group, r.Err = CompileGroup(sel)
+		rules = append(rules, r)
+	}
+}
+
+// prelude skips whitespace and comments, then reads up to the next '{', ';'
+// or '}' outside strings and brackets, and returns the start and end of what
+// it read.
+func (s *stylesheetScanner) prelude() (start, end int, err error) {
+	for s.i < len(s.css) {
+		if c := s.css[s.i]; c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' {
+			s.i++
+		} else if strings.HasPrefix(s.css[s.i:], "/*") {
+			if err := s.skipComment(); err != nil {
+				return 0, 0, err
+			}
+		} else {
+			break
+		}
+	}
+
+	start = s.i
+	depth := 0
+	for s.i < len(s.css) {
+		switch c := s.css[s.i]; c {
+		case '{', ';', '}':
+			if depth == 0 {
+				return start, s.i, nil
+			}
+			s.i++
+		case '(', '[':
+			depth++
+			s.i++
+		case ')', ']':
+			depth--
+			s.i++
+		default:
+			if err := s.skipToken(); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	return start, s.i, nil
+}
+
+// block reads the contents of a block whose opening brace has been consumed,
+// and the closing brace.
+func (s *stylesheetScanner) block() (string, error) {
+	start := s.i
+	depth := 1
+	for s.i < len(s.css) {
+		switch s.css[s.i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				s.i++
+				return s.css[start : s.i-1], nil
+			}
+		default:
+			if err := s.skipToken(); err != nil {
+				return "", err
+			}
+			continue
+		}
+		s.i++
+	}
+	s.i = start - 1
+	return "", s.errorf("unclosed block")
+}
+
+// skipToken skips a string, a comment, an escape sequence or a single byte.
+func (s *stylesheetScanner) skipToken() error {
+	switch c := s.css[s.i]; {
+	case c == '"' || c == '\'':
+		start := s.i
+		for s.i++; s.i < len(s.css) && s.css[s.i] != c; s.i++ {
+			if s.css[s.i] == '\\' {
+				s.i++
+			}
+		}
+		if s.i >= len(s.css) {
+			s.i = start
+			return s.errorf("unclosed string")
+		}
+		s.i++
+	case c == '\\':
+		s.i += 2
+		if s.i > len(s.css) {
+			s.i = len(s.css)
+		}
+	case strings.HasPrefix(s.css[s.i:], "/*"):
+		return s.skipComment()
+	default:
+		s.i++
+	}
+	return nil
+}
+
+// skipComment skips the comment at s.i.
+func (s *stylesheetScanner) skipComment() error {
+	end := strings.Index(s.css[s.i+2:], "*/")
+	if end == -1 {
+		return s.errorf("unclosed comment")
+	}
+	s.i += end + 4
+	return nil
+}
+
+// atRuleName returns the lowercase name of the at-rule whose prelude is
+// prelude.
+func atRuleName(prelude string) string {
+	name := prelude[1:]
+	if i := strings.IndexAny(name, " \t\r\n\f(\"'"); i != -1 {
+		name = name[:i]
+	}
+	return toLowerASCII(name)
+}
+
+// stripComments removes CSS comments from s, which must not contain
+// unclosed ones or unclosed strings. Strings are left as they are, so a
+// "/*" inside one doesn't start a comment.
+func stripComments(s string) string {
+	var b strings.Builder
+	sc := &stylesheetScanner{css: s}
+	for sc.i < len(s) {
+		start := sc.i
+		if strings.HasPrefix(s[sc.i:], "/*") {
+			if sc.skipComment() != nil {
+				return s
+			}
+			b.WriteByte(' ')
+			continue
+		}
+		if sc.skipToken() != nil {
+			return s
+		}
+		b.WriteString(s[start:sc.i])
+	}
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package cascadia
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestCompileStylesheet(t *testing.T) {
+	css := `
+		@charset "utf-8";
+		@import url("a.css") screen;
+		/* a comment { with braces } */
+		h1, h2 { color: red; }
+		a[title="}{"] /* c */ {
+			content: "}";
+			background: url(data:image/png;base64,xyz);
+		}
+		p:bogus { margin: 0 }
+		@media (max-width: 600px) {
+			@supports (display: grid) {
+				.grid { display: grid }
+			}
+			.wide{}
+		}
+		@font-face { font-family: X; src: url(x.woff) }
+		@keyframes spin { from { top: 0 } to { top: 1px } }
+		li:nth-child(2n+1) { x: y }
+	`
+	rules, err := CompileStylesheet(css)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type summary struct {
+		Selector, Declarations string
+		Members                int
+		Failed                 bool
+		Conditions             []string
+	}
+	want := []summary{
+		{"h1, h2", "color: red;", 2, false, nil},
+		{`a[title="}{"] /* c */`, "content: \"}\";\n\t\t\tbackground: url(data:image/png;base64,xyz);", 1, false, nil},
+		{"p:bogus", "margin: 0", 0, true, nil},
+		{".grid", "display: grid", 1, false, []string{"@media (max-width: 600px)", "@supports (display: grid)"}},
+		{".wide", "", 1, false, []string{"@media (max-width: 600px)"}},
+		{"li:nth-child(2n+1)", "x: y", 1, false, nil},
+	}
+	var got []summary
+	for _, r := range rules {
+		got = append(got, summary{r.Selector, r.Declarations, len(r.Group), r.Err != nil, r.Conditions})
+		if css[r.Offset:r.Offset+len(r.Selector)] != r.Selector {
+			t.Errorf("%s: wrong offset %d", r.Selector, r.Offset)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	doc, err := html.Parse(strings.NewReader(`<h2>x</h2><a title="}{">y</a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := rules[1].Group.MatchAll(doc); len(m) != 1 || m[0].Data != "a" {
+		t.Errorf("the a[title] rule matched %d nodes", len(m))
+	}
+	if _, ok := rules[2].Err.(*SyntaxError); !ok {
+		t.Errorf("got error %v, want a *SyntaxError", rules[2].Err)
+	}
+}
+
+func TestCompileStylesheetCommentsInStrings(t *testing.T) {
+	css := `
+		a[title="/*"] {}
+		@supports selector(a[title="/*"]) /* x */ and selector(b[title='*\'/']) {
+			b { color: red }
+		}
+		p[title="*/"] {}
+	`
+	rules, err := CompileStylesheet(css)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range rules {
+		got = append(got, strings.Join(append(r.Conditions, r.Selector), " | "))
+	}
+	want := []string{
+		`a[title="/*"]`,
+		`@supports selector(a[title="/*"])   and selector(b[title='*\'/']) | b`,
+		`p[title="*/"]`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestCompileStylesheetErrors(t *testing.T) {
+	tests := map[string]int{
+		"a { color: red":       2,
+		"a { color: red } }":   17,
+		"@media print { a {} ": 13,
+		`a { content: "x }`:    13,
+		"a { } /* unclosed":    6,
+		"a { } b":              7,
+	}
+	for css, offset := range tests {
+		_, err := CompileStylesheet(css)
+		se, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("%q: got error %v, want a *SyntaxError", css, err)
+			continue
+		}
+		if se.Offset != offset {
+			t.Errorf("%q: got error %q at offset %d, want offset %d", css, se.Msg, se.Offset, offset)
+		}
+	}
+}
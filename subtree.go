@@ -0,0 +1,83 @@
+package cascadia
+
+import "golang.org/x/net/html"
+
+// MatchTree returns a pruned copy of the tree rooted at root, containing the
+// nodes that match the selector and their ancestors up to root, and nothing
+// else. Each match is copied with all of its descendants, whether or not
+// they match; each ancestor is copied with its attributes but only the
+// children that lead to matches. The nodes keep their document order. If no
+// node matches, MatchTree returns nil.
+//
+// The result shares no nodes with the original tree, so either can be
+// modified without affecting the other. Attribute slices are copied too.
+func (s Selector) MatchTree(root *html.Node) *html.Node {
+	matches := s.MatchAll(root)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	matched := make(map[*html.Node]bool, len(matches))
+	clones := make(map[*html.Node]*html.Node)
+	for _, m := range matches {
+		matched[m] = true
+		if hasMatchedAncestor(m, root, matched) {
+			// It was copied along with the ancestor.
+			continue
+		}
+
+		child := cloneTree(m)
+		clones[m] = child
+		for n := m; n != root; n = n.Parent {
+			parent, ok := clones[n.Parent]
+			if !ok {
+				parent = cloneNode(n.Parent)
+				clones[n.Parent] = parent
+			}
+			parent.AppendChild(child)
+			if ok {
+				break
+			}
+			child = parent
+		}
+	}
+	return clones[root]
+}
+
+// hasMatchedAncestor returns whether any ancestor of n, up to and including
+// root, is in matched.
+func hasMatchedAncestor(n, root *html.Node, matched map[*html.Node]bool) bool {
+	for n != root {
+		n = n.Parent
+		if matched[n] {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneNode returns a copy of n without its children or links to other
+// nodes.
+func cloneNode(n *html.Node) *html.Node {
+	return &html.Node{
+		Type:      n.Type,
+		DataAtom:  n.DataAtom,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+		Attr:      append([]html.Attribute(nil), n.Attr...),
+	}
+}
+
+// cloneTree returns a copy of n and its descendants. It walks the tree in
+// document order instead of recursing, so deeply nested trees don't need a
+// deep stack; each node's copy is appended to the copy of its parent.
+func cloneTree(n *html.Node) *html.Node {
+	root := cloneNode(n)
+	clones := map[*html.Node]*html.Node{n: root}
+	for c := n.FirstChild; c != nil; c = nextInSubtree(c, n) {
+		clone := cloneNode(c)
+		clones[c] = clone
+		clones[c.Parent].AppendChild(clone)
+	}
+	return root
+}
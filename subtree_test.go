@@ -0,0 +1,52 @@
+package cascadia
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestMatchTree(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div id="a"><p>one <b>x</b></p><ul><li class="hit">1</li><li>2</li><li class="hit">3 <i class="hit">!</i></li></ul></div><div id="b"><span class="hit">s</span></div><div id="c">skip</div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := MustCompile("body").MatchFirst(doc)
+
+	tests := []struct {
+		sel  string
+		root *html.Node
+		want string
+	}{
+		{".hit", body, `<body><div id="a"><ul><li class="hit">1</li><li class="hit">3 <i class="hit">!</i></li></ul></div><div id="b"><span class="hit">s</span></div></body>`},
+		{"b", body, `<body><div id="a"><p><b>x</b></p></div></body>`},
+		{"#b", body, `<body><div id="b"><span class="hit">s</span></div></body>`},
+		{"body", body, `<body><div id="a"><p>one <b>x</b></p><ul><li class="hit">1</li><li>2</li><li class="hit">3 <i class="hit">!</i></li></ul></div><div id="b"><span class="hit">s</span></div><div id="c">skip</div></body>`},
+		{"table", body, ``},
+	}
+	for _, test := range tests {
+		tree := MustCompile(test.sel).MatchTree(test.root)
+		var b bytes.Buffer
+		if tree != nil {
+			if err := html.Render(&b, tree); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := b.String(); got != test.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.sel, got, test.want)
+		}
+	}
+
+	// The copy doesn't share nodes or attributes with the original.
+	tree := MustCompile("#b").MatchTree(body)
+	span := tree.FirstChild.FirstChild
+	span.Attr[0].Val = "changed"
+	if got := MustCompile("span").MatchFirst(doc); attributeValue(got, "class") != "hit" {
+		t.Error("modifying the copy changed the original")
+	}
+	if tree.Parent != nil || tree.NextSibling != nil {
+		t.Error("the copy of root is linked to other nodes")
+	}
+}
@@ -0,0 +1,280 @@
+package cascadia
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// the HTML table model, for the column combinator and :nth-col()
+
+// Columns are numbered from zero here. A range of columns [first, end) is
+// the ones a cell or column element covers, from its colspan or span.
+
+// isCell returns whether n is a table cell: a td or th element in a tr.
+func isCell(n *html.Node) bool {
+	return n.Type == html.ElementNode && (n.Data == "td" || n.Data == "th") && n.Namespace == "" &&
+		n.Parent != nil && n.Parent.Type == html.ElementNode && n.Parent.Data == "tr"
+}
+
+// cellTable returns the table that contains the cell n, or nil if its row
+// isn't in one, either directly or in a thead, tbody or tfoot.
+func cellTable(n *html.Node) *html.Node {
+	group := n.Parent.Parent
+	if group == nil || group.Type != html.ElementNode {
+		return nil
+	}
+	switch group.Data {
+	case "table":
+		return group
+	case "thead", "tbody", "tfoot":
+		if t := group.Parent; t != nil && t.Type == html.ElementNode && t.Data == "table" {
+			return t
+		}
+	}
+	return nil
+}
+
+// cellColumns returns the columns that the cell n covers. The cells before
+// it in its row, and the ones in earlier rows of its row group with a
+// rowspan, determine where it starts.
+func cellColumns(n *html.Node) (first, end int) {
+	budget := maxTableSlots
+	layoutRows(n.Parent.Parent, &budget, func(cell *html.Node, f, e int) bool {
+		if cell == n {
+			first, end = f, e
+			return false
+		}
+		return true
+	})
+	return first, end
+}
+
+// cellColumnsAndWidth returns cellColumns(n) and tableWidth(table), where
+// table is the table that contains n, laying out each row group once.
+func cellColumnsAndWidth(n, table *html.Node) (first, end, width int) {
+	budget := maxTableSlots
+	found := func(cell *html.Node, f, e int) bool {
+		if cell == n {
+			first, end = f, e
+		}
+		return true
+	}
+	width = layoutColumns(table, func(*html.Node, int, int) bool { return true })
+	for _, g := range rowGroups(table) {
+		if w := layoutRows(g, &budget, found); w > width {
+			width = w
+		}
+	}
+	return first, end, width
+}
+
+// maxTableSlots limits the work of laying out the rows of a table to test
+// one cell, as the number of slots (rows times columns) examined. A colspan
+// or rowspan can make a few cells cover a huge area, and the layout is
+// worked out again for each cell that is tested, so hostile HTML could
+// otherwise make matching take a very long time.
+const maxTableSlots = 1 << 16
+
+// layoutRows places the cells of the rows that are children of group (a
+// row group or a table) in columns, and calls fn with each cell and the
+// columns it covers, in document order, until fn returns false. It returns
+// the number of columns the rows take up. Each slot examined is taken from
+// *budget; when it runs out, the layout stops there, and the remaining
+// cells are in no column.
+func layoutRows(group *html.Node, budget *int, fn func(cell *html.Node, first, end int) bool) (width int) {
+	rows := 0
+	for c := group.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "tr" {
+			rows++
+		}
+	}
+
+	// busy holds, for each column, the number of rows starting with the
+	// current one that are taken by a cell from an earlier row.
+	var busy []int
+	y := 0
+	for row := group.FirstChild; row != nil; row = row.NextSibling {
+		if row.Type != html.ElementNode || row.Data != "tr" {
+			continue
+		}
+		x := 0
+		for c := row.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || c.Data != "td" && c.Data != "th" {
+				continue
+			}
+			for x < len(busy) && busy[x] > 0 {
+				x++
+			}
+			colspan := spanAttr(c, "colspan", 1, 1000)
+			rowspan := spanAttr(c, "rowspan", 0, 65534)
+			if rowspan == 0 || y+rowspan > rows {
+				// A rowspan of zero extends the cell to the end of its
+				// row group, and none extends past it.
+				rowspan = rows - y
+			}
+			if *budget -= colspan; *budget < 0 {
+				return width
+			}
+			for len(busy) < x+colspan {
+				busy = append(busy, 0)
+			}
+			for dx := x; dx < x+colspan; dx++ {
+				if busy[dx] < rowspan {
+					busy[dx] = rowspan
+				}
+			}
+			if !fn(c, x, x+colspan) {
+				return width
+			}
+			x += colspan
+			if x > width {
+				width = x
+			}
+		}
+
+		if *budget -= len(busy); *budget < 0 {
+			return width
+		}
+		for i := range busy {
+			if busy[i] > 0 {
+				busy[i]--
+			}
+		}
+		y++
+	}
+	return width
+}
+
+// layoutColumns calls fn with each col and colgroup element of table and
+// the columns it covers, in document order, until fn returns false. It
+// returns the number of columns they take up.
+func layoutColumns(table *html.Node, fn func(col *html.Node, first, end int) bool) (width int) {
+	for g := table.FirstChild; g != nil; g = g.NextSibling {
+		if g.Type != html.ElementNode || g.Data != "colgroup" {
+			continue
+		}
+		start, hasCols := width, false
+		for c := g.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || c.Data != "col" {
+				continue
+			}
+			hasCols = true
+			span := spanAttr(c, "span", 1, 1000)
+			if !fn(c, width, width+span) {
+				return width
+			}
+			width += span
+		}
+		if !hasCols {
+			width += spanAttr(g, "span", 1, 1000)
+		}
+		if !fn(g, start, width) {
+			return width
+		}
+	}
+	return width
+}
+
+// tableWidth returns the number of columns in table: the most that its
+// column elements or any of its rows take up.
+func tableWidth(table *html.Node) int {
+	budget := maxTableSlots
+	all := func(*html.Node, int, int) bool { return true }
+	width := layoutColumns(table, all)
+	for _, g := range rowGroups(table) {
+		if w := layoutRows(g, &budget, all); w > width {
+			width = w
+		}
+	}
+	return width
+}
+
+// rowGroups returns the nodes whose tr children are rows of table: table
+// itself, and its thead, tbody and tfoot children.
+func rowGroups(table *html.Node) []*html.Node {
+	groups := []*html.Node{table}
+	for g := table.FirstChild; g != nil; g = g.NextSibling {
+		if g.Type == html.ElementNode && (g.Data == "thead" || g.Data == "tbody" || g.Data == "tfoot") {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// spanAttr returns the value of a colspan, rowspan or span attribute of n,
+// parsed as in HTML: leading digits, clamped to max. A missing or invalid
+// value gives 1, as does one below min.
+func spanAttr(n *html.Node, key string, min, max int) int {
+	val := strings.TrimLeft(attributeValue(n, key), " \t\r\n\f")
+	i := 0
+	for i < len(val) && '0' <= val[i] && val[i] <= '9' {
+		i++
+	}
+	v, err := strconv.Atoi(val[:i])
+	switch {
+	case err != nil && i > 0:
+		// Too many digits to fit in an int.
+		return max
+	case err != nil || v < min:
+		return 1
+	case v > max:
+		return max
+	}
+	return v
+}
+
+// columnMatch returns whether the cell n is in a column covered by a column
+// element of its table that matches col, as in the column combinator
+// "col || cell".
+func columnMatch(col func(*html.Node) bool, n *html.Node) bool {
+	if !isCell(n) {
+		return false
+	}
+	table := cellTable(n)
+	if table == nil {
+		return false
+	}
+	first, end := cellColumns(n)
+	found := false
+	layoutColumns(table, func(c *html.Node, f, e int) bool {
+		found = f < end && first < e && col(c)
+		return !found
+	})
+	return found
+}
+
+// nthColSelector implements :nth-col(an+b), or :nth-last-col(an+b) if last
+// is true. It matches cells that cover a column whose position, counting
+// from one at the start (or the end) of the table, is an+b.
+type nthColSelector struct {
+	a, b int
+	last bool
+}
+
+func (s nthColSelector) Match(n *html.Node) bool {
+	if !isCell(n) {
+		return false
+	}
+	table := cellTable(n)
+	if table == nil {
+		return false
+	}
+	var first, end, width int
+	if s.last {
+		first, end, width = cellColumnsAndWidth(n, table)
+	} else {
+		first, end = cellColumns(n)
+	}
+	for x := first; x < end; x++ {
+		i := x + 1
+		if s.last {
+			i = width - x
+		}
+		if anbMatches(s.a, s.b, i) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package cascadia
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestTableLayout(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<table>
+		<thead><tr><th id="a" colspan="2"><th id="b" rowspan="5"></tr></thead>
+		<tbody>
+			<tr><td id="c" rowspan="0"><td id="d" colspan="x"><td id="e" colspan="2000"></tr>
+			<tr><td id="f"><td id="g"></tr>
+			<tr><td id="h" rowspan="1"><td id="i"></tr>
+		</tbody>
+	</table>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rowspan of b doesn't reach past the thead, and c's rowspan of
+	// zero covers the rest of the tbody. Invalid spans count as 1, and
+	// large ones are clamped.
+	for id, want := range map[string][2]int{
+		"a": {0, 2},
+		"b": {2, 3},
+		"c": {0, 1},
+		"d": {1, 2},
+		"e": {2, 1002},
+		"f": {1, 2},
+		"g": {2, 3},
+		"h": {1, 2},
+		"i": {2, 3},
+	} {
+		cell := MustCompile("#" + id).MatchFirst(doc)
+		if !isCell(cell) {
+			t.Errorf("%s: not a cell", id)
+			continue
+		}
+		if first, end := cellColumns(cell); first != want[0] || end != want[1] {
+			t.Errorf("%s: got columns [%d, %d), want [%d, %d)", id, first, end, want[0], want[1])
+		}
+	}
+
+	table := MustCompile("table").MatchFirst(doc)
+	if got := tableWidth(table); got != 1002 {
+		t.Errorf("width: got %d, want 1002", got)
+	}
+}
+
+func TestTableLayoutLimit(t *testing.T) {
+	// Each cell spans 1000 columns and the rest of the rows, so each row
+	// starts 1000 columns further right than the one before.
+	var b strings.Builder
+	b.WriteString("<table><tbody>")
+	for i := 0; i < 300; i++ {
+		b.WriteString(`<tr><td colspan=1000 rowspan=0>`)
+	}
+	b.WriteString("</tbody></table>")
+	doc, err := html.Parse(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cells := MustCompile("td").MatchAll(doc)
+	if first, end := cellColumns(cells[1]); first != 1000 || end != 2000 {
+		t.Errorf("second cell: got columns [%d, %d), want [1000, 2000)", first, end)
+	}
+	if first, end := cellColumns(cells[len(cells)-1]); first != 0 || end != 0 {
+		t.Errorf("last cell: got columns [%d, %d), want none", first, end)
+	}
+	if got := MustCompile("td:nth-col(1001)").MatchAll(doc); len(got) != 1 || got[0] != cells[1] {
+		t.Errorf("td:nth-col(1001): got %d matches, want the second cell", len(got))
+	}
+}
@@ -0,0 +1,183 @@
+package cascadia
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// An IndexedSelector is a selector that uses a text index to evaluate
+// :contains(). Without an index, :contains() collects the text of each
+// candidate element, which takes time proportional to the size of the
+// element; on a large document, the total is proportional to the length of
+// the text times the depth of the tree. With an index, the text is collected
+// once per call to MatchAll, and each :contains() test takes logarithmic
+// time.
+//
+// The index takes memory proportional to the size of the document, and
+// selectors without :contains() gain nothing from it.
+type IndexedSelector struct {
+	m       Sel
+	needles []string
+}
+
+// CompileIndexed is like Compile, but it returns an IndexedSelector.
+func CompileIndexed(sel string) (*IndexedSelector, error) {
+	p := &parser{s: sel}
+	m, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	s := &IndexedSelector{m: m}
+	collectNeedles(m, &s.needles)
+	return s, nil
+}
+
+// MatchAll returns a slice of the nodes that match the selector, from n and
+// its children. The index covers n and its descendants; tests on other
+// nodes, such as the ancestors examined by a descendant combinator, fall
+// back to the unindexed method. The tree must not be modified during the
+// call.
+func (s *IndexedSelector) MatchAll(n *html.Node) []*html.Node {
+	sel := Selector(s.m.Match)
+	if len(s.needles) > 0 {
+		sel = withTextIndex(s.m, buildTextIndex(n, s.needles)).Match
+	}
+	return sel.MatchAll(n)
+}
+
+// A textSpan is the range of a node's text within a textIndex.
+type textSpan struct {
+	start, end int
+}
+
+// A textIndex records where the text of each node falls in the (lowercased)
+// text of a whole tree, and where each needle occurs in that text. Since the
+// text of a node is the concatenation of its descendant text nodes, it is a
+// contiguous range of the tree's text.
+type textIndex struct {
+	spans       map[*html.Node]textSpan
+	occurrences map[string][]int
+}
+
+func buildTextIndex(root *html.Node, needles []string) *textIndex {
+	idx := &textIndex{
+		spans:       make(map[*html.Node]textSpan),
+		occurrences: make(map[string][]int),
+	}
+
+	// The tree is walked without recursion, so that deep documents can't
+	// overflow the stack. open holds the elements (and documents) whose
+	// subtrees are still being walked, with where their text starts.
+	type openNode struct {
+		n     *html.Node
+		start int
+	}
+	var open []openNode
+	var b strings.Builder
+	pop := func() {
+		top := open[len(open)-1]
+		open = open[:len(open)-1]
+		if top.n.Type == html.ElementNode {
+			idx.spans[top.n] = textSpan{top.start, b.Len()}
+		}
+	}
+	for n := root; n != nil; {
+		for len(open) > 0 && open[len(open)-1].n != n.Parent {
+			pop()
+		}
+		switch n.Type {
+		case html.TextNode:
+			// Only elements get spans: selectors aren't matched against
+			// text nodes.
+			b.WriteString(strings.ToLower(n.Data))
+		case html.ElementNode, html.DocumentNode:
+			// A document has no span, since nodeText gives it no text,
+			// but the elements in it do.
+			open = append(open, openNode{n, b.Len()})
+		default:
+			n = nextAfterSubtree(n, root)
+			continue
+		}
+		n = nextInSubtree(n, root)
+	}
+	for len(open) > 0 {
+		pop()
+	}
+
+	text := b.String()
+	for _, needle := range needles {
+		if _, ok := idx.occurrences[needle]; ok || needle == "" {
+			continue
+		}
+		var positions []int
+		for i := 0; ; {
+			j := strings.Index(text[i:], needle)
+			if j == -1 {
+				break
+			}
+			positions = append(positions, i+j)
+			i += j + 1
+		}
+		idx.occurrences[needle] = positions
+	}
+	return idx
+}
+
+// contains reports whether the text of n contains needle, and whether n is
+// covered by the index at all.
+func (idx *textIndex) contains(n *html.Node, needle string) (found, ok bool) {
+	span, ok := idx.spans[n]
+	if !ok {
+		return false, false
+	}
+	if needle == "" {
+		return true, true
+	}
+	positions := idx.occurrences[needle]
+	i := sort.SearchInts(positions, span.start)
+	return i < len(positions) && positions[i]+len(needle) <= span.end, true
+}
+
+// indexable returns whether a textIndex can evaluate s. It can't for
+// :containsOwn(), or for a :contains() that is case-sensitive or collapses
+// whitespace, since the index is of the lowercased text as it is.
+func (s textSubstrSelector) indexable() bool {
+	return !s.own && s.ignoreCase && !s.collapse
+}
+
+// indexedTextSelector is a textSubstrSelector that uses an index.
+type indexedTextSelector struct {
+	textSubstrSelector
+	index *textIndex
+}
+
+func (s indexedTextSelector) Match(n *html.Node) bool {
+	if found, ok := s.index.contains(n, s.val); ok {
+		return found
+	}
+	return s.textSubstrSelector.Match(n)
+}
+
+// collectNeedles appends the arguments of the :contains() pseudo-classes
+// in m to needles.
+func collectNeedles(m Sel, needles *[]string) {
+	Walk(m, func(s Sel) bool {
+		if t, ok := s.(textSubstrSelector); ok && t.indexable() {
+			*needles = append(*needles, t.val)
+		}
+		return true
+	})
+}
+
+// withTextIndex returns a copy of m in which the :contains() pseudo-classes
+// use idx.
+func withTextIndex(m Sel, idx *textIndex) Sel {
+	return Rewrite(m, func(s Sel) Sel {
+		if t, ok := s.(textSubstrSelector); ok && t.indexable() {
+			return indexedTextSelector{t, idx}
+		}
+		return s
+	})
+}
@@ -0,0 +1,93 @@
+package cascadia
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+var textIndexFixtures = []string{
+	`<p>Text block that <span>wraps inner text</span> and continues</p>`,
+	`<p id="1">foo<b>BAR</b>baz</p><p id="2">Say "Hello"</p><p id="3">Say hello</p>`,
+	`<head><style>p { color: red }</style><script>var foo = "bar";</script></head><body><p>foo <i>bar</i></p><p>color: red</p></body>`,
+	`<div><div><div>ΣΊΣΥΦΟΣ <b>άγει</b></div></div><p>aaaa</p></div>`,
+	"<p>foo <b> bar</b>\n\n<i>baz  </i>\tqux<i>  </i> <u></u> <s>end</s></p>",
+}
+
+var textIndexSelectors = []string{
+	`:contains("foo")`,
+	`p:contains("obarb"), p:contains('say "hello"')`,
+	`:contains("that wraps"):not(:contains("continues"))`,
+	`div:has(b:contains("άγει")) :contains("σίσυφος")`,
+	`:contains("color: red") :contains(foo)`,
+	`script:contains("bar"), style:contains(red)`,
+	`:contains("aa")`,
+	`:contains("")`,
+	`p:containsOwn("foo"):contains("foo bar")`,
+	`:contains("not there")`,
+	`:contains(" bar"), :contains("baz "), :contains(" "), i:contains("  ")`,
+	`:contains("foo bar baz qux end"), :contains("foo\a\a bar")`,
+	`:nth-child(1 of :contains("foo")), p:nth-last-child(2n of :contains(bar))`,
+}
+
+func TestIndexedSelector(t *testing.T) {
+	for _, fixture := range textIndexFixtures {
+		doc, err := html.Parse(strings.NewReader(fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, sel := range textIndexSelectors {
+			indexed, err := CompileIndexed(sel)
+			if err != nil {
+				t.Fatalf("%s: %s", sel, err)
+			}
+
+			// Match from the document and from an element, so that some
+			// candidates' ancestors are outside the index.
+			for _, root := range []*html.Node{doc, MustCompile("body").MatchFirst(doc)} {
+				want := MustCompile(sel).MatchAll(root)
+				got := indexed.MatchAll(root)
+				if len(got) != len(want) {
+					t.Errorf("%s on %s: got %d matches, want %d", sel, fixture, len(got), len(want))
+					continue
+				}
+				for i := range got {
+					if got[i] != want[i] {
+						t.Errorf("%s on %s: match %d: got %s, want %s", sel, fixture, i, nodeString(got[i]), nodeString(want[i]))
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestTextIndexFromDocument(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p>foo <!-- bar --><b>bar</b></p><div><p>baz</p></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel := `p:contains("foo bar"), div:contains(baz)`
+	indexed, err := CompileIndexed(sel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every element under the document must have a span, or the index is
+	// never consulted.
+	idx := buildTextIndex(doc, indexed.needles)
+	for n := doc; n != nil; n = nextInSubtree(n, doc) {
+		if _, ok := idx.spans[n]; n.Type == html.ElementNode && !ok {
+			t.Errorf("no span for %s", nodeString(n))
+		}
+	}
+	if span := idx.spans[MustCompile("b").MatchFirst(doc)]; span != (textSpan{4, 7}) {
+		t.Errorf("span for <b>: got %v, want {4 7}", span)
+	}
+
+	got := indexed.MatchAll(doc)
+	want := MustCompile(sel).MatchAll(doc)
+	if len(got) != 2 || len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got %d matches, want %d", len(got), len(want))
+	}
+}
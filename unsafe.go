@@ -0,0 +1,87 @@
+package cascadia
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// An UnsafeRule is one of the checks made by UnsafeElementSelector.
+type UnsafeRule struct {
+	// Name identifies the rule in reports, such as "event-handler".
+	Name string
+
+	// Selector matches the elements that the rule flags.
+	Selector Selector
+}
+
+// cssExpression matches the old Internet Explorer expression() syntax,
+// which runs script from a style sheet.
+var cssExpression = regexp.MustCompile(`(?i)expression\s*\(`)
+
+// DefaultUnsafeRules returns the rules that UnsafeElementSelector uses when
+// it is called without any:
+//
+//	event-handler      any on* attribute, such as onclick (EventHandlerSelector)
+//	javascript-href    a javascript: URL in href
+//	javascript-src     a javascript: URL in src
+//	srcdoc-expression  expression( in srcdoc
+//	style-expression   expression( in style
+//
+// The result is a new slice each time, so callers can append their own
+// rules to it, or remove ones they don't want.
+func DefaultUnsafeRules() []UnsafeRule {
+	return []UnsafeRule{
+		{"event-handler", EventHandlerSelector()},
+		{"javascript-href", AttributeURLSchemeSelector("href", "javascript")},
+		{"javascript-src", AttributeURLSchemeSelector("src", "javascript")},
+		{"srcdoc-expression", AttributeRegexpSelector("srcdoc", cssExpression)},
+		{"style-expression", AttributeRegexpSelector("style", cssExpression)},
+	}
+}
+
+// UnsafeElementSelector returns a Selector that matches elements that any of
+// rules flags, as a starting point for finding common cross-site scripting
+// vectors in untrusted HTML. If no rules are given, it uses
+// DefaultUnsafeRules. To extend the defaults, pass
+// append(DefaultUnsafeRules(), extra...).
+//
+// The checks are heuristics over the attributes of each element; they are no
+// substitute for an HTML sanitizer. In particular, the defaults don't look
+// inside <script> elements, data: URLs or CSS with comments inside
+// expression().
+func UnsafeElementSelector(rules ...UnsafeRule) Selector {
+	if len(rules) == 0 {
+		rules = DefaultUnsafeRules()
+	}
+	sels := make([]Selector, len(rules))
+	for i, r := range rules {
+		sels[i] = r.Selector
+	}
+	return func(n *html.Node) bool {
+		for _, s := range sels {
+			if s(n) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// EventHandlerSelector returns a Selector that matches elements with an
+// inline event handler: an attribute whose name starts with "on", such as
+// onclick or onload.
+func EventHandlerSelector() Selector {
+	return func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return false
+		}
+		for _, a := range n.Attr {
+			if len(a.Key) > 2 && strings.HasPrefix(a.Key, "on") {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,50 @@
+package cascadia
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestUnsafeElementSelector(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`
+		<a id="safe" href="https://example.com/">ok</a>
+		<a id="on" href="#" ONCLICK="steal()">x</a>
+		<div id="bare-on" on="x"></div>
+		<a id="js-href" href=" JavaScript:alert(1)">x</a>
+		<img id="js-src" src="java&#9;script:alert(1)">
+		<iframe id="srcdoc" srcdoc="<p style='width: expression(alert(1))'>"></iframe>
+		<p id="style" style="width: EXPRESSION (alert(1))">x</p>
+		<p id="plain-style" style="color: red">x</p>
+		<a id="data" href="data:text/html,x">x</a>
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(s Selector) []string {
+		var result []string
+		for _, n := range s.MatchAll(doc) {
+			result = append(result, attributeValue(n, "id"))
+		}
+		return result
+	}
+
+	want := []string{"on", "js-href", "js-src", "srcdoc", "style"}
+	if got := ids(UnsafeElementSelector()); !reflect.DeepEqual(got, want) {
+		t.Errorf("default rules: got %q, want %q", got, want)
+	}
+
+	rules := append(DefaultUnsafeRules(), UnsafeRule{"data-href", AttributeURLSchemeSelector("href", "data")})
+	want = []string{"on", "js-href", "js-src", "srcdoc", "style", "data"}
+	if got := ids(UnsafeElementSelector(rules...)); !reflect.DeepEqual(got, want) {
+		t.Errorf("extended rules: got %q, want %q", got, want)
+	}
+
+	want = []string{"on"}
+	if got := ids(EventHandlerSelector()); !reflect.DeepEqual(got, want) {
+		t.Errorf("EventHandlerSelector: got %q, want %q", got, want)
+	}
+}